@@ -3,12 +3,14 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"strings"
 	"time"
 
 	"slices"
 
 	"github.com/google/uuid"
+	"github.com/showntop/llmack/hooks"
 	"github.com/showntop/llmack/llm"
 	"github.com/showntop/llmack/llm/deepseek"
 	"github.com/showntop/llmack/log"
@@ -23,6 +25,13 @@ type Agent struct {
 	ragrtv  *rag.Indexer    `json:"-"` // rag indexer
 	llm     *llm.Instance   `json:"-"` // 模型
 	stream  bool            `json:"-"` // 是否流式输出
+	budget  llm.Budget      `json:"-"` // 单次运行的 token / 费用预算
+
+	historyWindow HistoryWindow           `json:"-"` // 会话历史窗口
+	approval      *program.ApprovalPolicy `json:"-"` // 工具调用审批策略
+	planning      bool                    `json:"-"` // 先规划再逐步执行
+	// contextManager 压缩工具调用历史，默认只截断 / 丢弃工具结果，不额外调用模型总结
+	contextManager *program.ContextManager `json:"-"`
 
 	// session
 	session   *storage.Session
@@ -52,7 +61,9 @@ type Agent struct {
 
 func NewAgent(name string, options ...Option) *Agent {
 	agent := &Agent{
-		Name: name,
+		Name:           name,
+		historyWindow:  DefaultHistoryWindow(),
+		contextManager: program.NewContextManager(program.TruncateToolResults, program.DropToolOutputs),
 	}
 	for _, option := range options {
 		option(agent)
@@ -109,6 +120,11 @@ func (agent *Agent) Copy() *Agent {
 		TeamID:       agent.TeamID,
 		llm:          agent.llm,
 		storage:      agent.storage,
+		budget:       agent.budget,
+
+		historyWindow: agent.historyWindow,
+		approval:      agent.approval,
+		planning:      agent.planning,
 	}
 	return newAgent
 
@@ -123,24 +139,42 @@ func (agent *Agent) Invoke(ctx context.Context, task string, opts ...InvokeOptio
 	for _, opt := range opts {
 		opt(options)
 	}
-	agent.response = &AgentRunResponse{
+	return agent.start(options, func() {
+		agent.invoke(ctx, task, options)
+	})
+}
+
+func (agent *Agent) start(options *InvokeOptions, run func()) *AgentRunResponse {
+	response := &AgentRunResponse{
 		Stream: make(chan *llm.Chunk, 10),
 	}
+	agent.response = response
 	if options.Stream {
 		go func() {
 			defer func() {
-				close(agent.response.Stream)
+				close(response.Stream)
 			}()
-			agent.invoke(ctx, task, options)
+			run()
 		}()
-		return agent.response
+		return response
 	} else {
-		agent.invoke(ctx, task, options)
-		return agent.response
+		run()
+		return response
 	}
 }
 
 func (agent *Agent) invoke(ctx context.Context, task string, options *InvokeOptions) (*AgentRunResponse, error) {
+	return agent.run(ctx, task, options, func(ctx context.Context) (*AgentRunResponse, error) {
+		return agent.retry(ctx, task, options.Stream)
+	})
+}
+
+// run runs fn within the session, usage ledger and memory of agent, task is added to memory if not empty
+func (agent *Agent) run(ctx context.Context, task string, options *InvokeOptions,
+	fn func(context.Context) (*AgentRunResponse, error)) (_ *AgentRunResponse, err error) {
+	ctx, span := hooks.StartAgentSpan(ctx, agent.ID, agent.Name)
+	defer func() { hooks.EndSpan(span, err) }()
+
 	// fetch or create a new session
 	session, err := agent.fetchOrCreateSession(ctx, options.SessionID)
 	if err != nil {
@@ -151,11 +185,24 @@ func (agent *Agent) invoke(ctx context.Context, task string, options *InvokeOpti
 	agent.SessionID = session.UID
 	agent.session = session
 
+	// usage of this run, accumulated to the ledger of caller (team or workflow) if any
+	ledger := llm.NewLedger(llm.WithBudget(agent.budget))
+	if parent := llm.LedgerFrom(ctx); parent != nil {
+		ledger = parent.Child(llm.WithBudget(agent.budget))
+	}
+	ctx = llm.WithUsageScope(llm.WithLedger(ctx, ledger), agent.Name, session.UID)
+	defer func() {
+		total := ledger.Total()
+		agent.response.Usage = total.Usage()
+		agent.response.Cost = total.Cost
+		agent.response.Ledger = ledger
+	}()
+
 	defer func() { //  Update Agent Memory
 		log.DebugContextf(ctx, "agent response:\n")
 		log.DebugContextf(ctx, "===============================\n %s", agent.response.Answer)
 		log.DebugContextf(ctx, "===============================")
-		if agent.memory != nil {
+		if agent.memory != nil && task != "" {
 			agent.memory.Add(ctx, session.UID, memory.NewMemoryItem(session.UID, task, nil))
 		}
 		if agent.storage != nil {
@@ -164,7 +211,7 @@ func (agent *Agent) invoke(ctx context.Context, task string, options *InvokeOpti
 	}()
 
 	for range options.Retries {
-		response, err := agent.retry(ctx, task, options.Stream)
+		response, err := fn(ctx)
 		if err != nil {
 			response.Error = err
 			return agent.response, err
@@ -176,7 +223,50 @@ func (agent *Agent) invoke(ctx context.Context, task string, options *InvokeOpti
 
 // 迭代一次
 func (agent *Agent) retry(ctx context.Context, task string, stream bool) (*AgentRunResponse, error) {
-	input := map[string]any{}
+	question := task // persisted to session without knowledges
+	agentPrompt, err := agent.instruction(ctx)
+	if err != nil {
+		agent.response.Error = err
+		return agent.response, err
+	}
+
+	if agent.ragrtv != nil {
+		knowledges, err := agent.ragrtv.Retrieve(ctx, task, rag.WithTopK(10))
+		if err != nil {
+			agent.response.Error = err
+			return agent.response, err
+		}
+		if len(knowledges) > 0 {
+			jsonKnowledges, err := json.Marshal(knowledges)
+			if err != nil {
+				agent.response.Error = err
+				return agent.response, err
+			}
+			task += "\n\nReference the following knowledges from the knowledge base if it helps:\n"
+			task += "<knowledges>\n" + string(jsonKnowledges) + "\n</knowledges>\n"
+		}
+	}
+
+	messages := append(agent.history(ctx), llm.NewUserTextMessage(task))
+	newProgram := program.FunCall
+	if agent.planning {
+		newProgram = program.PlanExecute
+	}
+	predictor := newProgram(
+		program.WithLLMInstance(agent.llm),
+	).WithInstruction(agentPrompt).
+		WithInputs(map[string]any{}).
+		WithTools(agent.Tools...).
+		WithStream(stream).
+		WithPromptCache(true).
+		WithContextManager(agent.contextManager).
+		WithApproval(agent.approval).
+		InvokeWithMessages(ctx, messages)
+	return agent.collect(predictor, question, stream)
+}
+
+// instruction renders the system prompt of agent with memories
+func (agent *Agent) instruction(ctx context.Context) (string, error) {
 	agentPrompt := ""
 	if agent.Name != "" {
 		agentPrompt += "\n<name>\n" + agent.Name + "\n</name>\n"
@@ -200,8 +290,7 @@ func (agent *Agent) retry(ctx context.Context, task string, stream bool) (*Agent
 	if agent.memory != nil {
 		items, err := agent.memory.Get(ctx, agent.SessionID)
 		if err != nil {
-			agent.response.Error = err
-			return agent.response, err
+			return "", err
 		}
 		if len(items) > 0 {
 			agentPrompt += "You have access to memories from previous interactions with the user that you can use:\n\n"
@@ -217,44 +306,44 @@ func (agent *Agent) retry(ctx context.Context, task string, stream bool) (*Agent
 			agentPrompt += "but have not had any interactions with the user yet.\n"
 		}
 	}
+	return agentPrompt, nil
+}
 
-	if agent.ragrtv != nil {
-		knowledges, err := agent.ragrtv.Retrieve(ctx, task, rag.WithTopK(10))
-		if err != nil {
-			agent.response.Error = err
-			return agent.response, err
-		}
-		if len(knowledges) > 0 {
-			jsonKnowledges, err := json.Marshal(knowledges)
-			if err != nil {
-				agent.response.Error = err
-				return agent.response, err
-			}
-			task += "\n\nReference the following knowledges from the knowledge base if it helps:\n"
-			task += "<knowledges>\n" + string(jsonKnowledges) + "\n</knowledges>\n"
-		}
-	}
+// invocation the invoked program of agent
+type invocation interface {
+	Stream() chan *llm.Chunk
+	Response() *program.Response
+	Error() error
+	Checkpoint() *program.Checkpoint
+	Messages() []llm.Message
+}
 
-	predictor := program.FunCall(
-		program.WithLLMInstance(agent.llm),
-	).WithInstruction(agentPrompt).
-		WithInputs(input).
-		WithTools(agent.Tools...).
-		WithStream(stream).
-		InvokeQuery(ctx, task)
-	if predictor.Error() != nil {
-		agent.response.Error = predictor.Error()
-		return agent.response, predictor.Error()
-	}
+// collect forwards the stream of predictor and appends the turn to session
+func (agent *Agent) collect(predictor invocation, question string, stream bool) (*AgentRunResponse, error) {
 	if stream {
 		for chunk := range predictor.Stream() {
 			agent.response.Stream <- chunk
 		}
 	}
 	agent.response.Answer = predictor.Response().Completion()
-	agent.response.Usage.PromptTokens += predictor.Usage.PromptTokens
-	agent.response.Usage.CompletionTokens += predictor.Usage.CompletionTokens
-	agent.response.Usage.TotalTokens += predictor.Usage.TotalTokens
+	if err := predictor.Error(); errors.Is(err, program.ErrApprovalRequired) { // paused, resumed by Resume
+		checkpoint := predictor.Checkpoint()
+		if agent.session.EngineData == nil {
+			agent.session.EngineData = map[string]any{}
+		}
+		agent.session.EngineData[pendingApprovalKey] = &pendingApproval{Question: question, Checkpoint: checkpoint}
+		agent.response.PendingApprovals = checkpoint.Pending
+		agent.response.Error = err
+		return agent.response, err
+	}
+	if err := predictor.Error(); err != nil {
+		agent.response.Error = err
+		return agent.response, err
+	}
+	delete(agent.session.EngineData, pendingApprovalKey)
+	// append the turn to session, persisted by UpdateSession
+	agent.session.Messages = append(agent.session.Messages, llm.NewUserTextMessage(question))
+	agent.session.Messages = append(agent.session.Messages, predictor.Messages()...)
 	return agent.response, nil
 }
 
@@ -279,7 +368,10 @@ func (agent *Agent) fetchOrCreateSession(ctx context.Context, sessionID string)
 		return session, nil
 	}
 
-	if agent.storage == nil { // no storage just in memory
+	if agent.storage == nil { // no storage just in memory, keep the session of last invoke
+		if agent.session != nil && agent.session.UID == sessionID {
+			return agent.session, nil
+		}
 		return &storage.Session{
 			UID:        sessionID,
 			EngineID:   agent.ID,
@@ -0,0 +1,17 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/showntop/llmack/program"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAgent_ContextManager(t *testing.T) {
+	agent := NewAgent("a")
+	assert.NotContains(t, agent.contextManager.Strategies, program.SummarizeTurns) // no hidden llm calls by default
+
+	manager := program.NewContextManager()
+	agent = NewAgent("a", WithContextManager(manager))
+	assert.Same(t, manager, agent.contextManager)
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/showntop/llmack/program"
+)
+
+// pendingApprovalKey key of the paused run in session EngineData
+const pendingApprovalKey = "pending_approval"
+
+// pendingApproval the run paused for tool call approval, persisted with session
+type pendingApproval struct {
+	Question   string              `json:"question"`
+	Checkpoint *program.Checkpoint `json:"checkpoint"`
+}
+
+// pendingApproval loads the paused run of session, decoded from json if restored by storage
+func (agent *Agent) pendingApproval() (*pendingApproval, error) {
+	value, ok := agent.session.EngineData[pendingApprovalKey]
+	if !ok || value == nil {
+		return nil, fmt.Errorf("no pending approval in session %s", agent.session.UID)
+	}
+	if pending, ok := value.(*pendingApproval); ok {
+		return pending, nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	pending := &pendingApproval{}
+	if err := json.Unmarshal(raw, pending); err != nil {
+		return nil, fmt.Errorf("decode pending approval error: %w", err)
+	}
+	return pending, nil
+}
+
+// Resume continues the run of session paused for tool call approval, decisions of
+// AgentRunResponse.PendingApprovals by tool call id. The session may be paused by another process
+// sharing the storage.
+func (agent *Agent) Resume(ctx context.Context, sessionID string,
+	decisions map[string]*program.ApprovalDecision, opts ...InvokeOption) *AgentRunResponse {
+	options := &InvokeOptions{
+		Stream: false,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	options.SessionID = sessionID
+	options.Retries = 1
+	return agent.start(options, func() {
+		agent.run(ctx, "", options, func(ctx context.Context) (*AgentRunResponse, error) {
+			return agent.resume(ctx, decisions, options.Stream)
+		})
+	})
+}
+
+func (agent *Agent) resume(ctx context.Context, decisions map[string]*program.ApprovalDecision, stream bool) (*AgentRunResponse, error) {
+	pending, err := agent.pendingApproval()
+	if err != nil {
+		agent.response.Error = err
+		return agent.response, err
+	}
+	agentPrompt, err := agent.instruction(ctx)
+	if err != nil {
+		agent.response.Error = err
+		return agent.response, err
+	}
+	newProgram := program.FunCall
+	if agent.planning { // the checkpoint carries the plan
+		newProgram = program.PlanExecute
+	}
+	predictor := newProgram(
+		program.WithLLMInstance(agent.llm),
+	).WithInstruction(agentPrompt).
+		WithInputs(map[string]any{}).
+		WithTools(agent.Tools...).
+		WithStream(stream).
+		WithPromptCache(true).
+		WithContextManager(agent.contextManager).
+		WithApproval(agent.approval).
+		Resume(ctx, pending.Checkpoint, decisions)
+	return agent.collect(predictor, pending.Question, stream)
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/showntop/llmack/log"
+)
+
+// Collaboration 协作模式配置：所有成员处理同一个任务，多轮协作中可以看到其他成员的回答，最后由 leader 综合给出共识答案
+type Collaboration struct {
+	Rounds     int  // 协作轮数，默认 1
+	Sequential bool // 每轮成员依次回答，可以看到同一轮之前成员的回答；默认并发
+	// Stop 每轮结束后判断是否提前结束协作，interactions 为至今所有成员的回答
+	Stop func(ctx context.Context, round int, interactions []TeamMemberInteraction) bool
+}
+
+// collaborate runs the members on the task in rounds, contributions are recorded in team memory under run
+func (t *Team) collaborate(ctx context.Context, run string, task string) error {
+	rounds := max(t.collaboration.Rounds, 1)
+	for round := 1; round <= rounds; round++ {
+		var err error
+		if t.collaboration.Sequential {
+			err = t.collaborateSequential(ctx, run, task, round)
+		} else {
+			err = t.collaborateConcurrent(ctx, run, task, round)
+		}
+		if err != nil {
+			return err
+		}
+		interactions, err := t.interactionsOf(ctx, run)
+		if err != nil {
+			return err
+		}
+		if t.collaboration.Stop != nil && t.collaboration.Stop(ctx, round, interactions) {
+			log.InfoContextf(ctx, "team %s collaboration stopped at round %d", t.Name, round)
+			break
+		}
+	}
+	return nil
+}
+
+func (t *Team) collaborateConcurrent(ctx context.Context, run string, task string, round int) error {
+	instruction, err := t.collaborateInstruction(ctx, run, task, round)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, len(t.members))
+	wg := sync.WaitGroup{}
+	for i, member := range t.members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = t.contribute(ctx, member, run, task, instruction)
+		}()
+	}
+	wg.Wait()
+	return t.roundError(round, errs)
+}
+
+func (t *Team) collaborateSequential(ctx context.Context, run string, task string, round int) error {
+	errs := make([]error, len(t.members))
+	for i, member := range t.members {
+		instruction, err := t.collaborateInstruction(ctx, run, task, round)
+		if err != nil {
+			return err
+		}
+		errs[i] = t.contribute(ctx, member, run, task, instruction)
+	}
+	return t.roundError(round, errs)
+}
+
+// roundError fails the round only if no member contributed
+func (t *Team) roundError(round int, errs []error) error {
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("team %s has no members to collaborate", t.Name)
+	}
+	return fmt.Errorf("team %s collaboration round %d failed: %w", t.Name, round, errs[0])
+}
+
+// contribute runs a copy of member, the response is recorded even if failed
+func (t *Team) contribute(ctx context.Context, member Runnable, run string, task string, instruction string) error {
+	response := t.runMember(ctx, member, instruction)
+	name := member.Profile().Name
+	if response.Error != nil {
+		log.WarnContextf(ctx, "team %s member %s collaborate error: %v", t.Name, name, response.Error)
+		return response.Error
+	}
+	return t.memory.AddTeamMemberInteraction(ctx, TeamMemberInteraction{RunID: run, MemberName: name, Task: task, Response: response})
+}
+
+func (t *Team) collaborateInstruction(ctx context.Context, run string, task string, round int) (string, error) {
+	instruction := "You are a member of a team of agents collaborating on the following task:"
+	instruction += "\n\n<task>\n" + task + "\n</task>"
+	if t.agenticSharedContext {
+		sharedContext, err := t.memory.GetSharedContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		instruction += "\n\n<team_context>\n" + sharedContext + "\n</team_context>"
+	}
+	interactions, err := t.interactionsOf(ctx, run)
+	if err != nil {
+		return "", err
+	}
+	if len(interactions) > 0 {
+		instruction += "\n\n" + renderMemberInteractions(interactions)
+		instruction += fmt.Sprintf("\nThis is round %d. Review the contributions of the other members above, ", round)
+		instruction += "point out where you agree or disagree, then give your own complete answer."
+	}
+	return instruction, nil
+}
+
+// interactionsOf the member interactions of run, team memory keeps those of previous invokes
+func (t *Team) interactionsOf(ctx context.Context, run string) ([]TeamMemberInteraction, error) {
+	interactions, err := t.memory.GetTeamMemberInteractions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matched := []TeamMemberInteraction{}
+	for _, interaction := range interactions {
+		if interaction.RunID == run {
+			matched = append(matched, interaction)
+		}
+	}
+	return matched, nil
+}
+
+// renderMemberInteractions ...
+func renderMemberInteractions(interactions []TeamMemberInteraction) string {
+	builder := strings.Builder{}
+	builder.WriteString("<member_interactions>\n")
+	for _, interaction := range interactions {
+		builder.WriteString(fmt.Sprintf("- Member: %s\n", interaction.MemberName))
+		builder.WriteString(fmt.Sprintf("  Task: %s\n", interaction.Task))
+		builder.WriteString(fmt.Sprintf("  Response: %s\n", interaction.Response.Answer))
+	}
+	builder.WriteString("</member_interactions>\n")
+	return builder.String()
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+// replyProvider replies the same text and records the last user message of each request
+type replyProvider struct {
+	sync.Mutex
+	reply string
+	tasks []string
+}
+
+func (p *replyProvider) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	p.Lock()
+	p.tasks = append(p.tasks, messages[len(messages)-1].Content())
+	p.Unlock()
+	response := llm.NewStreamResponse()
+	go func() {
+		defer response.Stream().Close()
+		response.Stream().Push(llm.NewChunk(0, llm.NewAssistantMessage(p.reply), nil))
+	}()
+	return response, nil
+}
+
+func TestTeam_Collaborate(t *testing.T) {
+	optimist := &replyProvider{reply: "it will rain"}
+	pessimist := &replyProvider{reply: "it will be sunny"}
+	leader := &replyProvider{reply: "probably rain"}
+	rounds := 0
+	team := NewTeam(TeamModeCollaborate,
+		WithModel(llm.NewInstance("leader", llm.WithProvider(leader))),
+		WithMembers(
+			NewAgent("optimist", WithModel(llm.NewInstance("optimist", llm.WithProvider(optimist)))),
+			NewAgent("pessimist", WithModel(llm.NewInstance("pessimist", llm.WithProvider(pessimist)))),
+		),
+		WithCollaboration(Collaboration{Rounds: 3, Sequential: true,
+			Stop: func(ctx context.Context, round int, interactions []TeamMemberInteraction) bool {
+				rounds = round
+				return len(interactions) >= 4
+			}}),
+	)
+	response := team.Invoke(context.Background(), "weather tomorrow?", WithStream(false))
+	assert.NoError(t, response.Error)
+	assert.Equal(t, "probably rain", response.Answer)
+	assert.Equal(t, 2, rounds)
+	assert.Len(t, response.MemberResponses, 4)
+
+	assert.Len(t, optimist.tasks, 2)
+	assert.NotContains(t, optimist.tasks[0], "<member_interactions>")
+	assert.Contains(t, pessimist.tasks[0], "it will rain") // sees the earlier member of the round
+	assert.Contains(t, optimist.tasks[1], "it will be sunny")
+	assert.Contains(t, leader.tasks[0], "it will be sunny")
+
+	// the same query again starts from scratch
+	response = team.Invoke(context.Background(), "weather tomorrow?", WithStream(false))
+	assert.NoError(t, response.Error)
+	assert.Equal(t, 2, rounds)
+	assert.NotContains(t, optimist.tasks[2], "<member_interactions>")
+}
+
+func TestTeam_NestedStream(t *testing.T) {
+	inner := NewTeam(TeamModeCollaborate, WithName("research"),
+		WithModel(llm.NewInstance("leader", llm.WithProvider(&replyProvider{reply: "inner answer"}))),
+		WithMembers(NewAgent("searcher", WithModel(llm.NewInstance("member", llm.WithProvider(&replyProvider{reply: "found"}))))),
+	)
+	outer := NewTeam(TeamModeCollaborate, WithName("company"),
+		WithModel(llm.NewInstance("leader", llm.WithProvider(&replyProvider{reply: "final answer"}))),
+		WithMembers(inner),
+	)
+	response := outer.Invoke(context.Background(), "research it")
+	emitters := map[string]int{}
+	for event := range response.Events() {
+		if event.Type == llm.StreamEventTextDelta {
+			emitters[event.Agent+":"+event.Delta] = event.Depth
+		}
+	}
+	assert.NoError(t, response.Error)
+	assert.Equal(t, "final answer", response.Answer)
+	assert.Equal(t, map[string]int{"searcher:found": 2, "research:inner answer": 1, "company:final answer": 0}, emitters)
+	assert.Len(t, response.MemberResponses, 1)
+	assert.Equal(t, "inner answer", response.MemberResponses[0].Answer)
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/log"
+)
+
+// HistoryWindow 会话历史窗口，控制每轮调用携带的历史消息，零值不限制
+type HistoryWindow struct {
+	Disabled  bool // 不携带历史
+	MaxTurns  int  // 最近 N 轮，一轮从 user 消息开始，包含其后的 assistant 与 tool 消息
+	MaxTokens int  // 历史消息的 token 预算（估算）
+	Summarize bool // 超出窗口的历史由模型总结为一条消息并写回会话，而不是直接丢弃
+}
+
+// DefaultHistoryWindow ...
+func DefaultHistoryWindow() HistoryWindow {
+	return HistoryWindow{MaxTurns: 10}
+}
+
+var summarizePrompt = `You are summarizing a conversation between a user and an AI assistant.
+Write a concise summary that keeps the facts, decisions, user preferences and open questions
+needed to continue the conversation. Reply with the summary only.`
+
+// summaryPrefix marks the summary message of dropped turns
+const summaryPrefix = "<conversation_summary>\n"
+
+// history returns the messages of session within the window, dropped turns are summarized if enabled
+func (agent *Agent) history(ctx context.Context) []llm.Message {
+	window := agent.historyWindow
+	if window.Disabled || agent.session == nil || len(agent.session.Messages) <= 0 {
+		return nil
+	}
+	pinned, turns := splitTurns(agent.session.Messages)
+	keep := len(turns)
+	if window.MaxTurns > 0 {
+		keep = min(keep, window.MaxTurns)
+	}
+	if window.MaxTokens > 0 {
+		tokens := llm.EstimateTokens(pinned...)
+		for i := len(turns) - 1; i >= len(turns)-keep; i-- {
+			tokens += llm.EstimateTokens(turns[i]...)
+			if tokens > window.MaxTokens {
+				keep = len(turns) - 1 - i
+				break
+			}
+		}
+	}
+	dropped, kept := turns[:len(turns)-keep], turns[len(turns)-keep:]
+	if len(dropped) > 0 && window.Summarize {
+		summary, err := agent.summarize(ctx, pinned, dropped)
+		if err != nil {
+			log.WarnContextf(ctx, "agent summarize history error: %v", err)
+		} else { // compact the session, the summary is summarized again with later dropped turns
+			pinned = []llm.Message{llm.NewSystemMessage(summaryPrefix + summary + "\n</conversation_summary>")}
+			agent.session.Messages = append(append([]llm.Message{}, pinned...), flatten(kept)...)
+		}
+	}
+	return append(append([]llm.Message{}, pinned...), flatten(kept)...)
+}
+
+func (agent *Agent) summarize(ctx context.Context, pinned []llm.Message, dropped [][]llm.Message) (string, error) {
+	builder := strings.Builder{}
+	for _, m := range append(append([]llm.Message{}, pinned...), flatten(dropped)...) {
+		if m.Content() == "" {
+			continue
+		}
+		builder.WriteString(string(m.Role()) + ": " + m.Content() + "\n")
+	}
+	response, err := agent.llm.Invoke(ctx, []llm.Message{
+		llm.NewSystemMessage(summarizePrompt),
+		llm.NewUserTextMessage(builder.String()),
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.Result().Message.Content(), nil
+}
+
+// splitTurns splits messages to turns, messages before the first user message are pinned, e.g. summary
+func splitTurns(messages []llm.Message) ([]llm.Message, [][]llm.Message) {
+	pinned := []llm.Message{}
+	turns := [][]llm.Message{}
+	for _, m := range messages {
+		if m.Role() == llm.MessageRoleUser {
+			turns = append(turns, []llm.Message{m})
+		} else if len(turns) == 0 {
+			pinned = append(pinned, m)
+		} else {
+			turns[len(turns)-1] = append(turns[len(turns)-1], m)
+		}
+	}
+	return pinned, turns
+}
+
+func flatten(turns [][]llm.Message) []llm.Message {
+	messages := []llm.Message{}
+	for _, turn := range turns {
+		messages = append(messages, turn...)
+	}
+	return messages
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func conversation() []llm.Message {
+	call := &llm.ToolCall{ID: "call_1", Type: "function", Function: llm.ToolCallFunction{Name: "weather", Arguments: `{"city":"Beijing"}`}}
+	return []llm.Message{
+		llm.NewUserTextMessage("weather of Beijing"),
+		llm.NewAssistantMessage("").WithToolCalls([]*llm.ToolCall{call}),
+		llm.NewToolMessage("sunny", "call_1"),
+		llm.NewAssistantMessage("It is sunny."),
+		llm.NewUserTextMessage("and tomorrow?"),
+		llm.NewAssistantMessage("Rainy."),
+	}
+}
+
+func TestAgent_HistoryWindow(t *testing.T) {
+	agent := NewAgent("weather", WithHistory(HistoryWindow{MaxTurns: 1}))
+	agent.session = &storage.Session{UID: "s", Messages: conversation()}
+	history := agent.history(context.Background())
+	assert.Len(t, history, 2)
+	assert.Equal(t, "and tomorrow?", history[0].Content())
+
+	agent.historyWindow = HistoryWindow{MaxTokens: 20}
+	history = agent.history(context.Background())
+	assert.Len(t, history, 2) // the first turn with tool call is over budget
+
+	agent.historyWindow = HistoryWindow{}
+	assert.Len(t, agent.history(context.Background()), 6)
+}
+
+func TestSession_MessagesJSON(t *testing.T) {
+	raw, err := json.Marshal(&storage.Session{UID: "s", Messages: conversation()})
+	assert.NoError(t, err)
+	session := &storage.Session{}
+	assert.NoError(t, json.Unmarshal(raw, session))
+	assert.Len(t, session.Messages, 6)
+	assert.Equal(t, "call_1", session.Messages[1].GetToolCalls()[0].ID)
+	assert.Equal(t, llm.MessageRoleTool, session.Messages[2].Role())
+	assert.Equal(t, "call_1", session.Messages[2].ToolID())
+	assert.Equal(t, "It is sunny.", session.Messages[3].Content())
+}
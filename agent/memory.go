@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"slices"
 	"sync"
 )
 
@@ -17,6 +18,7 @@ type SharedContexts struct {
 }
 
 type TeamMemberInteraction struct {
+	RunID      string // the team invoke of a collaboration, empty for other modes
 	MemberName string
 	Task       string
 	Response   *AgentRunResponse
@@ -41,21 +43,26 @@ func (t *TeamMemory) GetTeamMemberInteractions(ctx context.Context) ([]TeamMembe
 	t.RLock()
 	defer t.RUnlock()
 
-	return t.SharedContexts.TeamMemberInteractions, nil
+	return slices.Clone(t.SharedContexts.TeamMemberInteractions), nil
 }
 
 func (t *TeamMemory) AddTeamMemberInteractions(ctx context.Context, memberName string, task string, response *AgentRunResponse) error {
 	t.Lock()
 	defer t.Unlock()
 
-	t.SharedContexts.TeamMemberInteractions = append(t.SharedContexts.TeamMemberInteractions, struct {
-		MemberName string
-		Task       string
-		Response   *AgentRunResponse
-	}{
+	t.SharedContexts.TeamMemberInteractions = append(t.SharedContexts.TeamMemberInteractions, TeamMemberInteraction{
 		MemberName: memberName,
 		Task:       task,
 		Response:   response,
 	})
 	return nil
 }
+
+// AddTeamMemberInteraction ...
+func (t *TeamMemory) AddTeamMemberInteraction(ctx context.Context, interaction TeamMemberInteraction) error {
+	t.Lock()
+	defer t.Unlock()
+
+	t.SharedContexts.TeamMemberInteractions = append(t.SharedContexts.TeamMemberInteractions, interaction)
+	return nil
+}
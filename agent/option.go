@@ -4,6 +4,7 @@ import (
 	"github.com/showntop/llmack/llm"
 	"github.com/showntop/llmack/memory"
 	"github.com/showntop/llmack/pkg/browser"
+	"github.com/showntop/llmack/program"
 	"github.com/showntop/llmack/rag"
 	"github.com/showntop/llmack/storage"
 )
@@ -118,6 +119,15 @@ func WithShareMemberInteractions(enable bool) Option {
 	}
 }
 
+// WithCollaboration configures the rounds of TeamModeCollaborate
+func WithCollaboration(collaboration Collaboration) Option {
+	return func(a any) {
+		if at, ok := a.(*Team); ok {
+			at.collaboration = collaboration
+		}
+	}
+}
+
 func WithMode(mode TeamMode) Option {
 	return func(a any) {
 		if a, ok := a.(*Team); ok {
@@ -126,7 +136,8 @@ func WithMode(mode TeamMode) Option {
 	}
 }
 
-func WithMembers(members ...*Agent) Option {
+// WithMembers members of the team, e.g. Agent, BrowserAgent, MobileAgent or a nested Team
+func WithMembers(members ...Runnable) Option {
 	return func(a any) {
 		if a, ok := a.(*Team); ok {
 			a.members = members
@@ -152,6 +163,26 @@ func WithMemory(memory memory.Memory) Option {
 	}
 }
 
+// WithBudget stops the run with llm.ErrBudgetExceeded once token or cost budget is exceeded
+func WithBudget(budget llm.Budget) Option {
+	return func(a any) {
+		if at, ok := a.(*Team); ok {
+			at.budget = budget
+		} else if aa, ok := a.(*Agent); ok {
+			aa.budget = budget
+		}
+	}
+}
+
+// WithHistory configures the history window of session messages carried by each invoke
+func WithHistory(window HistoryWindow) Option {
+	return func(a any) {
+		if aa, ok := a.(*Agent); ok {
+			aa.historyWindow = window
+		}
+	}
+}
+
 func WithBrowserConfig(config *browser.BrowserConfig) Option {
 	return func(a any) {
 		if at, ok := a.(*BrowserAgent); ok {
@@ -169,3 +200,32 @@ func WithBrowserConfig(config *browser.BrowserConfig) Option {
 // 		}
 // 	}
 // }
+
+// WithApproval requires approval of the tool calls by policy, a paused run is continued by Agent.Resume
+func WithApproval(policy *program.ApprovalPolicy) Option {
+	return func(a any) {
+		if aa, ok := a.(*Agent); ok {
+			aa.approval = policy
+		}
+	}
+}
+
+// WithPlanning runs the agent with program.PlanExecute: plans the steps of the task first, then executes them
+// one by one with the tools and revises the plan on failures
+func WithPlanning(enable bool) Option {
+	return func(a any) {
+		if aa, ok := a.(*Agent); ok {
+			aa.planning = enable
+		}
+	}
+}
+
+// WithContextManager sets the context manager of the tool call history, e.g.
+// program.NewContextManager() to summarize the earlier turns with the llm as well
+func WithContextManager(manager *program.ContextManager) Option {
+	return func(a any) {
+		if aa, ok := a.(*Agent); ok {
+			aa.contextManager = manager
+		}
+	}
+}
@@ -15,6 +15,10 @@ type TeamRunResponse struct {
 	Stream          chan *llm.Chunk
 	MemberResponses []*AgentRunResponse
 
+	Usage  llm.Usage   `json:"usage"`
+	Cost   float64     `json:"cost"`
+	Ledger *llm.Ledger `json:"-"` // usage per provider, model, agent and session
+
 	Error error
 }
 
@@ -32,6 +36,11 @@ func (t *TeamRunResponse) String() string {
 	return t.Answer
 }
 
+// Events decodes Stream to typed events, e.g. to render a tool call being formed
+func (t *TeamRunResponse) Events() <-chan *llm.StreamEvent {
+	return llm.Events(t.Stream)
+}
+
 type AgentRunResponse struct {
 	Reasoning string         `json:"reasoning"`
 	Answer    string         `json:"answer"`
@@ -40,8 +49,17 @@ type AgentRunResponse struct {
 
 	Stream chan *llm.Chunk
 	Usage  llm.Usage
+	Cost   float64     `json:"cost"`
+	Ledger *llm.Ledger `json:"-"` // usage per provider, model, agent and session
+
+	PendingApprovals []*llm.ToolCall `json:"pending_approvals,omitempty"` // tool calls waiting for approval, see Agent.Resume
 }
 
 func (a *AgentRunResponse) Completion() string {
 	return a.Answer
 }
+
+// Events decodes Stream to typed events, e.g. to render a tool call being formed
+func (a *AgentRunResponse) Events() <-chan *llm.StreamEvent {
+	return llm.Events(a.Stream)
+}
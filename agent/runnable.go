@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/showntop/llmack/llm"
+)
+
+// Runnable 可作为团队成员运行的 agent，Agent、BrowserAgent、MobileAgent 与 Team 均已实现，团队可以嵌套
+type Runnable interface {
+	Profile() Profile
+	// Run runs the task, the response is complete once its Stream is closed
+	Run(ctx context.Context, task string, opts ...InvokeOption) *AgentRunResponse
+}
+
+// Profile 成员信息，供 leader 选择成员
+type Profile struct {
+	Name        string
+	Description string
+	Tools       []any
+}
+
+// Profile ...
+func (agent *Agent) Profile() Profile {
+	return Profile{Name: agent.Name, Description: agent.Description, Tools: agent.Tools}
+}
+
+// Run runs a copy of agent, so that a member can run concurrently
+func (agent *Agent) Run(ctx context.Context, task string, opts ...InvokeOption) *AgentRunResponse {
+	return agent.Copy().Invoke(ctx, task, opts...)
+}
+
+// Run runs the browser agent, the browser session is shared so runs are not concurrent
+func (agent *BrowserAgent) Run(ctx context.Context, task string, opts ...InvokeOption) *AgentRunResponse {
+	return agent.Invoke(ctx, task, opts...)
+}
+
+// Run runs the mobile agent, the device is shared so runs are not concurrent
+func (agent *MobileAgent) Run(ctx context.Context, task string, opts ...InvokeOption) *AgentRunResponse {
+	return agent.Invoke(ctx, task, opts...)
+}
+
+// Profile of the team as a member of the parent team
+func (t *Team) Profile() Profile {
+	names := []string{}
+	for _, member := range t.members {
+		names = append(names, member.Profile().Name)
+	}
+	description := t.Description
+	if len(names) > 0 {
+		description += "\n(a team of: " + strings.Join(names, ", ") + ")"
+	}
+	return Profile{Name: t.Name, Description: description}
+}
+
+// Run runs a copy of the team as a member of the parent team
+func (t *Team) Run(ctx context.Context, task string, opts ...InvokeOption) *AgentRunResponse {
+	options := &InvokeOptions{Stream: true} // defaults of Team.Invoke
+	for _, opt := range opts {
+		opt(options)
+	}
+	teamResponse := t.fork().Invoke(ctx, task, opts...)
+	response := &AgentRunResponse{Stream: make(chan *llm.Chunk, 10)}
+	complete := func() {
+		response.Answer = teamResponse.Answer
+		response.Error = teamResponse.Error
+		response.Usage = teamResponse.Usage
+		response.Cost = teamResponse.Cost
+		response.Ledger = teamResponse.Ledger
+	}
+	if !options.Stream {
+		complete()
+		close(response.Stream)
+		return response
+	}
+	go func() {
+		defer close(response.Stream)
+		for chunk := range teamResponse.Stream {
+			response.Stream <- chunk
+		}
+		complete()
+	}()
+	return response
+}
+
+// fork copies the team with a new memory for a concurrent run
+func (t *Team) fork() *Team {
+	return &Team{
+		Agent:                   *t.Agent.Copy(),
+		mode:                    t.mode,
+		members:                 t.members,
+		agenticSharedContext:    t.agenticSharedContext,
+		shareMemberInteractions: t.shareMemberInteractions,
+		collaboration:           t.collaboration,
+	}
+}
+
+// AddMember ...
+func (t *Team) AddMember(member Runnable) {
+	t.members = append(t.members, member)
+}
+
+// member finds the member by name
+func (t *Team) member(name string) Runnable {
+	for _, member := range t.members {
+		if member.Profile().Name == name {
+			return member
+		}
+	}
+	return nil
+}
+
+// runMember runs member until complete and records its response, its chunks are forwarded to the team stream with attribution if streaming
+func (t *Team) runMember(ctx context.Context, member Runnable, task string) *AgentRunResponse {
+	response := member.Run(ctx, task, WithStream(true))
+	name := member.Profile().Name
+	for chunk := range response.Stream { // block until member completion
+		if !t.stream {
+			continue
+		}
+		tagged := *chunk
+		if tagged.Agent == "" {
+			tagged.Agent = name
+		}
+		tagged.Depth++
+		t.response.Stream <- &tagged
+	}
+	t.response.AddMemberResponse(response)
+	return response
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/google/uuid"
+	"github.com/showntop/llmack/hooks"
 	"github.com/showntop/llmack/llm"
 	"github.com/showntop/llmack/llm/deepseek"
 	"github.com/showntop/llmack/program"
@@ -17,18 +19,19 @@ type TeamMode string
 const (
 	TeamModeRoute       TeamMode = "route"       // 路由模式, 路由模式下，团队leader 会根据用户请求，选择合适的 agent 进行处理
 	TeamModeCoordinate  TeamMode = "coordinate"  // 协调模式, 协调模式下，团队leader 会根据用户请求，拆分任务给各个 agent 进行处理，最后综合给出答案
-	TeamModeCollaborate TeamMode = "collaborate" // 协作模式, 协作模式下，团队leader 会根据用户请求，
+	TeamModeCollaborate TeamMode = "collaborate" // 协作模式, 协作模式下，所有成员协作处理同一个任务，团队leader 综合给出共识答案
 )
 
 // Team A team of agents
 type Team struct {
 	Agent
 	mode                    TeamMode
-	members                 []*Agent
+	members                 []Runnable
 	memory                  TeamMemory
 	response                *TeamRunResponse
-	agenticSharedContext    bool // 是否启用 agentic 模式的共享（team 所有成员）上下文
-	shareMemberInteractions bool // 是否共享成员之间的交互
+	agenticSharedContext    bool          // 是否启用 agentic 模式的共享（team 所有成员）上下文
+	shareMemberInteractions bool          // 是否共享成员之间的交互
+	collaboration           Collaboration // 协作模式配置
 }
 
 func NewTeam(mode TeamMode, opts ...Option) *Team {
@@ -54,20 +57,59 @@ func (t *Team) Invoke(ctx context.Context, query string, optfuncs ...InvokeOptio
 	for _, opt := range optfuncs {
 		opt(options)
 	}
+	t.stream = options.Stream
+	if options.Stream {
+		go func() {
+			defer close(t.response.Stream)
+			t.invoke(ctx, query, options)
+		}()
+		return t.response
+	}
+	t.invoke(ctx, query, options)
+	close(t.response.Stream)
+	return t.response
+}
 
-	_, err := t.fetchOrCreateSession(ctx, options.SessionID)
-	if err != nil {
+func (t *Team) invoke(ctx context.Context, query string, options *InvokeOptions) (err error) {
+	ctx, span := hooks.StartAgentSpan(ctx, t.ID, t.Name)
+	defer func() {
+		hooks.EndSpan(span, err)
 		t.response.Error = err
-		return t.response
+	}()
+	session, err := t.fetchOrCreateSession(ctx, options.SessionID)
+	if err != nil {
+		return err
+	}
+
+	// members record usage to child ledgers of the team ledger
+	ledger := llm.NewLedger(llm.WithBudget(t.budget))
+	if parent := llm.LedgerFrom(ctx); parent != nil {
+		ledger = parent.Child(llm.WithBudget(t.budget))
 	}
+	ctx = llm.WithUsageScope(llm.WithLedger(ctx, ledger), t.Name, session.UID)
+	t.response.Ledger = ledger
+	defer func() {
+		total := ledger.Total()
+		t.response.Usage = total.Usage()
+		t.response.Cost = total.Cost
+	}()
 
 	prog := program.FunCall(program.WithLLMInstance(t.llm)).WithStream(options.Stream)
 	if t.mode == TeamModeRoute {
 		prog.WithInstruction(routePrompt).WithTools(t.distributeTask())
 	} else if t.mode == TeamModeCoordinate {
 		prog.WithInstruction(coordinatePrompt).WithTools(t.assignTask())
-	} else if t.mode == TeamModeCollaborate {
+	} else if t.mode == TeamModeCollaborate { // members contribute before the leader synthesizes
+		run := uuid.NewString() // interactions of previous invokes on the same query are excluded
+		if err := t.collaborate(ctx, run, query); err != nil {
+			return err
+		}
+		interactions, err := t.interactionsOf(ctx, run)
+		if err != nil {
+			return err
+		}
 		prog.WithInstruction(collaboratePrompt)
+		query += "\n\n" + renderMemberInteractions(interactions)
 	}
 
 	if t.agenticSharedContext {
@@ -80,24 +122,19 @@ func (t *Team) Invoke(ctx context.Context, query string, optfuncs ...InvokeOptio
 		"instructions": "<instructions>\n" + strings.Join(t.Instructions, "\n") + "\n</instructions>",
 		"agents":       t.renderAgents(t.members),
 	}).InvokeQuery(ctx, query)
-	if predictor.Error() != nil {
-		t.response.Error = predictor.Error()
-		return t.response
-	}
 	if options.Stream {
-		go func() {
-			defer close(t.response.Stream)
-			for chunk := range predictor.Stream() {
-				t.response.Stream <- chunk
+		for chunk := range predictor.Stream() { // leader chunks, attributed to the team
+			if chunk.Agent == "" {
+				chunk.Agent = t.Name
 			}
-		}()
-	} else {
-		close(t.response.Stream)
+			t.response.Stream <- chunk
+		}
+	}
+	if err := predictor.Error(); err != nil {
+		return err
 	}
-
 	t.response.Answer = predictor.Completion()
-
-	return t.response
+	return nil
 }
 
 func (t *Team) setSharedContext() string {
@@ -150,18 +187,10 @@ func (t *Team) assignTask() string {
 		task := params.Task
 		expectedOutput := params.ExpectedOutput
 
-		var agent *Agent
-		for _, a := range t.members {
-			if a.Name == memberID {
-				agent = a
-				break
-			}
-		}
-		if agent == nil {
+		member := t.member(memberID)
+		if member == nil {
 			return "", fmt.Errorf("agent not found")
 		}
-		// deep copy a agent
-		agent = agent.Copy()
 
 		taskInstruction := "You are a member of a team of agents. Your goal is to complete the following task:"
 		taskInstruction += "\n\n<task>\n" + task + "\n</task>"
@@ -183,36 +212,17 @@ func (t *Team) assignTask() string {
 				return "", err
 			}
 
-			builder := strings.Builder{}
-			builder.WriteString("<member_interactions>\n")
-			for _, interaction := range memberInteractions {
-				builder.WriteString(fmt.Sprintf("- Member: %s\n", interaction.MemberName))
-				builder.WriteString(fmt.Sprintf("  Task: %s\n", interaction.Task))
-				builder.WriteString(fmt.Sprintf("  Response: %s\n", interaction.Response.Answer))
-			}
-			builder.WriteString("</member_interactions>\n")
-			taskInstruction += builder.String()
-		}
-
-		// run the agent
-		agentResponse := agent.Invoke(ctx, taskInstruction, WithStream(true)) // stream false for blocking util agent completion was built
-		if agentResponse.Error != nil {
-			return "", agentResponse.Error
+			taskInstruction += renderMemberInteractions(memberInteractions)
 		}
-		t.response.AddMemberResponse(agentResponse)
 
-		for chunk := range agentResponse.Stream { // block until agent completion
-			if agent.stream { // and show member response
-				t.response.Stream <- chunk // 防止 t.response.Stream 容量太小，产生 block
-			}
-		}
-		// recheck error because agent may not have completed
+		// run the agent, block until completion
+		agentResponse := t.runMember(ctx, member, taskInstruction)
 		if agentResponse.Error != nil {
 			return "", agentResponse.Error
 		}
 
 		// add the agent response to the memory
-		t.memory.AddTeamMemberInteractions(ctx, agent.Name, task, agentResponse)
+		t.memory.AddTeamMemberInteractions(ctx, memberID, task, agentResponse)
 		// log.InfoContextf(ctx, "agent %s completed with response: %s", agent.Name, agentResponse.Answer)
 		return agentResponse.Completion(), nil
 	}
@@ -261,22 +271,15 @@ func (t *Team) distributeTask() string {
 		// find the agent
 		agentName := params.AgentName
 
-		var agent *Agent
-		for _, a := range t.members {
-			if a.Name == agentName {
-				agent = a
-				break
-			}
-		}
-		if agent == nil {
+		member := t.member(agentName)
+		if member == nil {
 			return "", fmt.Errorf("agent not found")
 		}
 		// run the agent
-		response := agent.Invoke(ctx, params.ExpectedOutput)
+		response := t.runMember(ctx, member, params.ExpectedOutput)
 		if response.Error != nil {
 			return "", response.Error
 		}
-		t.response.AddMemberResponse(response)
 		return "", nil
 	}
 	tl := &tool.Tool{}
@@ -308,10 +311,11 @@ func (t *Team) renderName() string {
 	return "Your Name is " + t.Name
 }
 
-func (t *Team) renderAgents(members []*Agent) string {
+func (t *Team) renderAgents(members []Runnable) string {
 	builder := strings.Builder{}
 	builder.WriteString("<team_members>\n")
-	for idx, member := range members {
+	for idx, runnable := range members {
+		member := runnable.Profile()
 		builder.WriteString(fmt.Sprintf("- Agent %d:\n", idx+1))
 		builder.WriteString(fmt.Sprintf("\t- Name: %s\n", member.Name))
 		builder.WriteString(fmt.Sprintf("\t- Description: %s\n", member.Description))
@@ -354,20 +358,22 @@ Here are the agents in your team:
 var collaboratePrompt = `
 You are the leader of a team and sub-teams of AI Agents.
 
-Your task is to coordinate the team to complete the user's request.
+All the agents in your team have collaborated on the user's request, their contributions are given in <member_interactions> after the request.
 
 Here are the agents in your team:
 {{agents}}
 
 <how_to_respond>
-- Only call run_member_agent once for all agents in the team.
-- Take all the responses from the other Agents into account and evaluate whether the task has been completed.
-- If you feel the task has been completed, you can stop and respond to the user.
+- Take all the responses from the other Agents into account, weigh where they agree and disagree.
+- Synthesize a single consensus answer to the user's request, resolve the disagreements with your best judgement.
+- Respond to the user directly.
 </how_to_respond>
 
 {{name}}
 
 {{description}}
+
+{{instructions}}
 `
 
 var routePrompt = `
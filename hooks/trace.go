@@ -0,0 +1,61 @@
+package hooks
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/showntop/llmack/opentelemetry"
+
+// tracer of global provider, spans nest under the span in context, e.g. agent > tool > llm
+func tracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(instrumentationName)
+}
+
+// StartAgentSpan starts the span of an agent or team run
+func StartAgentSpan(ctx context.Context, id, name string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "invoke_agent "+name, trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("gen_ai.operation.name", "invoke_agent"),
+			attribute.String("gen_ai.agent.id", id),
+			attribute.String("gen_ai.agent.name", name),
+		))
+}
+
+// StartToolSpan starts the span of a tool execution
+func StartToolSpan(ctx context.Context, name, callID string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "execute_tool "+name, trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("gen_ai.operation.name", "execute_tool"),
+			attribute.String("gen_ai.tool.name", name),
+			attribute.String("gen_ai.tool.call.id", callID),
+		))
+}
+
+// StartWorkflowSpan starts the span of a workflow run
+func StartWorkflowSpan(ctx context.Context, id string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "workflow "+id, trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("workflow.id", id)))
+}
+
+// StartNodeSpan starts the span of a workflow node run
+func StartNodeSpan(ctx context.Context, id, kind string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "workflow.node "+kind, trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("workflow.node.id", id),
+			attribute.String("workflow.node.kind", kind),
+		))
+}
+
+// EndSpan records err if any and ends the span
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
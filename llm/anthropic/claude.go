@@ -1,29 +1,45 @@
 package anthropic
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/log"
 )
 
 // Name ...
 var Name = "anthropic"
 
+// Version anthropic-version header
+var Version = "2023-06-01"
+
+const defaultMaxTokens = 4096
+
 func init() {
 	llm.Register(Name, NewLLM)
 }
 
-// LLM ...
+// LLM native anthropic messages api
 type LLM struct {
-	once   sync.Once
-	engine *llm.OAILLM
+	once    sync.Once
+	options *llm.ProviderOptions
+	baseURL string
+	apiKey  string
+	client  *http.Client
 }
 
 // NewLLM ...
 func NewLLM(options *llm.ProviderOptions) llm.Provider {
-	return &LLM{}
+	return &LLM{options: options, client: http.DefaultClient}
 }
 
 // Name ...
@@ -33,22 +49,234 @@ func (m *LLM) Name() string {
 
 // Invoke ...
 func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	if err := m.setup(); err != nil {
+		return nil, err
+	}
+	if opts.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	payload, err := json.Marshal(buildRequest(messages, opts))
+	if err != nil {
+		return nil, fmt.Errorf("marshal anthropic messages request error: %w", err)
+	}
+	log.DebugContextf(ctx, "anthropic messages request payload %s", string(payload))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("anthropic messages new request error: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("x-api-key", m.apiKey)
+	req.Header.Set("anthropic-version", Version)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic messages request error: %w", llm.NewTransportError(err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("anthropic messages request statuserror: %w", llm.NewStatusError(resp.StatusCode, resp.Header, string(raw)))
+	}
+	return handleStream(ctx, resp.Body), nil
+}
+
+func (m *LLM) setup() error {
 	var err error
 	m.once.Do(func() {
-		url := "https://api.anthropic.com/v1/messages"
+		m.baseURL = "https://api.anthropic.com"
+		if m.options != nil {
+			m.apiKey = m.options.ApiKey
+			if m.options.BaseURL != "" {
+				m.baseURL = m.options.BaseURL
+			}
+		}
+		if m.apiKey != "" {
+			m.baseURL = strings.TrimSuffix(m.baseURL, "/")
+			return
+		}
 		config, _ := llm.Config.Get(Name).(map[string]any)
 		if config == nil {
-			err = fmt.Errorf("claude config not found")
+			err = fmt.Errorf("anthropic config not found")
+			return
 		}
-		apiKey, _ := config["api_key"].(string)
-		baseURL, _ := config["base_url"].(string)
-		if baseURL != "" {
-			url = baseURL + "/chat/completions"
+		m.apiKey, _ = config["api_key"].(string)
+		if baseURL, _ := config["base_url"].(string); baseURL != "" {
+			m.baseURL = baseURL
 		}
-		m.engine = llm.NewOAILLM(url, apiKey)
+		m.baseURL = strings.TrimSuffix(m.baseURL, "/")
 	})
-	if err != nil {
-		return nil, err
+	return err
+}
+
+// streamEvent data of anthropic sse event
+type streamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		Model string `json:"model"`
+		Usage usage  `json:"usage"`
+	} `json:"message"`
+	ContentBlock struct {
+		Type     string `json:"type"`
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Text     string `json:"text"`
+		Thinking string `json:"thinking"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage usage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+var stopReasons = map[string]string{
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"max_tokens":    "length",
+	"tool_use":      "tool_calls",
+	"refusal":       "content_filter",
+}
+
+// errorStatus the http status of anthropic error types, see https://docs.anthropic.com/en/api/errors
+var errorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      529,
+}
+
+// streamError classifies the error event of stream as the http error of the same type
+func streamError(errorType string, message string) *llm.ProviderError {
+	e := llm.NewStatusError(errorStatus[errorType], nil, message)
+	if e.Kind == nil && errorStatus[errorType] == 0 {
+		e.Kind = llm.ErrTransient // unknown error types in the middle of stream
 	}
-	return m.engine.Invoke(ctx, messages, opts)
+	e.Message = errorType + ": " + message
+	return e
+}
+
+// handleStream 将 anthropic sse 事件转换为 llm.Chunk
+func handleStream(ctx context.Context, body io.ReadCloser) *llm.Response {
+	response := llm.NewStreamResponse()
+	go func() {
+		defer body.Close()
+		defer response.Stream().Close()
+
+		var model string
+		toolIndex := -1
+		blockTools := map[int]int{} // content block index => tool call index
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if !bytes.HasPrefix(line, []byte("data:")) {
+				continue
+			}
+			var event streamEvent
+			if err := json.Unmarshal(bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:"))), &event); err != nil {
+				log.ErrorContextf(ctx, "anthropic stream unmarshal event error %s", err)
+				continue
+			}
+			var chunk *llm.Chunk
+			switch event.Type {
+			case "message_start":
+				model = event.Message.Model
+				u := event.Message.Usage
+				prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+				chunk = &llm.Chunk{Usage: &llm.Usage{
+					PromptTokens:     prompt,
+					TotalTokens:      prompt,
+					CacheReadTokens:  u.CacheReadInputTokens,
+					CacheWriteTokens: u.CacheCreationInputTokens,
+				}}
+			case "content_block_start":
+				switch event.ContentBlock.Type {
+				case "tool_use":
+					toolIndex++
+					blockTools[event.Index] = toolIndex
+					msg := llm.NewAssistantMessage("")
+					msg.ToolCalls = []*llm.ToolCall{{
+						ID:       event.ContentBlock.ID,
+						Type:     "function",
+						Index:    toolIndex,
+						Function: llm.ToolCallFunction{Name: event.ContentBlock.Name},
+					}}
+					chunk = llm.NewChunk(0, msg, nil)
+				case "text":
+					if event.ContentBlock.Text != "" {
+						chunk = llm.NewChunk(0, llm.NewAssistantMessage(event.ContentBlock.Text), nil)
+					}
+				case "thinking":
+					if event.ContentBlock.Thinking != "" {
+						chunk = llm.NewChunk(0, llm.NewAssistantReasoningMessage(event.ContentBlock.Thinking), nil)
+					}
+				}
+			case "content_block_delta":
+				switch event.Delta.Type {
+				case "text_delta":
+					chunk = llm.NewChunk(0, llm.NewAssistantMessage(event.Delta.Text), nil)
+				case "thinking_delta":
+					chunk = llm.NewChunk(0, llm.NewAssistantReasoningMessage(event.Delta.Thinking), nil)
+				case "signature_delta":
+					msg := llm.NewAssistantMessage("")
+					msg.ReasoningSignature = event.Delta.Signature
+					chunk = llm.NewChunk(0, msg, nil)
+				case "input_json_delta":
+					msg := llm.NewAssistantMessage("")
+					msg.ToolCalls = []*llm.ToolCall{{
+						Index:    blockTools[event.Index],
+						Function: llm.ToolCallFunction{Arguments: event.Delta.PartialJSON},
+					}}
+					chunk = llm.NewChunk(0, msg, nil)
+				}
+			case "message_delta":
+				chunk = llm.NewChunk(0, llm.NewAssistantMessage(""), &llm.Usage{
+					CompletionTokens: event.Usage.OutputTokens,
+					TotalTokens:      event.Usage.OutputTokens,
+				})
+				chunk.Choices[0].FinishReason = stopReasons[event.Delta.StopReason]
+				if chunk.Choices[0].FinishReason == "" {
+					chunk.Choices[0].FinishReason = event.Delta.StopReason
+				}
+			case "error": // the last event, sent to the caller as a typed error
+				log.ErrorContextf(ctx, "anthropic stream error %s: %s", event.Error.Type, event.Error.Message)
+				chunk = llm.NewErrorChunk(streamError(event.Error.Type, event.Error.Message))
+				chunk.Model = model
+				response.Stream().Push(chunk)
+				return
+			case "message_stop":
+				return
+			}
+			if chunk == nil {
+				continue
+			}
+			chunk.Model = model
+			response.Stream().Push(chunk)
+		}
+		if err := scanner.Err(); err != nil {
+			log.ErrorContextf(ctx, "anthropic stream read error %s", err)
+		}
+	}()
+	return response
 }
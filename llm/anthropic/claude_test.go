@@ -0,0 +1,148 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+const stubStream = `event: message_start
+data: {"type":"message_start","message":{"model":"claude-sonnet-4","usage":{"input_tokens":12,"cache_creation_input_tokens":100,"cache_read_input_tokens":200,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"need weather"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Let me check."}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":" \"Paris\"}"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":30}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+func TestLLM_Invoke(t *testing.T) {
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "key", r.Header.Get("x-api-key"))
+		assert.Equal(t, Version, r.Header.Get("anthropic-version"))
+		raw, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(raw, &request))
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, stubStream)
+	}))
+	defer server.Close()
+
+	assistant := llm.NewAssistantMessage("").WithReasoningContent("thinking").WithToolCalls([]*llm.ToolCall{
+		{ID: "toolu_0", Function: llm.ToolCallFunction{Name: "weather", Arguments: `{"city":"Rome"}`}},
+	})
+	assistant.ReasoningSignature = "sig0"
+	messages := []llm.Message{
+		llm.MarkCache(llm.NewSystemMessage("be helpful")),
+		llm.NewUserMultipartMessage(
+			llm.MultipartContentText("weather here?"),
+			llm.MultipartContentImageBase64("png", []byte("img")),
+		),
+		assistant,
+		llm.NewToolMessage("sunny", "toolu_0"),
+		llm.NewUserTextMessage("and Paris?"),
+	}
+	provider := NewLLM(&llm.ProviderOptions{BaseURL: server.URL, ApiKey: "key"})
+	response, err := provider.Invoke(context.Background(), messages, &llm.InvokeOptions{
+		Model: "claude-sonnet-4",
+		Tools: []*llm.Tool{{Type: "function", Function: &llm.FunctionDefinition{Name: "weather", Parameters: map[string]any{"type": "object"}}}},
+	})
+	assert.NoError(t, err)
+	result := response.Result()
+
+	// request mapping
+	assert.Equal(t, "be helpful", request["system"].([]any)[0].(map[string]any)["text"])
+	assert.Equal(t, map[string]any{"type": "ephemeral"}, request["system"].([]any)[0].(map[string]any)["cache_control"])
+	chat := request["messages"].([]any)
+	assert.Len(t, chat, 3) // tool result merged with the following user turn
+	image := chat[0].(map[string]any)["content"].([]any)[1].(map[string]any)
+	assert.Equal(t, "image/png", image["source"].(map[string]any)["media_type"])
+	blocks := chat[1].(map[string]any)["content"].([]any)
+	assert.Equal(t, "thinking", blocks[0].(map[string]any)["type"])
+	assert.Equal(t, map[string]any{"city": "Rome"}, blocks[1].(map[string]any)["input"])
+	last := chat[2].(map[string]any)["content"].([]any)
+	assert.Equal(t, "tool_result", last[0].(map[string]any)["type"])
+	assert.Equal(t, "weather", request["tools"].([]any)[0].(map[string]any)["name"])
+
+	// stream mapping
+	assert.Equal(t, "Let me check.", result.Message.Content())
+	assert.Equal(t, "need weather", result.Message.ReasoningContent)
+	assert.Equal(t, "sig", result.Message.ReasoningSignature)
+	assert.Len(t, result.Message.ToolCalls, 1)
+	assert.Equal(t, "toolu_1", result.Message.ToolCalls[0].ID)
+	assert.Equal(t, `{"city": "Paris"}`, result.Message.ToolCalls[0].Function.Arguments)
+	assert.Equal(t, llm.Usage{PromptTokens: 312, CompletionTokens: 30, TotalTokens: 342, CacheReadTokens: 200, CacheWriteTokens: 100}, result.Usage)
+}
+
+func TestLLM_StatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		io.WriteString(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	}))
+	defer server.Close()
+	provider := NewLLM(&llm.ProviderOptions{BaseURL: server.URL, ApiKey: "key"})
+	_, err := provider.Invoke(context.Background(), []llm.Message{llm.NewUserTextMessage("hi")}, &llm.InvokeOptions{Model: "claude-sonnet-4"})
+	assert.ErrorIs(t, err, llm.ErrTransient)
+}
+
+func TestLLM_StreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}
+
+event: error
+data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}
+
+`)
+	}))
+	defer server.Close()
+	provider := NewLLM(&llm.ProviderOptions{BaseURL: server.URL, ApiKey: "key"})
+	response, err := provider.Invoke(context.Background(), []llm.Message{llm.NewUserTextMessage("hi")}, &llm.InvokeOptions{Model: "claude-sonnet-4"})
+	assert.NoError(t, err)
+
+	var events []*llm.StreamEvent
+	for event := range response.Stream().Events() {
+		events = append(events, event)
+	}
+	assert.Equal(t, llm.StreamEventTextDelta, events[0].Type)
+	assert.Equal(t, llm.StreamEventError, events[1].Type)
+	assert.ErrorIs(t, events[1].Err, llm.ErrTransient)
+	assert.ErrorContains(t, events[1].Err, "overloaded_error: Overloaded")
+	assert.Equal(t, llm.FinishReasonError, events[len(events)-1].FinishReason)
+
+	assert.ErrorIs(t, streamError("rate_limit_error", "slow down"), llm.ErrRateLimited)
+	assert.ErrorIs(t, streamError("invalid_request_error", "prompt is too long"), llm.ErrContextOverflow)
+}
@@ -0,0 +1,201 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/showntop/llmack/llm"
+)
+
+// contentBlock anthropic content block
+type contentBlock map[string]any
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+// buildRequest maps llm messages and options to anthropic messages request
+func buildRequest(messages []llm.Message, opts *llm.InvokeOptions) map[string]any {
+	request := map[string]any{
+		"model":      opts.Model,
+		"max_tokens": opts.MaxTokens,
+		"stream":     true,
+	}
+	if opts.MaxTokens <= 0 {
+		request["max_tokens"] = defaultMaxTokens
+	}
+	if opts.Temperature > 0 {
+		request["temperature"] = opts.Temperature
+	}
+	if opts.TopP > 0 {
+		request["top_p"] = opts.TopP
+	}
+	if opts.TopK > 0 {
+		request["top_k"] = opts.TopK
+	}
+	if stops := append(append([]string{}, opts.Stop...), opts.StopWords...); len(stops) > 0 {
+		request["stop_sequences"] = stops
+	}
+
+	system := []contentBlock{}
+	chat := []*message{}
+	for _, m := range messages {
+		if m.Role() == llm.MessageRoleSystem {
+			if m.Content() != "" {
+				system = append(system, contentBlock{"type": "text", "text": m.Content()})
+				if cc := llm.CacheControlOf(m); cc != nil {
+					system[len(system)-1]["cache_control"] = cc
+				}
+			}
+			continue
+		}
+		role, blocks := buildContent(m)
+		if len(blocks) <= 0 {
+			continue
+		}
+		if cc := llm.CacheControlOf(m); cc != nil { // breakpoint at the end of message
+			blocks[len(blocks)-1]["cache_control"] = cc
+		}
+		if n := len(chat); n > 0 && chat[n-1].Role == role { // merge consecutive turns, e.g. tool results
+			chat[n-1].Content = append(chat[n-1].Content, blocks...)
+			continue
+		}
+		chat = append(chat, &message{Role: role, Content: blocks})
+	}
+	if len(system) > 0 {
+		request["system"] = system
+	}
+	request["messages"] = chat
+
+	if len(opts.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(opts.Tools))
+		for _, t := range opts.Tools {
+			if t.Function == nil {
+				continue
+			}
+			schema := t.Function.Parameters
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			tools = append(tools, map[string]any{
+				"name":         t.Function.Name,
+				"description":  t.Function.Description,
+				"input_schema": schema,
+			})
+		}
+		request["tools"] = tools
+		if choice := buildToolChoice(opts.ToolChoice); choice != nil {
+			request["tool_choice"] = choice
+		}
+	}
+	for k, v := range opts.Metadata { // e.g. thinking, metadata
+		request[k] = v
+	}
+	return request
+}
+
+func buildContent(m llm.Message) (string, []contentBlock) {
+	switch m.Role() {
+	case llm.MessageRoleTool:
+		return "user", []contentBlock{{
+			"type":        "tool_result",
+			"tool_use_id": m.ToolID(),
+			"content":     m.Content(),
+		}}
+	case llm.MessageRoleAssistant:
+		blocks := []contentBlock{}
+		if am, ok := m.(*llm.AssistantMessage); ok && am.ReasoningContent != "" && am.ReasoningSignature != "" {
+			blocks = append(blocks, contentBlock{"type": "thinking", "thinking": am.ReasoningContent, "signature": am.ReasoningSignature})
+		}
+		if m.Content() != "" {
+			blocks = append(blocks, contentBlock{"type": "text", "text": m.Content()})
+		}
+		for _, call := range m.GetToolCalls() {
+			input := json.RawMessage(call.Function.Arguments)
+			if !json.Valid(input) {
+				input = json.RawMessage("{}")
+			}
+			blocks = append(blocks, contentBlock{"type": "tool_use", "id": call.ID, "name": call.Function.Name, "input": input})
+		}
+		return "assistant", blocks
+	default:
+		blocks := []contentBlock{}
+		if m.Content() != "" {
+			blocks = append(blocks, contentBlock{"type": "text", "text": m.Content()})
+		}
+		for _, part := range m.MultipartContent() {
+			if block := buildPart(part); block != nil {
+				if part.Cache != nil {
+					block["cache_control"] = part.Cache
+				}
+				blocks = append(blocks, block)
+			}
+		}
+		return "user", blocks
+	}
+}
+
+// buildPart maps multipart content, image_url of data url or http url to image block
+func buildPart(part *llm.MultipartContent) contentBlock {
+	if part == nil {
+		return nil
+	}
+	switch part.Type {
+	case "text":
+		text, _ := part.Data.(string)
+		return contentBlock{"type": "text", "text": text}
+	case "image_url":
+		var url string
+		switch data := part.Data.(type) {
+		case map[string]any:
+			url, _ = data["url"].(string)
+		case string:
+			url = data
+		}
+		if url == "" {
+			return nil
+		}
+		if strings.HasPrefix(url, "data:") { // data:image/png;base64,xxx
+			header, data, _ := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+			return contentBlock{"type": "image", "source": map[string]any{
+				"type":       "base64",
+				"media_type": strings.TrimSuffix(header, ";base64"),
+				"data":       data,
+			}}
+		}
+		return contentBlock{"type": "image", "source": map[string]any{"type": "url", "url": url}}
+	default:
+		if block, ok := part.Data.(map[string]any); ok { // custom anthropic block, e.g. document
+			return block
+		}
+		return nil
+	}
+}
+
+func buildToolChoice(choice any) any {
+	switch c := choice.(type) {
+	case nil:
+		return nil
+	case string:
+		switch c {
+		case "auto", "":
+			return map[string]any{"type": "auto"}
+		case "none":
+			return map[string]any{"type": "none"}
+		case "required", "any":
+			return map[string]any{"type": "any"}
+		default: // tool name
+			return map[string]any{"type": "tool", "name": c}
+		}
+	case *llm.ToolChoice:
+		if c.Function != nil {
+			return map[string]any{"type": "tool", "name": c.Function.Name}
+		}
+		return map[string]any{"type": "any"}
+	case llm.ToolChoice:
+		return buildToolChoice(&c)
+	default:
+		return c
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
@@ -71,7 +72,7 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 		// Tools:    toolsOpenAI,
 	}, nil)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("azure-openai chat completions request error: %w", providerError(err))
 	}
 
 	response := llm.NewStreamResponse()
@@ -87,8 +88,8 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 			}
 
 			if err != nil {
-				//  TODO: Update the following line with your application specific error handling logic
-				log.Printf("ERROR: %s", err)
+				log.Printf("ERROR: azure-openai chat completions stream error: %s", err)
+				response.Stream().Push(llm.NewErrorChunk(providerError(err)))
 				return
 			}
 
@@ -113,6 +114,19 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 	return response, nil
 }
 
+// providerError classifies the response error by status, others are transport errors
+func providerError(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return llm.NewTransportError(err)
+	}
+	var header http.Header
+	if respErr.RawResponse != nil {
+		header = respErr.RawResponse.Header
+	}
+	return llm.NewStatusError(respErr.StatusCode, header, respErr.Error()) // the message carries the error code, e.g. content_filter
+}
+
 func (m *LLM) setupClient() error {
 	config, _ := llm.Config.Get(Name).(map[string]any)
 	if config == nil {
@@ -2,20 +2,28 @@ package llm
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"math"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/pgvector/pgvector-go"
 	"github.com/showntop/llmack/embedding"
 	"github.com/showntop/llmack/vdb"
 )
 
 // CachedDocument ...
 type CachedDocument struct {
-	ID     string
-	Query  string
-	Answer string
-	Score  float64
-	Vector []float32
+	ID        string    `json:"id"`
+	Namespace string    `json:"namespace"`
+	Query     string    `json:"query"`
+	Answer    string    `json:"answer"`
+	Score     float64   `json:"score"`
+	Vector    []float32 `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // CacheFactory ...
@@ -27,12 +35,13 @@ type Cache interface {
 	Store(context.Context, *CachedDocument, string) error
 }
 
-// BaseCache ...
+// BaseCache 语义缓存的公共部分：query 处理、向量化、向量检索、重排
 type BaseCache struct {
 	Config      *CacheConfig
-	Embedder    embedding.Embedder
+	Embedder    embedding.Embedder // must be the same model as the embedder of VectorStore
 	VectorStore vdb.VDB
-	Ranker      Scorer
+	Ranker      Scorer // re-rank candidates, vector similarity if nil
+	Metrics     *Metrics
 }
 
 // SetQueryProcessor ...
@@ -42,24 +51,224 @@ func (c *BaseCache) SetQueryProcessor(p QueryProcessor) {
 
 // CacheConfig 定义缓存的配置选项
 type CacheConfig struct {
-	TTL             time.Duration
-	MaxEntries      int
-	CleanupInterval time.Duration
-	EnableMetrics   bool
-	QueryProcessor  QueryProcessor
+	TTL                 time.Duration
+	MaxEntries          int
+	CleanupInterval     time.Duration
+	EnableMetrics       bool
+	QueryProcessor      QueryProcessor
+	TopK                int     // candidates searched from vector store
+	SimilarityThreshold float64 // min vector similarity of candidates
+	ScoreThreshold      float64 // min score of Ranker to hit
 }
 
 // DefaultConfig 返回默认配置
 func DefaultConfig() *CacheConfig {
 	return &CacheConfig{
-		TTL:             5 * time.Minute,
-		MaxEntries:      1000,
-		CleanupInterval: 1 * time.Minute,
-		EnableMetrics:   true,
-		QueryProcessor:  LastQueryMessage,
+		TTL:                 5 * time.Minute,
+		MaxEntries:          1000,
+		CleanupInterval:     1 * time.Minute,
+		EnableMetrics:       true,
+		QueryProcessor:      LastQueryMessage,
+		TopK:                5,
+		SimilarityThreshold: 0.9,
+		ScoreThreshold:      0.8,
 	}
 }
 
+// CacheOption ...
+type CacheOption func(*BaseCache)
+
+// WithCacheConfig ...
+func WithCacheConfig(config *CacheConfig) CacheOption {
+	return func(c *BaseCache) {
+		c.Config = config
+	}
+}
+
+// WithCacheEmbedder ...
+func WithCacheEmbedder(embedder embedding.Embedder) CacheOption {
+	return func(c *BaseCache) {
+		c.Embedder = embedder
+	}
+}
+
+// WithCacheVectorStore ...
+func WithCacheVectorStore(store vdb.VDB) CacheOption {
+	return func(c *BaseCache) {
+		c.VectorStore = store
+	}
+}
+
+// WithCacheScorer ...
+func WithCacheScorer(scorer Scorer) CacheOption {
+	return func(c *BaseCache) {
+		c.Ranker = scorer
+	}
+}
+
+func (c *BaseCache) apply(opts ...CacheOption) {
+	for _, o := range opts {
+		o(c)
+	}
+	if c.Config == nil {
+		c.Config = DefaultConfig()
+	}
+	if c.Config.QueryProcessor == nil {
+		c.Config.QueryProcessor = LastQueryMessage
+	}
+	if c.Config.TopK <= 0 {
+		c.Config.TopK = 5
+	}
+	if c.Config.EnableMetrics && c.Metrics == nil {
+		c.Metrics = &Metrics{}
+	}
+}
+
+// candidate a cached entry found by vector search
+type candidate struct {
+	id         string
+	similarity float64
+}
+
+// search embeds the query and searches candidates of the namespace in context,
+// returns the document to store on miss and candidates ordered by similarity.
+func (c *BaseCache) search(ctx context.Context, messages []Message) (*CachedDocument, []candidate, error) {
+	query, err := c.Config.QueryProcessor(messages)
+	if err != nil {
+		return nil, nil, err
+	}
+	vector, err := c.Embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	document := &CachedDocument{Namespace: CacheNamespaceFrom(ctx), Query: query, Vector: vector}
+	relations, err := c.VectorStore.Search(ctx, vector,
+		vdb.WithTopk(c.Config.TopK), vdb.WithThreshold(c.Config.SimilarityThreshold),
+		vdb.WithFilter(vdb.Eq(cacheNamespaceField, document.Namespace))) // other namespaces never take the topk slots
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix := namespacePrefix(document.Namespace)
+	distance := vdb.IsDistance(c.VectorStore)
+	candidates := make([]candidate, 0, len(relations))
+	for _, relation := range relations {
+		if !strings.HasPrefix(relation.ID, prefix) { // answers never leak across namespaces, even if the store ignores filter
+			continue
+		}
+		similarity := float64(relation.Similarity)
+		if embedding := relation.Embedding.Slice(); len(embedding) == len(vector) {
+			similarity = cosine(vector, embedding) // the same measure for any store
+		} else if distance {
+			similarity = 1 - similarity // cosine distance, e.g. redis
+		}
+		if similarity < c.Config.SimilarityThreshold {
+			continue
+		}
+		candidates = append(candidates, candidate{id: relation.ID, similarity: similarity})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].similarity > candidates[j].similarity
+	})
+	return document, candidates, nil
+}
+
+// rank scores the loaded candidates with Ranker, returns the best one above threshold
+func (c *BaseCache) rank(query string, documents []*CachedDocument) (*CachedDocument, bool) {
+	var best *CachedDocument
+	for _, document := range documents {
+		if c.Ranker != nil {
+			document.Score = c.Ranker.Eval(query, document)
+		}
+		if best == nil || document.Score > best.Score {
+			best = document
+		}
+	}
+	threshold := c.Config.SimilarityThreshold
+	if c.Ranker != nil {
+		threshold = c.Config.ScoreThreshold
+	}
+	if best == nil || best.Score < threshold {
+		return nil, false
+	}
+	return best, true
+}
+
+// index stores the vector of document to vector store
+func (c *BaseCache) index(ctx context.Context, document *CachedDocument) error {
+	return c.VectorStore.Store(ctx, &vdb.Document{
+		ID:        document.ID,
+		Title:     document.Namespace,
+		Content:   document.Query,
+		Embedding: pgvector.NewVector(document.Vector),
+		Metadata:  map[string]any{"source": "llm_cache", cacheNamespaceField: document.Namespace},
+		CreatedAt: document.CreatedAt,
+		UpdatedAt: document.CreatedAt,
+	})
+}
+
+func (c *BaseCache) expired(document *CachedDocument, now time.Time) bool {
+	return c.Config.TTL > 0 && now.Sub(document.CreatedAt) > c.Config.TTL
+}
+
+func (c *BaseCache) recordHit(hit bool) {
+	if c.Metrics == nil {
+		return
+	}
+	if hit {
+		c.Metrics.recordHit()
+	} else {
+		c.Metrics.recordMiss()
+	}
+}
+
+type cacheNamespaceKey struct{}
+
+// cacheNamespaceField metadata field of the namespace in vector store
+const cacheNamespaceField = "namespace"
+
+// WithCacheNamespace isolates cached answers, e.g. per agent
+func WithCacheNamespace(ctx context.Context, namespace string) context.Context {
+	if parent := CacheNamespaceFrom(ctx); parent != "" {
+		namespace = parent + "/" + namespace
+	}
+	return context.WithValue(ctx, cacheNamespaceKey{}, namespace)
+}
+
+// CacheNamespaceFrom ...
+func CacheNamespaceFrom(ctx context.Context) string {
+	namespace, _ := ctx.Value(cacheNamespaceKey{}).(string)
+	return namespace
+}
+
+// cacheNamespace of provider, model and system prompt
+func cacheNamespace(provider, model string, messages []Message) string {
+	hash := sha256.New()
+	for _, m := range messages {
+		if m.Role() == MessageRoleSystem {
+			hash.Write([]byte(m.Content()))
+			hash.Write([]byte{0})
+		}
+	}
+	return provider + "/" + model + "/" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+func namespacePrefix(namespace string) string {
+	return namespace + "#"
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
 // 添加自定义错误类型
 var (
 	ErrCacheMiss = errors.New("cache miss")
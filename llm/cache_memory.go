@@ -1,97 +1,152 @@
 package llm
 
 import (
+	"container/list"
 	"context"
-	"sort"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/showntop/llmack/embedding"
-	"github.com/showntop/llmack/vdb"
+	"github.com/showntop/llmack/log"
 	"github.com/showntop/llmack/vdb/memo"
 )
 
-// MemoCache ...
+// MemoCache 答案保存在内存中，按 TTL 过期、按 LRU 淘汰，向量保存在 VectorStore
 type MemoCache struct {
 	BaseCache
 
-	documentTable map[string]*CachedDocument
+	mu            sync.Mutex
+	documentTable map[string]*list.Element // id => element of lru, value *CachedDocument
+	lru           *list.List               // front is the most recently used
+	lastCleanup   time.Time
 }
 
 // NewMemoCache ...
-func NewMemoCache() Cache {
-	return &MemoCache{
+func NewMemoCache(opts ...CacheOption) Cache {
+	c := &MemoCache{
 		BaseCache: BaseCache{
 			Config:      DefaultConfig(),
 			Embedder:    embedding.NewStringEmbedder(),
 			VectorStore: memo.New(),
 		},
-		documentTable: make(map[string]*CachedDocument),
+		documentTable: make(map[string]*list.Element),
+		lru:           list.New(),
+		lastCleanup:   time.Now(),
 	}
+	c.apply(opts...)
+	return c
 }
 
 // Fetch ...
 func (m *MemoCache) Fetch(ctx context.Context, messages []Message) (*CachedDocument, bool, error) {
-	// 处理query
-	query, err := m.Config.QueryProcessor(messages)
+	m.cleanup(ctx)
+	document, candidates, err := m.search(ctx, messages)
 	if err != nil {
 		return nil, false, err
 	}
-	// embedding vector
-	vector, err := m.Embedder.Embed(ctx, query)
-	if err != nil {
-		return nil, false, err
+
+	now := time.Now()
+	documents := make([]*CachedDocument, 0, len(candidates))
+	m.mu.Lock()
+	for _, candidate := range candidates {
+		element, ok := m.documentTable[candidate.id]
+		if !ok {
+			continue
+		}
+		cached := element.Value.(*CachedDocument)
+		if m.expired(cached, now) {
+			continue
+		}
+		hit := *cached
+		hit.Score = candidate.similarity
+		documents = append(documents, &hit)
 	}
-	// search vector ids
-	relations, err := m.VectorStore.Search(ctx, vector, vdb.WithTopk(5))
-	if err != nil {
-		return nil, false, err
+	m.mu.Unlock()
+
+	best, ok := m.rank(document.Query, documents)
+	m.recordHit(ok)
+	if !ok {
+		return document, false, nil
 	}
-	if relations == nil || len(relations) == 0 {
-		return &CachedDocument{Query: query, Vector: vector}, false, nil
+	m.mu.Lock()
+	if element, ok := m.documentTable[best.ID]; ok {
+		m.lru.MoveToFront(element)
 	}
-	// object data
-	documents := make([]*CachedDocument, 0, len(relations))
-	for _, dc := range relations {
-		document := m.documentTable[dc.ID]
-		document.Query = query
-		document.Vector = vector
-		documents = append(documents, document)
+	m.mu.Unlock()
+	return best, true, nil
+}
+
+// Store ...
+func (m *MemoCache) Store(ctx context.Context, document *CachedDocument, value string) error {
+	if document == nil || value == "" {
+		return nil
 	}
-	if len(documents) == 0 {
-		return nil, false, nil
+	document.ID = namespacePrefix(document.Namespace) + uuid.NewString()
+	document.Answer = value
+	document.CreatedAt = time.Now()
+	if err := m.index(ctx, document); err != nil {
+		return err
 	}
 
-	// 1. score
-	sort.Slice(documents, func(i, j int) bool {
-		return documents[i].Score > documents[j].Score
-	})
-	// 2. rank Temperature Softmax / sort
+	m.mu.Lock()
+	m.documentTable[document.ID] = m.lru.PushFront(document)
+	evicted := []string{}
+	for m.Config.MaxEntries > 0 && m.lru.Len() > m.Config.MaxEntries { // LRU 淘汰
+		evicted = append(evicted, m.remove(m.lru.Back()))
+	}
+	m.mu.Unlock()
+	if m.Metrics != nil {
+		m.Metrics.recordAdd()
+	}
+	return m.deleteVectors(ctx, evicted)
+}
 
-	document := documents[0]
+// Len returns the number of cached entries
+func (m *MemoCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
 
-	// threshold
-	const similarityThreshold = 0.8
-	if document.Score < similarityThreshold {
-		return &CachedDocument{Query: query, Vector: vector}, false, nil
+// cleanup removes expired entries every CleanupInterval
+func (m *MemoCache) cleanup(ctx context.Context) {
+	now := time.Now()
+	m.mu.Lock()
+	if m.Config.TTL <= 0 || now.Sub(m.lastCleanup) < m.Config.CleanupInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.lastCleanup = now
+	expired := []string{}
+	for element := m.lru.Back(); element != nil; {
+		prev := element.Prev()
+		if m.expired(element.Value.(*CachedDocument), now) {
+			expired = append(expired, m.remove(element))
+		}
+		element = prev
+	}
+	m.mu.Unlock()
+	if err := m.deleteVectors(ctx, expired); err != nil {
+		log.WarnContextf(ctx, "llm cache cleanup delete vectors error: %v", err)
 	}
-
-	return document, true, nil
 }
 
-// Store ...
-func (m *MemoCache) Store(ctx context.Context, document *CachedDocument, value string) error {
-	// 检查容量限制
-	if len(m.documentTable) >= m.Config.MaxEntries {
-		// 可以实现 LRU 或其他淘汰策略
+// remove must be called with lock held
+func (m *MemoCache) remove(element *list.Element) string {
+	document := m.lru.Remove(element).(*CachedDocument)
+	delete(m.documentTable, document.ID)
+	if m.Metrics != nil {
+		m.Metrics.recordEvict()
 	}
+	return document.ID
+}
 
-	document.ID = uuid.NewString()
-	document.Answer = value
-	// document.CreatedAt = time.Now()
-	// document.UpdatedAt = time.Now()
-	// if err := m.VectorStore.Store(ctx, document.ID, document.Vector); err != nil {
-	// 	return err
-	// }
-	m.documentTable[document.ID] = document
+func (m *MemoCache) deleteVectors(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		if err := m.VectorStore.Delete(ctx, id); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -11,21 +11,28 @@ type Metrics struct {
 	misses     uint64
 	adds       uint64
 	evicts     uint64
-	lastAccess time.Time
+	lastAccess atomic.Int64
 }
 
-func (m *Metrics) recordHit()   { atomic.AddUint64(&m.hits, 1) }
-func (m *Metrics) recordMiss()  { atomic.AddUint64(&m.misses, 1) }
+func (m *Metrics) recordHit()   { atomic.AddUint64(&m.hits, 1); m.touch() }
+func (m *Metrics) recordMiss()  { atomic.AddUint64(&m.misses, 1); m.touch() }
 func (m *Metrics) recordAdd()   { atomic.AddUint64(&m.adds, 1) }
 func (m *Metrics) recordEvict() { atomic.AddUint64(&m.evicts, 1) }
+func (m *Metrics) touch()       { m.lastAccess.Store(time.Now().UnixNano()) }
 
 // GetStats 返回当前统计信息
 func (m *Metrics) GetStats() map[string]interface{} {
+	hits, misses := atomic.LoadUint64(&m.hits), atomic.LoadUint64(&m.misses)
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
 	return map[string]interface{}{
-		"hits":        atomic.LoadUint64(&m.hits),
-		"misses":      atomic.LoadUint64(&m.misses),
+		"hits":        hits,
+		"misses":      misses,
+		"hit_rate":    hitRate,
 		"adds":        atomic.LoadUint64(&m.adds),
 		"evicts":      atomic.LoadUint64(&m.evicts),
-		"last_access": m.lastAccess,
+		"last_access": time.Unix(0, m.lastAccess.Load()),
 	}
 }
@@ -1,15 +1,74 @@
 package llm
 
-// Scorer 打分
+import (
+	"strings"
+	"unicode"
+)
+
+// Scorer 打分，对向量检索的候选缓存重排
 type Scorer interface {
-	Eval(string) float64
+	Eval(query string, document *CachedDocument) float64
 }
 
-// ExactMatchScorer 精确匹配排序
+// ScorerFunc ...
+type ScorerFunc func(query string, document *CachedDocument) float64
+
+// Eval ...
+func (f ScorerFunc) Eval(query string, document *CachedDocument) float64 {
+	return f(query, document)
+}
+
+// ExactMatchScorer 精确匹配，忽略大小写和首尾空白
 type ExactMatchScorer struct {
 }
 
 // Eval 精确匹配排序
-func (r *ExactMatchScorer) Eval(query string) float64 {
-	return 1.0
+func (r *ExactMatchScorer) Eval(query string, document *CachedDocument) float64 {
+	if strings.EqualFold(strings.TrimSpace(query), strings.TrimSpace(document.Query)) {
+		return 1.0
+	}
+	return 0
+}
+
+// LexicalScorer 词重叠 (Jaccard) 打分，中文按字切分
+type LexicalScorer struct {
+}
+
+// Eval ...
+func (r *LexicalScorer) Eval(query string, document *CachedDocument) float64 {
+	a, b := lexicalTokens(query), lexicalTokens(document.Query)
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	intersection := 0
+	for token := range a {
+		if _, ok := b[token]; ok {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+func lexicalTokens(text string) map[string]struct{} {
+	tokens := map[string]struct{}{}
+	word := strings.Builder{}
+	flush := func() {
+		if word.Len() > 0 {
+			tokens[word.String()] = struct{}{}
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			tokens[string(r)] = struct{}{}
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
 }
@@ -2,82 +2,164 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/showntop/llmack/embedding"
-	"github.com/showntop/llmack/vdb"
+	"github.com/showntop/llmack/log"
 	"github.com/showntop/llmack/vdb/memo"
 )
 
-// RedisCache ...
+// RedisCache 答案保存在 redis 中，由 redis 按 TTL 过期，按 sorted set 记录访问时间做 LRU 淘汰
 type RedisCache struct {
 	BaseCache
-	cli *redis.Client
+	Prefix string // key prefix, default llm:cache:
+	cli    *redis.Client
 }
 
-// NewRedisCache ...
-func NewRedisCache(cli *redis.Client) Cache {
-	return &RedisCache{
+// NewRedisCache the vector store is the process-local memo by default, pass a persistent one by
+// WithCacheVectorStore to share the cache across processes
+func NewRedisCache(cli *redis.Client, opts ...CacheOption) Cache {
+	c := &RedisCache{
 		BaseCache: BaseCache{
 			Config:      DefaultConfig(),
 			Embedder:    embedding.NewStringEmbedder(),
 			VectorStore: memo.New(),
 		},
-		cli: cli,
+		Prefix: "llm:cache:",
+		cli:    cli,
 	}
+	c.apply(opts...)
+	return c
+}
+
+func (m *RedisCache) key(id string) string {
+	return m.Prefix + "doc:" + id
+}
+
+func (m *RedisCache) lruKey() string {
+	return m.Prefix + "lru"
 }
 
 // Fetch ...
 func (m *RedisCache) Fetch(ctx context.Context, messages []Message) (*CachedDocument, bool, error) {
-	// 处理query
-	query, err := m.Config.QueryProcessor(messages)
+	document, candidates, err := m.search(ctx, messages)
 	if err != nil {
 		return nil, false, err
 	}
-	// embedding vector
-	vector, err := m.Embedder.Embed(ctx, query)
-	if err != nil {
-		return nil, false, err
+	if len(candidates) == 0 {
+		m.recordHit(false)
+		return document, false, nil
 	}
-	// search vector ids
-	relations, err := m.VectorStore.Search(ctx, vector, vdb.WithTopk(5))
+	keys := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		keys = append(keys, m.key(candidate.id))
+	}
+	values, err := m.cli.MGet(ctx, keys...).Result()
 	if err != nil {
 		return nil, false, err
 	}
-	if relations == nil || len(relations) == 0 {
-		return &CachedDocument{Query: query, Vector: vector}, false, nil
-	}
-	ids := make([]string, 0, len(relations))
-	for i := 0; i < len(relations); i++ {
-		ids[i] = relations[i].ID
+	documents := make([]*CachedDocument, 0, len(candidates))
+	stale := []string{}
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok { // expired by redis ttl or evicted
+			stale = append(stale, candidates[i].id)
+			continue
+		}
+		cached := &CachedDocument{}
+		if err := json.Unmarshal([]byte(raw), cached); err != nil {
+			log.WarnContextf(ctx, "llm redis cache unmarshal document error: %v", err)
+			continue
+		}
+		cached.Score = candidates[i].similarity
+		documents = append(documents, cached)
 	}
-	// batch get
-	res, err := m.cli.MGet(ctx, ids...).Result()
-	if err != nil {
-		return nil, false, err
+	if err := m.evict(ctx, stale...); err != nil {
+		log.WarnContextf(ctx, "llm redis cache evict stale documents error: %v", err)
 	}
-	_ = res
-	// object data
-	documents := make([]*CachedDocument, 0, len(relations))
-
-	for i := 0; i < len(relations); i++ {
 
+	best, ok := m.rank(document.Query, documents)
+	m.recordHit(ok)
+	if !ok {
+		return document, false, nil
 	}
-	if len(documents) == 0 {
-		return nil, false, nil
+	if err := m.cli.ZAdd(ctx, m.lruKey(), &redis.Z{Score: float64(time.Now().UnixNano()), Member: best.ID}).Err(); err != nil {
+		log.WarnContextf(ctx, "llm redis cache touch document error: %v", err)
 	}
-
-	// 排序
-	document := documents[0]
-	return document, true, nil
+	return best, true, nil
 }
 
 // Store ...
 func (m *RedisCache) Store(ctx context.Context, document *CachedDocument, value string) error {
-	document.ID = uuid.NewString()
-	// if err := m.VectorStore.Store(ctx, document.ID, document.Vector); err != nil {
-	// 	return err
-	// }
+	if document == nil || value == "" {
+		return nil
+	}
+	document.ID = namespacePrefix(document.Namespace) + uuid.NewString()
+	document.Answer = value
+	document.CreatedAt = time.Now()
+	raw, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	if err := m.cli.Set(ctx, m.key(document.ID), raw, m.Config.TTL).Err(); err != nil {
+		return err
+	}
+	if err := m.cli.ZAdd(ctx, m.lruKey(), &redis.Z{Score: float64(document.CreatedAt.UnixNano()), Member: document.ID}).Err(); err != nil {
+		return err
+	}
+	if err := m.index(ctx, document); err != nil {
+		return err
+	}
+	if m.Metrics != nil {
+		m.Metrics.recordAdd()
+	}
+	if m.Config.MaxEntries <= 0 {
+		return nil
+	}
+	count, err := m.cli.ZCard(ctx, m.lruKey()).Result()
+	if err != nil || count <= int64(m.Config.MaxEntries) {
+		return err
+	}
+	oldest, err := m.cli.ZPopMin(ctx, m.lruKey(), count-int64(m.Config.MaxEntries)).Result()
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(oldest))
+	for _, z := range oldest {
+		if id, ok := z.Member.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return m.evict(ctx, ids...)
+}
+
+// evict removes documents from redis and vector store
+func (m *RedisCache) evict(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(ids))
+	members := make([]any, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, m.key(id))
+		members = append(members, id)
+	}
+	if err := m.cli.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+	if err := m.cli.ZRem(ctx, m.lruKey(), members...).Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := m.VectorStore.Delete(ctx, id); err != nil {
+			return err
+		}
+		if m.Metrics != nil {
+			m.Metrics.recordEvict()
+		}
+	}
 	return nil
 }
@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/showntop/llmack/vdb"
+	"github.com/showntop/llmack/vdb/memo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoCache_Semantic(t *testing.T) {
+	cache := NewMemoCache(WithCacheScorer(&LexicalScorer{})).(*MemoCache)
+	ctx := WithCacheNamespace(context.Background(), "agent-a")
+
+	document, hit, err := cache.Fetch(ctx, []Message{NewUserTextMessage("what is the capital of France")})
+	assert.NoError(t, err)
+	assert.False(t, hit)
+	assert.NoError(t, cache.Store(ctx, document, "Paris"))
+
+	document, hit, err = cache.Fetch(ctx, []Message{NewUserTextMessage("What is the capital of France")})
+	assert.NoError(t, err)
+	assert.True(t, hit)
+	assert.Equal(t, "Paris", document.Answer)
+
+	_, hit, _ = cache.Fetch(WithCacheNamespace(context.Background(), "agent-b"), []Message{NewUserTextMessage("what is the capital of France")})
+	assert.False(t, hit) // namespaced
+
+	stats := cache.Metrics.GetStats()
+	assert.Equal(t, uint64(1), stats["hits"])
+	assert.Equal(t, uint64(2), stats["misses"])
+}
+
+func TestMemoCache_Eviction(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxEntries = 2
+	config.TTL = time.Hour
+	cache := NewMemoCache(WithCacheConfig(config), WithCacheScorer(&ExactMatchScorer{})).(*MemoCache)
+	ctx := context.Background()
+	store := func(query string) {
+		document, _, err := cache.Fetch(ctx, []Message{NewUserTextMessage(query)})
+		assert.NoError(t, err)
+		assert.NoError(t, cache.Store(ctx, document, query+" answer"))
+	}
+	store("first question")
+	store("second question")
+	_, hit, _ := cache.Fetch(ctx, []Message{NewUserTextMessage("first question")}) // first becomes recently used
+	assert.True(t, hit)
+	store("third question")
+	assert.Equal(t, 2, cache.Len())
+	_, hit, _ = cache.Fetch(ctx, []Message{NewUserTextMessage("second question")})
+	assert.False(t, hit) // least recently used evicted
+	_, hit, _ = cache.Fetch(ctx, []Message{NewUserTextMessage("first question")})
+	assert.True(t, hit)
+
+	config.TTL = time.Nanosecond // expired
+	config.CleanupInterval = 0
+	_, hit, _ = cache.Fetch(ctx, []Message{NewUserTextMessage("first question")})
+	assert.False(t, hit)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestInstance_CacheNamespace(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{"a1", "a2"}}
+	instance := NewInstance("scripted", WithProvider(provider), WithCache(NewMemoCache()), WithDefaultModel("m"))
+	invoke := func(system string) string {
+		response, err := instance.Invoke(context.Background(), []Message{NewSystemMessage(system), NewUserTextMessage("hello")})
+		assert.NoError(t, err)
+		return response.Result().Message.Content()
+	}
+	assert.Equal(t, "a1", invoke("you are a"))
+	time.Sleep(10 * time.Millisecond) // cache is stored after stream drained
+	assert.Equal(t, "a1", invoke("you are a"))
+	assert.Equal(t, "a2", invoke("you are b"))
+	assert.Len(t, provider.requests, 2)
+}
+
+// fixedEmbedder embeds every query to the same vector
+type fixedEmbedder struct{}
+
+func (fixedEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0}, nil
+}
+
+func (fixedEmbedder) Dimension() int { return 2 }
+
+func TestBaseCache_SearchNamespace(t *testing.T) {
+	config := DefaultConfig()
+	config.TopK = 1
+	cache := &BaseCache{Config: config, Embedder: fixedEmbedder{}, VectorStore: memo.New()}
+	ctx := context.Background()
+	assert.NoError(t, cache.index(ctx, &CachedDocument{ID: "b#1", Namespace: "b", Query: "q", Vector: []float32{1, 0}}))
+	assert.NoError(t, cache.index(ctx, &CachedDocument{ID: "a#1", Namespace: "a", Query: "q", Vector: []float32{0.99, 0.1}}))
+
+	// the closer answer of namespace b does not take the only slot
+	_, candidates, err := cache.search(WithCacheNamespace(ctx, "a"), []Message{NewUserTextMessage("q")})
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, "a#1", candidates[0].id)
+}
+
+// distanceStore returns cosine distances without embeddings, like redis
+type distanceStore struct {
+	vdb.VDB
+}
+
+func (distanceStore) DistanceScore() bool { return true }
+
+func (distanceStore) Search(ctx context.Context, vector []float32, options ...vdb.SearchOption) ([]*vdb.Document, error) {
+	return []*vdb.Document{{ID: "a#near", Similarity: 0.02}, {ID: "a#far", Similarity: 0.95}}, nil
+}
+
+func TestBaseCache_SearchDistance(t *testing.T) {
+	cache := &BaseCache{Config: DefaultConfig(), Embedder: fixedEmbedder{}, VectorStore: distanceStore{memo.New()}}
+	_, candidates, err := cache.search(WithCacheNamespace(context.Background(), "a"), []Message{NewUserTextMessage("q")})
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, "a#near", candidates[0].id)
+	assert.InDelta(t, 0.98, candidates[0].similarity, 1e-6)
+}
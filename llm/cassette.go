@@ -0,0 +1,410 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/showntop/llmack/log"
+)
+
+// ErrCassetteMiss no recorded interaction for the request in replay mode
+var ErrCassetteMiss = errors.New("llm cassette has no recorded interaction")
+
+// CassetteMode 录制 / 回放模式
+type CassetteMode string
+
+const (
+	// CassetteReplay serves recorded interactions only, never calls the provider
+	CassetteReplay CassetteMode = "replay"
+	// CassetteRecord always calls the provider and records the interactions
+	CassetteRecord CassetteMode = "record"
+	// CassetteAuto replays recorded interactions, records the missing ones
+	CassetteAuto CassetteMode = "auto"
+)
+
+// CassetteRequest normalized request, the key of an interaction is the hash of it
+type CassetteRequest struct {
+	Model          string                        `json:"model,omitempty"`
+	Messages       []CassetteMessage             `json:"messages"`
+	Tools          []*Tool                       `json:"tools,omitempty"`
+	ToolChoice     any                           `json:"tool_choice,omitempty"`
+	ResponseFormat *ChatCompletionResponseFormat `json:"response_format,omitempty"`
+	Temperature    float64                       `json:"temperature,omitempty"`
+	TopP           float64                       `json:"top_p,omitempty"`
+	MaxTokens      int                           `json:"max_tokens,omitempty"`
+	N              int                           `json:"n,omitempty"`
+	CandidateCount int                           `json:"candidate_count,omitempty"`
+	Stop           []string                      `json:"stop,omitempty"`
+	Metadata       map[string]any                `json:"metadata,omitempty"`
+}
+
+// CassetteMessage ...
+type CassetteMessage struct {
+	Role       MessageRole         `json:"role"`
+	Content    string              `json:"content,omitempty"`
+	Multipart  []*MultipartContent `json:"multipart,omitempty"`
+	ToolCalls  []*ToolCall         `json:"tool_calls,omitempty"`
+	ToolCallID string              `json:"tool_call_id,omitempty"`
+}
+
+// CassetteChunk a recorded stream chunk, a chunk of several choices is recorded as one chunk per choice
+type CassetteChunk struct {
+	Index              int         `json:"index,omitempty"` // choice index
+	Model              string      `json:"model,omitempty"`
+	Content            string      `json:"content,omitempty"`
+	ReasoningContent   string      `json:"reasoning_content,omitempty"`
+	ReasoningSignature string      `json:"reasoning_signature,omitempty"`
+	ToolCalls          []*ToolCall `json:"tool_calls,omitempty"`
+	FinishReason       string      `json:"finish_reason,omitempty"`
+	Usage              *Usage      `json:"usage,omitempty"`
+	// Error and ProviderError the error ending the stream, see Chunk.Err
+	Error         string         `json:"error,omitempty"`
+	ProviderError *CassetteError `json:"provider_error,omitempty"`
+}
+
+// CassetteError a recorded *ProviderError, replayed as the same typed error
+type CassetteError struct {
+	Kind       string        `json:"kind,omitempty"` // see errorKinds
+	StatusCode int           `json:"status_code,omitempty"`
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+	Message    string        `json:"message,omitempty"`
+	Err        string        `json:"err,omitempty"` // message of the underlying error
+}
+
+// errorKinds names of ProviderError.Kind in cassette
+var errorKinds = map[string]error{
+	"rate_limited":     ErrRateLimited,
+	"context_overflow": ErrContextOverflow,
+	"auth_failed":      ErrAuthFailed,
+	"transient":        ErrTransient,
+	"content_filtered": ErrContentFiltered,
+}
+
+// Interaction a recorded request and its response
+type Interaction struct {
+	Key     string           `json:"key"`
+	Request *CassetteRequest `json:"request"`
+	Chunks  []*CassetteChunk `json:"chunks,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	// ProviderError set if the error is a *ProviderError
+	ProviderError *CassetteError `json:"provider_error,omitempty"`
+}
+
+// Cassette records requests and responses of llm.Instance to a file and replays them offline,
+// used for deterministic tests of agents, programs and workflows.
+type Cassette struct {
+	// Normalize is called before hashing, e.g. to erase the current date in system prompt
+	Normalize func(*CassetteRequest) `json:"-"`
+
+	mu           sync.Mutex
+	path         string
+	mode         CassetteMode
+	Interactions []*Interaction `json:"interactions"`
+	played       map[string]int // key => replayed count
+}
+
+// NewCassette loads the cassette file if exists
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode, played: map[string]int{}}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if mode == CassetteReplay {
+			return nil, fmt.Errorf("llm cassette %s not found: %w", path, err)
+		}
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mode == CassetteRecord { // re-record from scratch
+		return c, nil
+	}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, fmt.Errorf("unmarshal llm cassette %s error: %w", path, err)
+	}
+	return c, nil
+}
+
+// Wrap returns a provider recording to or replaying from the cassette
+func (c *Cassette) Wrap(provider Provider) Provider {
+	return &cassetteProvider{cassette: c, provider: provider}
+}
+
+// Save writes the cassette file
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+func (c *Cassette) save() error {
+	raw, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, raw, 0o644)
+}
+
+// Key normalizes the request and returns its hash
+func (c *Cassette) Key(messages []Message, options *InvokeOptions) (string, *CassetteRequest) {
+	request := &CassetteRequest{
+		Model:          options.Model,
+		Tools:          options.Tools,
+		ToolChoice:     options.ToolChoice,
+		ResponseFormat: options.ResponseFormat,
+		Temperature:    options.Temperature,
+		TopP:           options.TopP,
+		MaxTokens:      options.MaxTokens,
+		N:              options.N,
+		CandidateCount: options.CandidateCount,
+		Stop:           append(append([]string{}, options.Stop...), options.StopWords...),
+		Metadata:       options.Metadata,
+	}
+	for _, m := range messages {
+		request.Messages = append(request.Messages, CassetteMessage{
+			Role:       m.Role(),
+			Content:    strings.TrimSpace(m.Content()),
+			Multipart:  m.MultipartContent(),
+			ToolCalls:  m.GetToolCalls(),
+			ToolCallID: m.ToolID(),
+		})
+	}
+	if c.Normalize != nil {
+		c.Normalize(request)
+	}
+	raw, _ := json.Marshal(request)
+	hash := sha256.Sum256(raw)
+	return hex.EncodeToString(hash[:]), request
+}
+
+// lookup returns recorded interactions of key in order, the last one is reused when exhausted
+func (c *Cassette) lookup(key string) *Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	matched := []*Interaction{}
+	for _, it := range c.Interactions {
+		if it.Key == key {
+			matched = append(matched, it)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	i := min(c.played[key], len(matched)-1)
+	c.played[key]++
+	return matched[i]
+}
+
+func (c *Cassette) record(interaction *Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, interaction)
+	c.played[interaction.Key]++
+	return c.save()
+}
+
+type cassetteProvider struct {
+	cassette *Cassette
+	provider Provider
+}
+
+// Invoke ...
+func (p *cassetteProvider) Invoke(ctx context.Context, messages []Message, options *InvokeOptions) (*Response, error) {
+	key, request := p.cassette.Key(messages, options)
+	if p.cassette.mode != CassetteRecord {
+		if interaction := p.cassette.lookup(key); interaction != nil {
+			return replay(interaction)
+		}
+		if p.cassette.mode == CassetteReplay {
+			return nil, fmt.Errorf("%w: key %s", ErrCassetteMiss, key)
+		}
+	}
+	if p.provider == nil {
+		return nil, fmt.Errorf("llm cassette record without provider")
+	}
+
+	interaction := &Interaction{Key: key, Request: request}
+	response, err := p.provider.Invoke(ctx, messages, options)
+	if err != nil {
+		interaction.Error, interaction.ProviderError = toCassetteError(err)
+		if rerr := p.cassette.record(interaction); rerr != nil {
+			return nil, errors.Join(err, rerr)
+		}
+		return nil, err
+	}
+	if response == nil || response.stream == nil { // block response
+		if response != nil && response.result != nil {
+			interaction.Chunks = append(interaction.Chunks, resultToCassetteChunks(response.result)...)
+		}
+		if err := p.cassette.record(interaction); err != nil {
+			log.WarnContextf(ctx, "llm cassette save %s error: %v", p.cassette.path, err)
+		}
+		return response, nil
+	}
+
+	tee := NewStreamResponse()
+	go func() {
+		defer tee.stream.Close()
+		for chunk := range response.stream.Next() {
+			interaction.Chunks = append(interaction.Chunks, toCassetteChunks(chunk)...)
+			tee.stream.Push(chunk)
+		}
+		if err := p.cassette.record(interaction); err != nil {
+			log.WarnContextf(ctx, "llm cassette save %s error: %v", p.cassette.path, err)
+		}
+	}()
+	return tee, nil
+}
+
+func replay(interaction *Interaction) (*Response, error) {
+	if interaction.Error != "" {
+		return nil, fromCassetteError(interaction.Error, interaction.ProviderError)
+	}
+	response := NewStreamResponse()
+	go func() {
+		defer response.stream.Close()
+		for _, recorded := range interaction.Chunks {
+			response.stream.Push(fromCassetteChunk(recorded))
+		}
+	}()
+	return response, nil
+}
+
+// toCassetteChunks records each choice of chunk, usage and error go with the first one only
+func toCassetteChunks(chunk *Chunk) []*CassetteChunk {
+	recorded := []*CassetteChunk{}
+	for _, choice := range chunk.Choices {
+		if choice == nil {
+			continue
+		}
+		c := &CassetteChunk{Index: choice.Index, Model: chunk.Model, FinishReason: choice.FinishReason}
+		if delta := choice.Delta; delta != nil {
+			c.Content = delta.Content()
+			c.ReasoningContent = delta.ReasoningContent
+			c.ReasoningSignature = delta.ReasoningSignature
+			c.ToolCalls = copyToolCalls(delta.ToolCalls)
+		}
+		recorded = append(recorded, c)
+	}
+	if len(recorded) == 0 {
+		recorded = append(recorded, &CassetteChunk{Model: chunk.Model})
+	}
+	if chunk.Usage != nil {
+		usage := *chunk.Usage
+		recorded[0].Usage = &usage
+	}
+	if chunk.Err != nil {
+		recorded[0].Error, recorded[0].ProviderError = toCassetteError(chunk.Err)
+	}
+	return recorded
+}
+
+// resultToCassetteChunks records a block response as one chunk per choice
+func resultToCassetteChunks(result *Result) []*CassetteChunk {
+	recorded := []*CassetteChunk{}
+	choices := result.Choices
+	if len(choices) == 0 && result.Message != nil {
+		choices = []*ResultChoice{{Message: result.Message, FinishReason: result.FinishReason}}
+	}
+	for _, choice := range choices {
+		c := &CassetteChunk{Index: choice.Index, Model: result.Model, FinishReason: choice.FinishReason}
+		if choice.Message != nil {
+			c.Content = choice.Message.Content()
+			c.ReasoningContent = choice.Message.ReasoningContent
+			c.ReasoningSignature = choice.Message.ReasoningSignature
+			c.ToolCalls = copyToolCalls(choice.Message.ToolCalls)
+		}
+		recorded = append(recorded, c)
+	}
+	if len(recorded) == 0 {
+		recorded = append(recorded, &CassetteChunk{Model: result.Model})
+	}
+	usage := result.Usage
+	recorded[0].Usage = &usage
+	if result.Err != nil {
+		recorded[0].Error, recorded[0].ProviderError = toCassetteError(result.Err)
+	}
+	return recorded
+}
+
+func fromCassetteChunk(recorded *CassetteChunk) *Chunk {
+	msg := NewAssistantMessage(recorded.Content)
+	msg.ReasoningContent = recorded.ReasoningContent
+	msg.ReasoningSignature = recorded.ReasoningSignature
+	msg.ToolCalls = copyToolCalls(recorded.ToolCalls) // merged in place by Result, do not share
+	var usage *Usage
+	if recorded.Usage != nil {
+		copied := *recorded.Usage
+		usage = &copied
+	}
+	chunk := NewChunk(recorded.Index, msg, usage)
+	chunk.Model = recorded.Model
+	chunk.Choices[0].FinishReason = recorded.FinishReason
+	if recorded.Error != "" {
+		chunk.Err = fromCassetteError(recorded.Error, recorded.ProviderError)
+	}
+	return chunk
+}
+
+func toCassetteError(err error) (string, *CassetteError) {
+	var pe *ProviderError
+	if !errors.As(err, &pe) {
+		return err.Error(), nil
+	}
+	recorded := &CassetteError{StatusCode: pe.StatusCode, RetryAfter: pe.RetryAfter, Message: pe.Message}
+	for name, kind := range errorKinds {
+		if pe.Kind == kind {
+			recorded.Kind = name
+		}
+	}
+	if pe.Err != nil {
+		recorded.Err = pe.Err.Error()
+	}
+	return err.Error(), recorded
+}
+
+func fromCassetteError(message string, recorded *CassetteError) error {
+	if recorded == nil {
+		return errors.New(message)
+	}
+	pe := &ProviderError{
+		Kind:       errorKinds[recorded.Kind],
+		StatusCode: recorded.StatusCode,
+		RetryAfter: recorded.RetryAfter,
+		Message:    recorded.Message,
+	}
+	if recorded.Err != "" {
+		pe.Err = errors.New(recorded.Err)
+	}
+	return pe
+}
+
+// SupportsResponseFormat delegates to the wrapped provider
+func (p *cassetteProvider) SupportsResponseFormat(typ ChatCompletionResponseFormatType) bool {
+	supporter, ok := p.provider.(ResponseFormatSupporter)
+	return ok && supporter.SupportsResponseFormat(typ)
+}
+
+func copyToolCalls(calls []*ToolCall) []*ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	copied := make([]*ToolCall, 0, len(calls))
+	for _, call := range calls {
+		c := *call
+		copied = append(copied, &c)
+	}
+	return copied
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// toolCallProvider streams a tool call with split arguments
+type toolCallProvider struct {
+	calls int
+}
+
+func (p *toolCallProvider) Invoke(ctx context.Context, messages []Message, opts *InvokeOptions) (*Response, error) {
+	p.calls++
+	response := NewStreamResponse()
+	go func() {
+		defer response.stream.Close()
+		first := NewAssistantMessage("")
+		first.ToolCalls = []*ToolCall{{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "weather", Arguments: `{"city":`}}}
+		response.stream.Push(NewChunk(0, first, nil))
+		second := NewAssistantMessage("")
+		second.ToolCalls = []*ToolCall{{Function: ToolCallFunction{Arguments: `"Beijing"}`}}}
+		chunk := NewChunk(0, second, &Usage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10})
+		chunk.Choices[0].FinishReason = "tool_calls"
+		response.stream.Push(chunk)
+	}()
+	return response, nil
+}
+
+func TestCassette_RecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather.json")
+	messages := []Message{NewSystemMessage("you are a helper"), NewUserTextMessage("weather of Beijing")}
+	tool := &Tool{Type: "function", Function: &FunctionDefinition{Name: "weather"}}
+
+	recorder, err := NewCassette(path, CassetteRecord)
+	assert.NoError(t, err)
+	provider := &toolCallProvider{}
+	response, err := NewInstance("scripted", WithProvider(provider), WithCassette(recorder)).
+		Invoke(context.Background(), messages, WithTools(tool))
+	assert.NoError(t, err)
+	recorded := response.Result()
+	assert.Equal(t, 1, provider.calls)
+
+	player, err := NewCassette(path, CassetteReplay)
+	assert.NoError(t, err)
+	instance := NewInstance("unregistered", WithCassette(player))
+	response, err = instance.Invoke(context.Background(), messages, WithTools(tool))
+	assert.NoError(t, err)
+	replayed := response.Result()
+	assert.Equal(t, recorded.Message.Content(), replayed.Message.Content())
+	assert.Len(t, replayed.Message.ToolCalls, 1)
+	assert.Equal(t, "call_1", replayed.Message.ToolCalls[0].ID)
+	assert.Equal(t, `{"city":"Beijing"}`, replayed.Message.ToolCalls[0].Function.Arguments)
+	assert.Equal(t, 10, replayed.Usage.TotalTokens)
+
+	_, err = instance.Invoke(context.Background(), messages) // tools differ
+	assert.ErrorIs(t, err, ErrCassetteMiss)
+}
+
+// choicesProvider streams two choices, fails with a rate limit error for the second user message
+type choicesProvider struct{}
+
+func (p *choicesProvider) Invoke(ctx context.Context, messages []Message, opts *InvokeOptions) (*Response, error) {
+	if messages[len(messages)-1].Content() == "again" {
+		return nil, &ProviderError{Kind: ErrRateLimited, StatusCode: 429, RetryAfter: time.Second, Message: "slow down"}
+	}
+	response := NewStreamResponse()
+	go func() {
+		defer response.stream.Close()
+		chunk := NewChunk(0, NewAssistantMessage("sunny"), &Usage{TotalTokens: 5})
+		chunk.Choices = append(chunk.Choices, &ChunkChoice{Index: 1, Delta: NewAssistantMessage("rainy"), FinishReason: "stop"})
+		chunk.Choices[0].FinishReason = "stop"
+		response.stream.Push(chunk)
+	}()
+	return response, nil
+}
+
+func TestCassette_ChoicesAndErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "choices.json")
+	recorder, err := NewCassette(path, CassetteRecord)
+	assert.NoError(t, err)
+	instance := NewInstance("scripted", WithProvider(&choicesProvider{}), WithCassette(recorder))
+	response, err := instance.Invoke(context.Background(), []Message{NewUserTextMessage("weather")})
+	assert.NoError(t, err)
+	response.Result()
+	_, err = instance.Invoke(context.Background(), []Message{NewUserTextMessage("again")})
+	assert.ErrorIs(t, err, ErrRateLimited)
+
+	player, err := NewCassette(path, CassetteReplay)
+	assert.NoError(t, err)
+	instance = NewInstance("unregistered", WithCassette(player))
+	response, err = instance.Invoke(context.Background(), []Message{NewUserTextMessage("weather")})
+	assert.NoError(t, err)
+	replayed := response.Result()
+	assert.Len(t, replayed.Choices, 2)
+	assert.Equal(t, "sunny", replayed.Choices[0].Message.Content())
+	assert.Equal(t, "rainy", replayed.Choices[1].Message.Content())
+	assert.Equal(t, 5, replayed.Usage.TotalTokens)
+
+	_, err = instance.Invoke(context.Background(), []Message{NewUserTextMessage("again")})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, time.Second, RetryAfterOf(err))
+
+	// the number of choices is part of the key
+	_, err = instance.Invoke(context.Background(), []Message{NewUserTextMessage("weather")}, WithN(2))
+	assert.ErrorIs(t, err, ErrCassetteMiss)
+}
@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultContextWindow context length of unknown models
+var DefaultContextWindow = 32 * 1024
+
+var contextWindows = struct {
+	sync.RWMutex
+	m map[string]int // model name or prefix => context length in tokens
+}{m: map[string]int{
+	"deepseek-chat":     64 * 1024,
+	"deepseek-reasoner": 64 * 1024,
+	"deepseek-v3":       64 * 1024,
+	"deepseek-r1":       64 * 1024,
+	"gpt-4o":            128 * 1024,
+	"gpt-4.1":           1024 * 1024,
+	"gpt-4-turbo":       128 * 1024,
+	"gpt-4":             8 * 1024,
+	"gpt-3.5-turbo":     16 * 1024,
+	"o1":                200 * 1024,
+	"o3":                200 * 1024,
+	"o4-mini":           200 * 1024,
+	"claude":            200 * 1024,
+	"qwen-max":          32 * 1024,
+	"qwen-plus":         128 * 1024,
+	"qwen-turbo":        1024 * 1024,
+	"qwen-long":         10 * 1024 * 1024,
+	"qwen3":             128 * 1024,
+	"doubao":            128 * 1024,
+	"moonshot-v1-8k":    8 * 1024,
+	"moonshot-v1-32k":   32 * 1024,
+	"moonshot-v1-128k":  128 * 1024,
+	"kimi":              128 * 1024,
+	"glm-4":             128 * 1024,
+	"hunyuan":           32 * 1024,
+}}
+
+// RegisterContextWindow registers the context length of model, model is matched by prefix
+func RegisterContextWindow(model string, tokens int) {
+	contextWindows.Lock()
+	defer contextWindows.Unlock()
+	contextWindows.m[model] = tokens
+}
+
+// ContextWindow returns the context length of model by the longest matched prefix
+func ContextWindow(model string) int {
+	contextWindows.RLock()
+	defer contextWindows.RUnlock()
+	if tokens, ok := contextWindows.m[model]; ok {
+		return tokens
+	}
+	prefixes := make([]string, 0, len(contextWindows.m))
+	for prefix := range contextWindows.m {
+		if strings.HasPrefix(model, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return DefaultContextWindow
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return contextWindows.m[prefixes[0]]
+}
@@ -31,6 +31,11 @@ func (m *LLM) Name() string {
 	return Name
 }
 
+// SupportsResponseFormat only json_object is supported natively, json_schema falls back to prompt-and-validate
+func (m *LLM) SupportsResponseFormat(t llm.ChatCompletionResponseFormatType) bool {
+	return t == llm.ChatCompletionResponseFormatTypeJSONObject
+}
+
 // Invoke ...
 func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
 	var err error
@@ -0,0 +1,203 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 供应商错误分类，使用 errors.Is 判断
+var (
+	ErrRateLimited     = errors.New("llm rate limited")
+	ErrContextOverflow = errors.New("llm context length exceeded")
+	ErrAuthFailed      = errors.New("llm authentication failed")
+	ErrTransient       = errors.New("llm transient error")
+	ErrContentFiltered = errors.New("llm content filtered")
+)
+
+// ProviderError is a typed error returned by providers
+type ProviderError struct {
+	Kind       error         // one of ErrRateLimited, ErrContextOverflow, ErrAuthFailed, ErrTransient, ErrContentFiltered or nil
+	StatusCode int           // http status code if any
+	RetryAfter time.Duration // suggested wait before retry, for rate limited
+	Message    string        // raw message from provider
+	Err        error         // underlying error
+}
+
+// Error ...
+func (e *ProviderError) Error() string {
+	builder := strings.Builder{}
+	if e.Kind != nil {
+		builder.WriteString(e.Kind.Error())
+	} else {
+		builder.WriteString("llm provider error")
+	}
+	if e.StatusCode > 0 {
+		builder.WriteString(" (status " + strconv.Itoa(e.StatusCode) + ")")
+	}
+	if e.Message != "" {
+		builder.WriteString(": " + e.Message)
+	}
+	if e.Err != nil {
+		builder.WriteString(": " + e.Err.Error())
+	}
+	return builder.String()
+}
+
+// Unwrap ...
+func (e *ProviderError) Unwrap() []error {
+	errs := []error{}
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// RetryAfterOf returns the retry-after carried by err, 0 if none
+func RetryAfterOf(err error) time.Duration {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.RetryAfter
+	}
+	return 0
+}
+
+// NewStatusError classifies an http error response of provider
+func NewStatusError(statusCode int, header http.Header, body string) *ProviderError {
+	e := &ProviderError{StatusCode: statusCode, Message: body}
+	lower := strings.ToLower(body)
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+		e.RetryAfter = parseRetryAfter(header)
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		e.Kind = ErrAuthFailed
+	case statusCode == http.StatusRequestTimeout || statusCode >= http.StatusInternalServerError:
+		e.Kind = ErrTransient // 5xx and anthropic 529 overloaded
+	case isContextOverflow(lower):
+		e.Kind = ErrContextOverflow
+	case isContentFiltered(lower): // after overflow, the body of overflow may mention the content
+		e.Kind = ErrContentFiltered
+	}
+	return e
+}
+
+// NewTransportError classifies an error before any response, e.g. connection reset
+func NewTransportError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &ProviderError{Kind: ErrTransient, Err: err}
+}
+
+func isContextOverflow(body string) bool {
+	for _, keyword := range []string{"context_length_exceeded", "maximum context length", "context window", "prompt is too long", "too many tokens", "range of input length", "exceeded model token limit"} {
+		if strings.Contains(body, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// isContentFiltered matches the error codes of providers, e.g. content_filter of openai and azure,
+// data_inspection_failed of qwen, rather than words of the message
+func isContentFiltered(body string) bool {
+	for _, keyword := range []string{"content_filter", "content_policy_violation", "data_inspection_failed"} {
+		if strings.Contains(body, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRetryAfter(header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		value = header.Get("retry-after-ms")
+		if ms, err := strconv.Atoi(value); err == nil {
+			return time.Duration(ms) * time.Millisecond
+		}
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// RetryPolicy 重试策略，对 transient 和 429 错误指数退避
+type RetryPolicy struct {
+	MaxAttempts    int              // total attempts including the first, <= 1 means no retry
+	InitialBackoff time.Duration    // backoff before the second attempt
+	MaxBackoff     time.Duration    // cap of backoff
+	Multiplier     float64          // backoff multiplier per attempt
+	Retryable      func(error) bool // decide whether err is retryable, default transient and rate limited
+}
+
+// DefaultRetryPolicy ...
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     20 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return errors.Is(err, ErrTransient) || errors.Is(err, ErrRateLimited)
+}
+
+// backoff returns wait duration before the next attempt, attempt starts from 1
+func (p *RetryPolicy) backoff(attempt int, err error) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		wait *= multiplier
+	}
+	backoff := time.Duration(wait)
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if retryAfter := RetryAfterOf(err); retryAfter > backoff {
+		backoff = retryAfter
+	}
+	return backoff
+}
+
+// wait sleeps backoff, return error if context done or deadline is earlier than backoff
+func (p *RetryPolicy) wait(ctx context.Context, backoff time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+		return fmt.Errorf("llm retry backoff %s exceeds context deadline", backoff)
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
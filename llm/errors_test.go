@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStatusError(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "2")
+	tests := []struct {
+		name       string
+		statusCode int
+		header     http.Header
+		body       string
+		want       error
+	}{
+		{"rate limited", http.StatusTooManyRequests, header, "slow down", ErrRateLimited},
+		{"auth", http.StatusUnauthorized, nil, "invalid api key", ErrAuthFailed},
+		{"overflow", http.StatusBadRequest, nil, `{"error":{"code":"context_length_exceeded"}}`, ErrContextOverflow},
+		{"filtered", http.StatusBadRequest, nil, `{"error":{"code":"data_inspection_failed"}}`, ErrContentFiltered},
+		{"transient", http.StatusBadGateway, nil, "bad gateway", ErrTransient},
+		{"transient before filtered", http.StatusInternalServerError, nil, `{"error":{"code":"content_filter"}}`, ErrTransient},
+		{"overflow before filtered", http.StatusBadRequest, nil, `{"error":{"code":"context_length_exceeded","message":"content_filter skipped"}}`, ErrContextOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewStatusError(tt.statusCode, tt.header, tt.body)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+	assert.Equal(t, 2*time.Second, RetryAfterOf(NewStatusError(http.StatusTooManyRequests, header, "")))
+	// words of the message are not the codes of content filter
+	assert.Nil(t, NewStatusError(http.StatusBadRequest, nil, "invalid safety_settings, sensitive field missing").Kind)
+}
+
+type flakyProvider struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyProvider) Invoke(ctx context.Context, messages []Message, opts *InvokeOptions) (*Response, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	response := NewStreamResponse()
+	go func() {
+		defer response.stream.Close()
+		response.stream.Push(NewChunk(0, NewAssistantMessage("ok"), nil))
+	}()
+	return response, nil
+}
+
+type attemptRecorder struct {
+	attempts []int
+}
+
+func (h *attemptRecorder) OnBeforeInvoke(ctx context.Context, _ *HookRequest) context.Context {
+	return ctx
+}
+func (h *attemptRecorder) OnAfterInvoke(ctx context.Context, err error)              {}
+func (h *attemptRecorder) OnFirstChunk(ctx context.Context, _ error) context.Context { return ctx }
+func (h *attemptRecorder) OnLastChunk(ctx context.Context, _ *Result, err error)     {}
+
+func (h *attemptRecorder) OnAttempt(ctx context.Context, attempt int, err error, backoff time.Duration) {
+	h.attempts = append(h.attempts, attempt)
+}
+
+func TestInstance_Retry(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+
+	provider := &flakyProvider{failures: 2, err: &ProviderError{Kind: ErrTransient}}
+	hook := &attemptRecorder{}
+	instance := NewInstance("flaky", WithProvider(provider), WithRetryPolicy(policy), WithHook(hook))
+	response, err := instance.Invoke(context.Background(), []Message{NewUserTextMessage("hi")}, WithStream(true))
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", response.Result().Message.Content())
+	assert.Equal(t, []int{1, 2, 3}, hook.attempts)
+
+	provider = &flakyProvider{failures: 1, err: &ProviderError{Kind: ErrAuthFailed}}
+	instance = NewInstance("flaky", WithProvider(provider), WithRetryPolicy(policy))
+	_, err = instance.Invoke(context.Background(), []Message{NewUserTextMessage("hi")}, WithStream(true))
+	assert.ErrorIs(t, err, ErrAuthFailed)
+	assert.Equal(t, 1, provider.calls)
+
+	provider = &flakyProvider{failures: 1, err: &ProviderError{Kind: ErrRateLimited, RetryAfter: time.Minute}}
+	instance = NewInstance("flaky", WithProvider(provider), WithRetryPolicy(policy))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = instance.Invoke(ctx, []Message{NewUserTextMessage("hi")}, WithStream(true))
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Equal(t, 1, provider.calls)
+}
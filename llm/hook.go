@@ -2,87 +2,257 @@ package llm
 
 import (
 	"context"
-	"database/sql"
-	"database/sql/driver"
-	"io"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// HookRequest the request of an invoke seen by hooks
+type HookRequest struct {
+	Provider string
+	Messages []Message
+	Options  *InvokeOptions
+}
+
 // Hook ...
 type Hook interface {
-	OnBeforeInvoke(context.Context) context.Context
+	// OnBeforeInvoke is called before invoke, the model of options is resolved
+	OnBeforeInvoke(context.Context, *HookRequest) context.Context
+	// OnAfterInvoke is called once the provider returned, OnFirstChunk and OnLastChunk follow if err is nil
 	OnAfterInvoke(ctx context.Context, err error)
 	OnFirstChunk(context.Context, error) context.Context
-	OnLastChunk(context.Context, error)
+	// OnLastChunk is called with the merged result once the response is completed, streamed or not,
+	// err is the error ending the stream if any, see Chunk.Err
+	OnLastChunk(context.Context, *Result, error)
+}
+
+// AttemptHook is an optional interface of Hook, notified after each attempt of provider invoke.
+// backoff is the wait before next attempt, zero if no more attempt.
+type AttemptHook interface {
+	OnAttempt(ctx context.Context, attempt int, err error, backoff time.Duration)
 }
 
-// OtelHook ...
+const instrumentationName = "github.com/showntop/llmack/opentelemetry"
+
+// OtelHook traces and measures invokes following the OpenTelemetry GenAI semantic conventions
 type OtelHook struct {
-	provider trace.TracerProvider
-	tracer   trace.Tracer
+	provider      trace.TracerProvider
+	meterProvider metric.MeterProvider
+	tracer        trace.Tracer
+
+	tokenUsage metric.Int64Histogram
+	duration   metric.Float64Histogram
+	ttft       metric.Float64Histogram
 }
 
 // HookOption 	...
 type HookOption func(*OtelHook)
 
-// NewOtelHook ...
+// WithMeterProvider ...
+func WithMeterProvider(provider metric.MeterProvider) HookOption {
+	return func(h *OtelHook) {
+		h.meterProvider = provider
+	}
+}
+
+// NewOtelHook spans are traced by the global TracerProvider, the same as the agent, tool and workflow spans
+// of package hooks, so they nest in one trace
 func NewOtelHook(opts ...HookOption) Hook {
 	h := &OtelHook{}
 	h.provider = otel.GetTracerProvider()
-	h.tracer = h.provider.Tracer("github.com/showntop/llmack/opentelemetry")
+	h.meterProvider = otel.GetMeterProvider()
+	for _, o := range opts {
+		o(h)
+	}
+	h.tracer = h.provider.Tracer(instrumentationName)
 
+	meter := h.meterProvider.Meter(instrumentationName)
+	noopMeter := noop.NewMeterProvider().Meter(instrumentationName)
+	var err error
+	if h.tokenUsage, err = meter.Int64Histogram("gen_ai.client.token.usage",
+		metric.WithUnit("{token}"), metric.WithDescription("Measures number of input and output tokens used")); err != nil {
+		otel.Handle(err)
+		h.tokenUsage, _ = noopMeter.Int64Histogram("gen_ai.client.token.usage")
+	}
+	if h.duration, err = meter.Float64Histogram("gen_ai.client.operation.duration",
+		metric.WithUnit("s"), metric.WithDescription("GenAI operation duration")); err != nil {
+		otel.Handle(err)
+		h.duration, _ = noopMeter.Float64Histogram("gen_ai.client.operation.duration")
+	}
+	if h.ttft, err = meter.Float64Histogram("gen_ai.server.time_to_first_token",
+		metric.WithUnit("s"), metric.WithDescription("Time to generate first token for successful responses")); err != nil {
+		otel.Handle(err)
+		h.ttft, _ = noopMeter.Float64Histogram("gen_ai.server.time_to_first_token")
+	}
 	return h
 }
 
-// OnFirstChunk ...
-func (h *OtelHook) OnFirstChunk(ctx context.Context, _ error) context.Context {
-	ctx, _ = h.tracer.Start(ctx, "llm/response", trace.WithSpanKind(trace.SpanKindInternal))
+type otelInvokeKey struct{}
 
-	return ctx
+// otelInvoke state of an invoke, kept in context between hook calls
+type otelInvoke struct {
+	span  trace.Span
+	start time.Time
+	attrs []attribute.KeyValue // common attributes of metrics
 }
 
-// OnLastChunk ...
-func (h *OtelHook) OnLastChunk(ctx context.Context, err error) {
-	span := trace.SpanFromContext(ctx)
-	if !span.IsRecording() {
-		return
+func otelInvokeFrom(ctx context.Context) *otelInvoke {
+	state, _ := ctx.Value(otelInvokeKey{}).(*otelInvoke)
+	return state
+}
+
+// OnBeforeInvoke starts the span of the invoke with gen_ai.request.* attributes
+func (h *OtelHook) OnBeforeInvoke(ctx context.Context, req *HookRequest) context.Context {
+	opts := req.Options
+	if opts == nil {
+		opts = &InvokeOptions{}
 	}
-	defer span.End()
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
+	state := &otelInvoke{start: time.Now(), attrs: []attribute.KeyValue{
+		attribute.String("gen_ai.operation.name", "chat"),
+		attribute.String("gen_ai.system", req.Provider),
+		attribute.String("gen_ai.request.model", opts.Model),
+	}}
+	attrs := append([]attribute.KeyValue{}, state.attrs...)
+	if opts.Temperature > 0 {
+		attrs = append(attrs, attribute.Float64("gen_ai.request.temperature", opts.Temperature))
+	}
+	if opts.TopP > 0 {
+		attrs = append(attrs, attribute.Float64("gen_ai.request.top_p", opts.TopP))
+	}
+	if opts.TopK > 0 {
+		attrs = append(attrs, attribute.Int("gen_ai.request.top_k", opts.TopK))
+	}
+	if opts.MaxTokens > 0 {
+		attrs = append(attrs, attribute.Int("gen_ai.request.max_tokens", opts.MaxTokens))
+	}
+	if opts.FrequencyPenalty != 0 {
+		attrs = append(attrs, attribute.Float64("gen_ai.request.frequency_penalty", opts.FrequencyPenalty))
 	}
+	if stops := append(append([]string{}, opts.Stop...), opts.StopWords...); len(stops) > 0 {
+		attrs = append(attrs, attribute.StringSlice("gen_ai.request.stop_sequences", stops))
+	}
+	if len(opts.Tools) > 0 {
+		names := make([]string, 0, len(opts.Tools))
+		for _, t := range opts.Tools {
+			if t.Function != nil {
+				names = append(names, t.Function.Name)
+			}
+		}
+		attrs = append(attrs, attribute.StringSlice("gen_ai.request.tools", names))
+	}
+	if opts.ResponseFormat != nil && opts.ResponseFormat.Type != ChatCompletionResponseFormatTypeText {
+		attrs = append(attrs, attribute.String("gen_ai.output.type", "json"))
+	}
+	attrs = append(attrs, attribute.Int("gen_ai.request.messages", len(req.Messages)))
+
+	ctx, state.span = h.tracer.Start(ctx, "chat "+opts.Model,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return context.WithValue(ctx, otelInvokeKey{}, state)
+}
+
+// OnAfterInvoke ends the span if the invoke failed
+func (h *OtelHook) OnAfterInvoke(ctx context.Context, err error) {
+	state := otelInvokeFrom(ctx)
+	if state == nil || err == nil {
+		return
+	}
+	errType := attribute.String("error.type", errorType(err))
+	h.duration.Record(ctx, time.Since(state.start).Seconds(),
+		metric.WithAttributes(append(slices.Clone(state.attrs), errType)...))
+	state.span.SetAttributes(errType)
+	state.span.RecordError(err)
+	state.span.SetStatus(codes.Error, err.Error())
+	state.span.End()
 }
 
-// OnBeforeInvoke ...
-func (h *OtelHook) OnBeforeInvoke(ctx context.Context) context.Context {
-	ctx, _ = h.tracer.Start(ctx, "llm/invoke", trace.WithSpanKind(trace.SpanKindInternal))
+// OnFirstChunk records time to first token
+func (h *OtelHook) OnFirstChunk(ctx context.Context, _ error) context.Context {
+	state := otelInvokeFrom(ctx)
+	if state == nil {
+		return ctx
+	}
+	h.ttft.Record(ctx, time.Since(state.start).Seconds(), metric.WithAttributes(state.attrs...))
+	state.span.AddEvent("gen_ai.first_chunk")
 	return ctx
 }
 
-// OnAfterInvoke ...
-func (h *OtelHook) OnAfterInvoke(ctx context.Context, err error) {
+// OnLastChunk sets gen_ai.response.* and gen_ai.usage.* attributes, records metrics and ends the span
+func (h *OtelHook) OnLastChunk(ctx context.Context, result *Result, err error) {
+	state := otelInvokeFrom(ctx)
+	if state == nil {
+		return
+	}
+	defer state.span.End()
+	attrs := slices.Clone(state.attrs)
+	if result != nil {
+		if result.Model != "" {
+			attrs = append(attrs, attribute.String("gen_ai.response.model", result.Model))
+		}
+		state.span.SetAttributes(attrs...)
+		if result.FinishReason != "" {
+			state.span.SetAttributes(attribute.StringSlice("gen_ai.response.finish_reasons", []string{result.FinishReason}))
+		}
+		usage := result.Usage
+		state.span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+			attribute.Int("gen_ai.usage.output_tokens", usage.CompletionTokens),
+		)
+		if usage.CacheReadTokens > 0 || usage.CacheWriteTokens > 0 {
+			state.span.SetAttributes(
+				attribute.Int("gen_ai.usage.cache_read_input_tokens", usage.CacheReadTokens),
+				attribute.Int("gen_ai.usage.cache_creation_input_tokens", usage.CacheWriteTokens),
+			)
+		}
+		h.tokenUsage.Record(ctx, int64(usage.PromptTokens),
+			metric.WithAttributes(append(attrs, attribute.String("gen_ai.token.type", "input"))...))
+		h.tokenUsage.Record(ctx, int64(usage.CompletionTokens),
+			metric.WithAttributes(append(attrs, attribute.String("gen_ai.token.type", "output"))...))
+		if result.Message != nil {
+			for _, call := range result.Message.ToolCalls {
+				state.span.AddEvent("gen_ai.tool.call", trace.WithAttributes(
+					attribute.String("gen_ai.tool.name", call.Function.Name),
+					attribute.String("gen_ai.tool.call.id", call.ID),
+				))
+			}
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.type", errorType(err)))
+		state.span.RecordError(err)
+		state.span.SetStatus(codes.Error, err.Error())
+	}
+	h.duration.Record(ctx, time.Since(state.start).Seconds(), metric.WithAttributes(attrs...))
+}
+
+// OnAttempt ...
+func (h *OtelHook) OnAttempt(ctx context.Context, attempt int, err error, backoff time.Duration) {
 	span := trace.SpanFromContext(ctx)
 	if !span.IsRecording() {
 		return
 	}
-	defer span.End()
-
-	attrs := make([]attribute.KeyValue, 0, 4)
+	attrs := []attribute.KeyValue{attribute.Int("llm.attempt", attempt)}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+	}
+	if backoff > 0 {
+		attrs = append(attrs, attribute.Int64("llm.retry.backoff_ms", backoff.Milliseconds()))
+	}
+	span.AddEvent("llm/attempt", trace.WithAttributes(attrs...))
+}
 
-	span.SetAttributes(attrs...)
-	switch err {
-	case nil,
-		driver.ErrSkip,
-		io.EOF, // end of rows iterator
-		sql.ErrNoRows:
-		// ignore
-	default:
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
+// errorType of error.type attribute
+func errorType(err error) string {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) && providerErr.Kind != nil {
+		return providerErr.Kind.Error()
 	}
+	return fmt.Sprintf("%T", err)
 }
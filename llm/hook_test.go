@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordHook struct {
+	request *HookRequest
+	first   int
+	result  *Result
+	err     error
+}
+
+func (h *recordHook) OnBeforeInvoke(ctx context.Context, req *HookRequest) context.Context {
+	h.request = req
+	return ctx
+}
+func (h *recordHook) OnAfterInvoke(ctx context.Context, err error) {}
+func (h *recordHook) OnFirstChunk(ctx context.Context, _ error) context.Context {
+	h.first++
+	return ctx
+}
+func (h *recordHook) OnLastChunk(ctx context.Context, result *Result, err error) {
+	h.result = result
+	h.err = err
+}
+
+func TestHook_RequestAndResult(t *testing.T) {
+	hook := &recordHook{}
+	tool := &Tool{Type: "function", Function: &FunctionDefinition{Name: "weather"}}
+	instance := NewInstance("scripted", WithProvider(&toolCallProvider{}), WithHook(hook, NewOtelHook()),
+		WithDefaultModel("scripted-chat"))
+	response, err := instance.Invoke(context.Background(), []Message{NewUserTextMessage("weather of Beijing")},
+		WithTools(tool), WithTemperature(0.2))
+	assert.NoError(t, err)
+	result := response.Result()
+
+	assert.Equal(t, "scripted", hook.request.Provider)
+	assert.Equal(t, "scripted-chat", hook.request.Options.Model)
+	assert.Equal(t, 0.2, hook.request.Options.Temperature)
+	assert.Len(t, hook.request.Options.Tools, 1)
+
+	assert.Equal(t, 1, hook.first)
+	assert.Equal(t, "tool_calls", hook.result.FinishReason)
+	assert.Equal(t, 10, hook.result.Usage.TotalTokens)
+	assert.Len(t, hook.result.Message.ToolCalls, 1)
+	assert.Equal(t, `{"city":"Beijing"}`, hook.result.Message.ToolCalls[0].Function.Arguments)
+	// chunks are not merged twice
+	assert.Equal(t, `{"city":"Beijing"}`, result.Message.ToolCalls[0].Function.Arguments)
+}
+
+func TestHook_StreamError(t *testing.T) {
+	hook := &recordHook{}
+	failure := &ProviderError{Kind: ErrTransient, Message: "overloaded_error: Overloaded"}
+	instance := NewInstance("scripted", WithProvider(&fakeProvider{fail: failure}), WithHook(hook, NewOtelHook()))
+	response, err := instance.Invoke(context.Background(), []Message{NewUserTextMessage("hi")}, WithStream(true))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, response.Result().Err, ErrTransient)
+	assert.ErrorIs(t, hook.err, ErrTransient) // the span ends as failed
+	assert.Equal(t, 3, hook.result.Usage.PromptTokens)
+}
@@ -3,6 +3,10 @@ package hunyuan
 import (
 	"context"
 	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/showntop/llmack/llm"
 
@@ -62,11 +66,8 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 	request.Model = &opts.Model
 	// 返回的resp是一个ChatCompletionsResponse的实例，与请求对象对应
 	chatResponse, err := m.client.ChatCompletions(request)
-	if _, ok := err.(*errors.TencentCloudSDKError); ok {
-		return nil, err
-	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("hunyuan chat completions request error: %w", providerError(err))
 	}
 	// 流式响应
 	response := llm.NewStreamResponse()
@@ -76,6 +77,10 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 		currentTool := llm.ToolCall{}
 		toolCalls := []llm.ToolCall{}
 		for event := range chatResponse.Events {
+			if event.Err != nil {
+				response.Stream().Push(llm.NewErrorChunk(providerError(event.Err)))
+				return
+			}
 			chunk := event.Data
 			var data SSEData
 			json.Unmarshal(chunk, &data)
@@ -108,6 +113,38 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 	return response, nil
 }
 
+// errorStatus http status of the error code prefixes of tencent cloud
+var errorStatus = []struct {
+	prefix string
+	status int
+}{
+	{"RequestLimitExceeded", http.StatusTooManyRequests},
+	{"LimitExceeded", http.StatusTooManyRequests},
+	{"AuthFailure", http.StatusUnauthorized},
+	{"UnauthorizedOperation", http.StatusForbidden},
+	{"InternalError", http.StatusInternalServerError},
+	{"ResourceUnavailable", http.StatusServiceUnavailable},
+	{"FailedOperation.EngineRequestTimeout", http.StatusServiceUnavailable},
+	{"FailedOperation.EngineServerError", http.StatusServiceUnavailable},
+	{"ClientError.NetworkError", http.StatusServiceUnavailable},
+}
+
+// providerError classifies the sdk error by code, others are transport errors
+func providerError(err error) error {
+	var sdkErr *errors.TencentCloudSDKError
+	if !stderrors.As(err, &sdkErr) {
+		return llm.NewTransportError(err)
+	}
+	status := 0
+	for _, it := range errorStatus {
+		if strings.HasPrefix(sdkErr.Code, it.prefix) {
+			status = it.status
+			break
+		}
+	}
+	return llm.NewStatusError(status, nil, sdkErr.Code+": "+sdkErr.Message)
+}
+
 type SSEData struct {
 	Note    string
 	Choices []struct {
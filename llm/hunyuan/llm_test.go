@@ -0,0 +1,18 @@
+package hunyuan
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+)
+
+func TestProviderError(t *testing.T) {
+	assert.ErrorIs(t, providerError(errors.NewTencentCloudSDKError("RequestLimitExceeded", "too many requests", "")), llm.ErrRateLimited)
+	assert.ErrorIs(t, providerError(errors.NewTencentCloudSDKError("AuthFailure.SignatureFailure", "bad signature", "")), llm.ErrAuthFailed)
+	assert.ErrorIs(t, providerError(errors.NewTencentCloudSDKError("FailedOperation.EngineServerError", "engine error", "")), llm.ErrTransient)
+	err := providerError(errors.NewTencentCloudSDKError("InvalidParameter", "bad model", ""))
+	assert.False(t, stderrors.Is(err, llm.ErrTransient))
+}
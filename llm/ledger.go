@@ -0,0 +1,276 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrBudgetExceeded ...
+var ErrBudgetExceeded = errors.New("llm budget exceeded")
+
+// ErrCurrencyMismatch is returned by Ledger.Record when the price currency differs from the recorded one
+var ErrCurrencyMismatch = errors.New("llm ledger currency mismatch")
+
+// BudgetExceededError is returned by Instance.Invoke once the ledger in context is over budget
+type BudgetExceededError struct {
+	Budget Budget
+	Spent  LedgerEntry
+}
+
+// Error ...
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("%s: spent %d tokens / %.6f %s, budget %d tokens / %.6f",
+		ErrBudgetExceeded, e.Spent.TotalTokens, e.Spent.Cost, e.Spent.Currency, e.Budget.MaxTokens, e.Budget.MaxCost)
+}
+
+// Unwrap ...
+func (e *BudgetExceededError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// Price 模型单价，单位为每百万 token
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	CacheRead  float64 `json:"cache_read"`  // price of prompt tokens read from cache, Prompt if zero
+	CacheWrite float64 `json:"cache_write"` // price of prompt tokens written to cache, Prompt if zero
+	Currency   string  `json:"currency"`
+}
+
+// cost of usage, cached prompt tokens are priced separately
+func (p Price) cost(usage Usage) float64 {
+	cacheRead, cacheWrite := p.CacheRead, p.CacheWrite
+	if cacheRead <= 0 {
+		cacheRead = p.Prompt
+	}
+	if cacheWrite <= 0 {
+		cacheWrite = p.Prompt
+	}
+	uncached := max(usage.PromptTokens-usage.CacheReadTokens-usage.CacheWriteTokens, 0)
+	return (float64(uncached)*p.Prompt +
+		float64(usage.CacheReadTokens)*cacheRead +
+		float64(usage.CacheWriteTokens)*cacheWrite +
+		float64(usage.CompletionTokens)*p.Completion) / 1e6
+}
+
+// PriceTable keyed by "provider/model" or "model"
+type PriceTable map[string]Price
+
+// DefaultPriceTable used by ledgers created without WithPriceTable
+var DefaultPriceTable = PriceTable{}
+
+func (t PriceTable) lookup(provider, model string) (Price, bool) {
+	if price, ok := t[provider+"/"+model]; ok {
+		return price, true
+	}
+	price, ok := t[model]
+	return price, ok
+}
+
+// Budget zero value means unlimited
+type Budget struct {
+	MaxTokens int     `json:"max_tokens"`
+	MaxCost   float64 `json:"max_cost"`
+}
+
+func (b Budget) exceeded(spent LedgerEntry) bool {
+	return (b.MaxTokens > 0 && spent.TotalTokens >= b.MaxTokens) ||
+		(b.MaxCost > 0 && spent.Cost >= b.MaxCost)
+}
+
+// UsageKey dimensions of usage accounting
+type UsageKey struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Agent    string `json:"agent"`
+	Session  string `json:"session"`
+}
+
+// LedgerEntry accumulated usage and cost
+type LedgerEntry struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	Cost             float64 `json:"cost"`
+	Currency         string  `json:"currency"`
+}
+
+func (e *LedgerEntry) add(o LedgerEntry) {
+	e.PromptTokens += o.PromptTokens
+	e.CompletionTokens += o.CompletionTokens
+	e.TotalTokens += o.TotalTokens
+	e.CacheReadTokens += o.CacheReadTokens
+	e.CacheWriteTokens += o.CacheWriteTokens
+	e.Cost += o.Cost
+	if e.Currency == "" {
+		e.Currency = o.Currency
+	}
+}
+
+// Usage converts entry to llm.Usage
+func (e LedgerEntry) Usage() Usage {
+	return Usage{
+		PromptTokens:     e.PromptTokens,
+		CompletionTokens: e.CompletionTokens,
+		TotalTokens:      e.TotalTokens,
+		Currency:         e.Currency,
+		CacheReadTokens:  e.CacheReadTokens,
+		CacheWriteTokens: e.CacheWriteTokens,
+	}
+}
+
+// Ledger 用量账本，通过 context 在 llm、program、agent 之间传递。
+// 子账本的记录会同时累加到父账本，任一层超出预算都会中止调用。
+type Ledger struct {
+	mu      sync.Mutex
+	parent  *Ledger
+	prices  PriceTable
+	budget  Budget
+	entries map[UsageKey]*LedgerEntry
+	total   LedgerEntry
+}
+
+// LedgerOption ...
+type LedgerOption func(*Ledger)
+
+// WithPriceTable ...
+func WithPriceTable(prices PriceTable) LedgerOption {
+	return func(l *Ledger) {
+		l.prices = prices
+	}
+}
+
+// WithBudget ...
+func WithBudget(budget Budget) LedgerOption {
+	return func(l *Ledger) {
+		l.budget = budget
+	}
+}
+
+// NewLedger ...
+func NewLedger(opts ...LedgerOption) *Ledger {
+	l := &Ledger{
+		prices:  DefaultPriceTable,
+		entries: make(map[UsageKey]*LedgerEntry),
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// Child creates a ledger whose records also accumulate to l
+func (l *Ledger) Child(opts ...LedgerOption) *Ledger {
+	child := NewLedger(append([]LedgerOption{WithPriceTable(l.prices)}, opts...)...)
+	child.parent = l
+	return child
+}
+
+// Record accounts usage of one llm invoke, agent and session are read from context.
+// A ledger sums cost in one currency, usage priced in another currency is accounted without cost
+// and ErrCurrencyMismatch is returned.
+func (l *Ledger) Record(ctx context.Context, provider, model string, usage Usage) (LedgerEntry, error) {
+	key := UsageKey{Provider: provider, Model: model}
+	if scope, ok := ctx.Value(usageScopeKey{}).(usageScope); ok {
+		key.Agent = scope.agent
+		key.Session = scope.session
+	}
+	entry := LedgerEntry{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		CacheReadTokens:  usage.CacheReadTokens,
+		CacheWriteTokens: usage.CacheWriteTokens,
+	}
+	if entry.TotalTokens == 0 {
+		entry.TotalTokens = entry.PromptTokens + entry.CompletionTokens
+	}
+	if price, ok := l.prices.lookup(provider, model); ok {
+		entry.Cost = price.cost(usage)
+		entry.Currency = price.Currency
+	}
+	var err error
+	for it := l; it != nil; it = it.parent {
+		if e := it.add(key, entry); e != nil && err == nil {
+			err = e
+		}
+	}
+	return entry, err
+}
+
+func (l *Ledger) add(key UsageKey, entry LedgerEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var err error
+	if entry.Currency != "" && l.total.Currency != "" && entry.Currency != l.total.Currency {
+		err = fmt.Errorf("%w: %s/%s priced in %s, ledger in %s",
+			ErrCurrencyMismatch, key.Provider, key.Model, entry.Currency, l.total.Currency)
+		entry.Cost, entry.Currency = 0, ""
+	}
+	if l.entries[key] == nil {
+		l.entries[key] = &LedgerEntry{}
+	}
+	l.entries[key].add(entry)
+	l.total.add(entry)
+	return err
+}
+
+// Check returns *BudgetExceededError if l or any parent is over budget
+func (l *Ledger) Check() error {
+	for it := l; it != nil; it = it.parent {
+		it.mu.Lock()
+		budget, spent := it.budget, it.total
+		it.mu.Unlock()
+		if budget.exceeded(spent) {
+			return &BudgetExceededError{Budget: budget, Spent: spent}
+		}
+	}
+	return nil
+}
+
+// Total ...
+func (l *Ledger) Total() LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// Entries returns a copy of usage per provider, model, agent and session
+func (l *Ledger) Entries() map[UsageKey]LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make(map[UsageKey]LedgerEntry, len(l.entries))
+	for k, v := range l.entries {
+		entries[k] = *v
+	}
+	return entries
+}
+
+type ledgerKey struct{}
+
+type usageScopeKey struct{}
+
+type usageScope struct {
+	agent   string
+	session string
+}
+
+// WithLedger ...
+func WithLedger(ctx context.Context, l *Ledger) context.Context {
+	return context.WithValue(ctx, ledgerKey{}, l)
+}
+
+// LedgerFrom returns ledger in context, nil if none
+func LedgerFrom(ctx context.Context) *Ledger {
+	l, _ := ctx.Value(ledgerKey{}).(*Ledger)
+	return l
+}
+
+// WithUsageScope labels the usage recorded under ctx with agent and session
+func WithUsageScope(ctx context.Context, agent, session string) context.Context {
+	return context.WithValue(ctx, usageScopeKey{}, usageScope{agent: agent, session: session})
+}
@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedger_RecordAndBudget(t *testing.T) {
+	root := NewLedger(
+		WithPriceTable(PriceTable{"deepseek-chat": {Prompt: 2, Completion: 8, Currency: "CNY"}}),
+		WithBudget(Budget{MaxTokens: 1500}),
+	)
+	child := root.Child()
+
+	ctx := WithUsageScope(WithLedger(context.Background(), child), "writer", "s1")
+	entry, err := LedgerFrom(ctx).Record(ctx, "deepseek", "deepseek-chat", Usage{PromptTokens: 1000, CompletionTokens: 500})
+	assert.NoError(t, err)
+	assert.Equal(t, 1500, entry.TotalTokens)
+	assert.InDelta(t, 0.006, entry.Cost, 1e-9)
+
+	assert.Equal(t, root.Total(), child.Total())
+	assert.Equal(t, 1500, root.Entries()[UsageKey{Provider: "deepseek", Model: "deepseek-chat", Agent: "writer", Session: "s1"}].TotalTokens)
+
+	err = child.Check() // parent budget applies to child
+	var budgetErr *BudgetExceededError
+	assert.True(t, errors.As(err, &budgetErr))
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+
+	_, err = NewInstance(MockLLMModelName).Invoke(ctx, []Message{NewUserTextMessage("hi")}, WithStream(true))
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+}
+
+func TestLedger_CurrencyMismatch(t *testing.T) {
+	ledger := NewLedger(WithPriceTable(PriceTable{
+		"deepseek-chat": {Prompt: 2, Completion: 8, Currency: "CNY"},
+		"gpt-4o":        {Prompt: 2.5, Completion: 10, Currency: "USD"},
+	}))
+	ctx := context.Background()
+	_, err := ledger.Record(ctx, "deepseek", "deepseek-chat", Usage{PromptTokens: 1000, CompletionTokens: 500})
+	assert.NoError(t, err)
+	entry, err := ledger.Record(ctx, "openai", "gpt-4o", Usage{PromptTokens: 1000})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	assert.Equal(t, "USD", entry.Currency)
+
+	total := ledger.Total() // tokens are accounted, the cost in USD is not added to CNY
+	assert.Equal(t, 2500, total.TotalTokens)
+	assert.InDelta(t, 0.006, total.Cost, 1e-9)
+	assert.Equal(t, "CNY", total.Currency)
+	assert.Zero(t, ledger.Entries()[UsageKey{Provider: "openai", Model: "gpt-4o"}].Cost)
+}
@@ -2,7 +2,9 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
 type logger interface {
@@ -39,12 +41,15 @@ func Register(name string, provider ProviderConstructor) {
 
 // Options ...
 type Options struct {
-	baseURL string
-	apiKey  string
-	hooks   []Hook
-	cache   Cache
-	logger  logger
-	model   string
+	baseURL  string
+	apiKey   string
+	hooks    []Hook
+	cache    Cache
+	logger   logger
+	model    string
+	provider Provider
+	retry    *RetryPolicy
+	cassette *Cassette
 	*InvokeOptions
 }
 
@@ -91,6 +96,27 @@ func WithDefaultModel(m string) Option {
 	}
 }
 
+// WithProvider use the provider instance instead of the registered one, e.g. a Router
+func WithProvider(p Provider) Option {
+	return func(options *Options) {
+		options.provider = p
+	}
+}
+
+// WithRetryPolicy retry provider invoke on transient and rate limited errors
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(options *Options) {
+		options.retry = p
+	}
+}
+
+// WithCassette records to or replays from the cassette, see NewCassette
+func WithCassette(c *Cassette) Option {
+	return func(options *Options) {
+		options.cassette = c
+	}
+}
+
 // WithLogger ...
 func WithLogger(l logger) Option {
 	return func(options *Options) {
@@ -111,11 +137,29 @@ func NewInstance(provider string, opts ...Option) *Instance {
 		ApiKey:  options.apiKey,
 	}
 
-	return &Instance{
-		name:     provider,
-		opts:     &options,
-		provider: providers[provider](po),
+	instance := &Instance{
+		name: provider,
+		opts: &options,
+	}
+	if options.provider != nil {
+		instance.provider = options.provider
+	} else if constructor, ok := providers[provider]; ok {
+		instance.provider = constructor(po)
 	}
+	if options.cassette != nil {
+		instance.provider = options.cassette.Wrap(instance.provider)
+	}
+	return instance
+}
+
+// Name of the provider
+func (mi *Instance) Name() string {
+	return mi.name
+}
+
+// Model returns the default model
+func (mi *Instance) Model() string {
+	return mi.opts.model
 }
 
 // Invoke ...
@@ -128,9 +172,9 @@ func (mi *Instance) Invoke(ctx context.Context,
 			i--
 		}
 	}
-	invokeOpts := mi.opts.InvokeOptions // default invoke options
-	if invokeOpts == nil {
-		invokeOpts = &InvokeOptions{}
+	invokeOpts := &InvokeOptions{}
+	if mi.opts.InvokeOptions != nil { // copy default invoke options, do not leak per invoke options
+		*invokeOpts = *mi.opts.InvokeOptions
 	}
 	for i := range options {
 		if options[i] == nil {
@@ -146,26 +190,96 @@ func (mi *Instance) InvokeWithOptions(ctx context.Context,
 	if mi.provider == nil {
 		return nil, fmt.Errorf("llm provider of %v is not registered", mi.name)
 	}
-	if mi.opts != nil && mi.opts.hooks != nil {
+	if invokeOpts.Model == "" {
+		invokeOpts.Model = mi.opts.model
+	}
+	for _, hook := range mi.opts.hooks {
+		ctx = hook.OnBeforeInvoke(ctx, &HookRequest{Provider: mi.name, Messages: messages, Options: invokeOpts})
+	}
+	var response *Response
+	var err error
+	if format := invokeOpts.ResponseFormat; format != nil && format.Type != ChatCompletionResponseFormatTypeText &&
+		!mi.supportsResponseFormat(format.Type) {
+		response, err = mi.invokeStructured(ctx, messages, invokeOpts)
+	} else {
+		response, err = mi.invoke(ctx, messages, invokeOpts)
+	}
+	for _, hook := range mi.opts.hooks {
+		hook.OnAfterInvoke(ctx, err)
+	}
+	if err != nil {
+		return response, err
+	}
+	return mi.observe(ctx, response), nil
+}
+
+// observe notifies hooks of the first chunk and the merged result of response
+func (mi *Instance) observe(ctx context.Context, response *Response) *Response {
+	if len(mi.opts.hooks) <= 0 {
+		return response
+	}
+	if response == nil || response.stream == nil { // block response
+		var result *Result
+		if response != nil {
+			result = response.result
+		}
 		for _, hook := range mi.opts.hooks {
-			ctx = hook.OnBeforeInvoke(ctx)
+			ctx = hook.OnFirstChunk(ctx, nil)
+		}
+		var err error
+		if result != nil {
+			err = result.Err
 		}
-	}
-	response, err := mi.invoke(ctx, messages, invokeOpts)
-	if mi.opts != nil && mi.opts.hooks != nil {
 		for _, hook := range mi.opts.hooks {
-			hook.OnAfterInvoke(ctx, err)
+			hook.OnLastChunk(ctx, result, err)
 		}
+		return response
 	}
-	return response, err
+	observed := NewStreamResponse()
+	go func() {
+		defer observed.stream.Close()
+		builder := &resultBuilder{}
+		firstChunk := true
+		var err error // the first error in the middle of stream, see Chunk.Err
+		for chunk := response.stream.Take(); chunk != nil; chunk = response.stream.Take() {
+			if firstChunk {
+				for _, hook := range mi.opts.hooks {
+					ctx = hook.OnFirstChunk(ctx, nil)
+				}
+				firstChunk = false
+			}
+			if err == nil {
+				err = chunk.Err
+			}
+			builder.add(chunk)
+			observed.stream.Push(chunk)
+		}
+		result := builder.build()
+		for _, hook := range mi.opts.hooks {
+			hook.OnLastChunk(ctx, result, err)
+		}
+	}()
+	return observed
 }
 
 func (mi *Instance) invoke(ctx context.Context,
 	messages []Message, invokeOpts *InvokeOptions) (*Response, error) {
 
+	if ledger := LedgerFrom(ctx); ledger != nil { // stop the run once over budget
+		if err := ledger.Check(); err != nil {
+			return nil, err
+		}
+	}
+
+	if invokeOpts.Model == "" {
+		invokeOpts.Model = mi.opts.model
+	}
+
 	updateCache := func(ctx context.Context, result string) {} // nothing todo
 
 	if mi.opts.cache != nil && len(invokeOpts.Tools) <= 0 { // fetch from cache
+		// answers are isolated per provider, model and system prompt
+		ctx := WithCacheNamespace(ctx, cacheNamespace(mi.name, invokeOpts.Model, messages))
 		document, hited, err := mi.opts.cache.Fetch(ctx, messages)
 		if err != nil {
 			return nil, err
@@ -186,25 +300,64 @@ func (mi *Instance) invoke(ctx context.Context,
 
 	}
 
-	if invokeOpts.Model == "" {
-		invokeOpts.Model = mi.opts.model
-	}
-
-	response, err := mi.provider.Invoke(ctx, messages, invokeOpts)
+	response, err := mi.invokeProvider(ctx, messages, invokeOpts)
 	if err != nil {
 		return response, err
 	}
 
-	if invokeOpts.Stream {
-		return mi.handleStreamResponse(ctx, response, updateCache), nil
+	if invokeOpts.Stream || (response != nil && response.result == nil && response.stream != nil) {
+		return mi.handleStreamResponse(ctx, response, invokeOpts.Model, updateCache), nil
 	}
 
-	return mi.handleBlockResponse(ctx, response, updateCache), nil
+	return mi.handleBlockResponse(ctx, response, invokeOpts.Model, updateCache), nil
+}
+
+// recordUsage accounts usage to the ledger in context
+func (mi *Instance) recordUsage(ctx context.Context, model string, usage Usage) {
+	ledger := LedgerFrom(ctx)
+	if ledger == nil {
+		return
+	}
+	entry, err := ledger.Record(ctx, mi.name, model, usage)
+	if err != nil {
+		mi.opts.logger.WarnContextf(ctx, "llm usage record error: %v", err)
+	}
+	mi.opts.logger.DebugContextf(ctx, "llm usage recorded %s/%s %+v", mi.name, model, entry)
 }
 
-func (mi *Instance) handleBlockResponse(ctx context.Context, response *Response,
+// invokeProvider invoke provider with retry policy, notify AttemptHook of each attempt
+func (mi *Instance) invokeProvider(ctx context.Context,
+	messages []Message, invokeOpts *InvokeOptions) (*Response, error) {
+	policy := mi.opts.retry
+	for attempt := 1; ; attempt++ {
+		response, err := mi.provider.Invoke(ctx, messages, invokeOpts)
+		retry := err != nil && policy != nil && attempt < policy.MaxAttempts && policy.retryable(err)
+		var backoff time.Duration
+		if retry {
+			backoff = policy.backoff(attempt, err)
+		}
+		for _, hook := range mi.opts.hooks {
+			if h, ok := hook.(AttemptHook); ok {
+				h.OnAttempt(ctx, attempt, err, backoff)
+			}
+		}
+		if !retry {
+			return response, err
+		}
+		mi.opts.logger.WarnContextf(ctx, "llm invoke attempt %d failed, retry after %s: %v", attempt, backoff, err)
+		if werr := policy.wait(ctx, backoff); werr != nil {
+			return nil, errors.Join(err, werr)
+		}
+	}
+}
+
+func (mi *Instance) handleBlockResponse(ctx context.Context, response *Response, model string,
 	updateCache func(context.Context, string)) *Response {
-	if response == nil || response.result == nil || response.result.Message == nil {
+	if response == nil || response.result == nil {
+		return response
+	}
+	mi.recordUsage(ctx, model, response.result.Usage)
+	if response.result.Message == nil {
 		return response
 	}
 	// todo
@@ -215,7 +368,7 @@ func (mi *Instance) handleBlockResponse(ctx context.Context, response *Response,
 	return response
 }
 
-func (mi *Instance) handleStreamResponse(ctx context.Context, response *Response,
+func (mi *Instance) handleStreamResponse(ctx context.Context, response *Response, model string,
 	updateCache func(context.Context, string)) *Response {
 	newResp := NewStreamResponse()
 
@@ -226,31 +379,28 @@ func (mi *Instance) handleStreamResponse(ctx context.Context, response *Response
 		defer newResp.stream.Close()
 		// 倒腾一遍，for metrics and trace ... and cache
 		result := ""
-		firstChunk := true
+		usage := Usage{}
+		var err error
 
 		for chunk := response.stream.Take(); chunk != nil; chunk = response.stream.Take() {
-			if firstChunk {
-				for _, hook := range mi.opts.hooks {
-					ctx = hook.OnFirstChunk(ctx, nil)
-				}
-			}
 			// if len(chunk.Choices) <= 0 {
 			// 	mi.opts.logger.WarnContextf(ctx, "llm stream response chunk choices is empty")
 			// 	continue
 			// }
-			firstChunk = false
 			newResp.stream.Push(chunk)
+			usage.add(chunk.Usage)
+			if chunk.Err != nil {
+				err = chunk.Err
+			}
 			if len(chunk.Choices) > 0 {
 				result += chunk.Choices[0].Delta.ReasoningContent
 				result += chunk.Choices[0].Delta.content
 			}
 		}
-		if updateCache != nil {
+		mi.recordUsage(ctx, model, usage)
+		if updateCache != nil && err == nil { // the partial answer of failed stream is not cached
 			updateCache(ctx, result)
 		}
-		for _, hook := range mi.opts.hooks {
-			hook.OnLastChunk(ctx, nil)
-		}
 	}()
 	return newResp
 }
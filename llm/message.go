@@ -18,6 +18,14 @@ const (
 type MultipartContent struct {
 	Type string
 	Data any
+	// Cache marks this part as a cache breakpoint
+	Cache *CacheControl
+}
+
+// WithCache marks the part as a cache breakpoint
+func (c *MultipartContent) WithCache(cc *CacheControl) *MultipartContent {
+	c.Cache = cc
+	return c
 }
 
 func MultipartContentImageURL(url string) *MultipartContent {
@@ -68,6 +76,12 @@ type PromptMessage struct {
 	content          string              // string | []*PromptMessageContent
 	multiPartContent []*MultipartContent // string | []*PromptMessageContent
 	Name             string
+	cacheControl     *CacheControl
+}
+
+// CacheControl ...
+func (m PromptMessage) CacheControl() *CacheControl {
+	return m.cacheControl
 }
 
 func (m PromptMessage) Content() string {
@@ -174,6 +188,8 @@ type AssistantMessage struct {
 	PromptMessage
 	ToolCalls        []*ToolCall `json:"tool_calls"`
 	ReasoningContent string      `json:"reasoning_content"`
+	// ReasoningSignature signature of reasoning content, anthropic requires it to send thinking back
+	ReasoningSignature string `json:"reasoning_signature,omitempty"`
 }
 
 func (m AssistantMessage) GetToolCalls() []*ToolCall {
@@ -0,0 +1,103 @@
+package llm
+
+import "unicode"
+
+// MessageRecord serializable form of Message, e.g. to persist conversation history
+type MessageRecord struct {
+	Role               MessageRole         `json:"role"`
+	Content            string              `json:"content,omitempty"`
+	Multipart          []*MultipartContent `json:"multipart,omitempty"`
+	Name               string              `json:"name,omitempty"`
+	ToolCalls          []*ToolCall         `json:"tool_calls,omitempty"`
+	ToolCallID         string              `json:"tool_call_id,omitempty"`
+	ReasoningContent   string              `json:"reasoning_content,omitempty"`
+	ReasoningSignature string              `json:"reasoning_signature,omitempty"`
+}
+
+// NewMessageRecord ...
+func NewMessageRecord(m Message) *MessageRecord {
+	record := &MessageRecord{
+		Role:       m.Role(),
+		Content:    m.Content(),
+		Multipart:  m.MultipartContent(),
+		ToolCalls:  m.GetToolCalls(),
+		ToolCallID: m.ToolID(),
+	}
+	switch m := m.(type) {
+	case PromptMessage:
+		record.Name = m.Name
+	case *AssistantMessage:
+		record.Name = m.Name
+		record.ReasoningContent = m.ReasoningContent
+		record.ReasoningSignature = m.ReasoningSignature
+	}
+	return record
+}
+
+// Message restores the message of record
+func (r *MessageRecord) Message() Message {
+	switch r.Role {
+	case MessageRoleAssistant:
+		m := NewAssistantMessage(r.Content)
+		m.Name = r.Name
+		m.ToolCalls = r.ToolCalls
+		m.ReasoningContent = r.ReasoningContent
+		m.ReasoningSignature = r.ReasoningSignature
+		return m
+	case MessageRoleTool:
+		return NewToolMessage(r.Content, r.ToolCallID)
+	default:
+		return PromptMessage{role: r.Role, content: r.Content, multiPartContent: r.Multipart, Name: r.Name}
+	}
+}
+
+// NewMessageRecords ...
+func NewMessageRecords(messages []Message) []*MessageRecord {
+	records := make([]*MessageRecord, 0, len(messages))
+	for _, m := range messages {
+		records = append(records, NewMessageRecord(m))
+	}
+	return records
+}
+
+// RestoreMessages ...
+func RestoreMessages(records []*MessageRecord) []Message {
+	messages := make([]Message, 0, len(records))
+	for _, r := range records {
+		messages = append(messages, r.Message())
+	}
+	return messages
+}
+
+// EstimateTokens estimates tokens of messages without tokenizer,
+// a Han character counts as one token and other characters count as a quarter.
+func EstimateTokens(messages ...Message) int {
+	tokens := 0
+	for _, m := range messages {
+		others := 0
+		count := func(text string) {
+			for _, r := range text {
+				if unicode.Is(unicode.Han, r) {
+					tokens++
+				} else {
+					others++
+				}
+			}
+		}
+		count(m.Content())
+		if am, ok := m.(*AssistantMessage); ok {
+			count(am.ReasoningContent)
+		}
+		for _, call := range m.GetToolCalls() {
+			count(call.Function.Name)
+			count(call.Function.Arguments)
+		}
+		for _, part := range m.MultipartContent() {
+			if text, ok := part.Data.(string); ok {
+				count(text)
+			}
+		}
+		tokens += (others+3)/4 + 4 // role and separators
+	}
+	return tokens
+}
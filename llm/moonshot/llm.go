@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"strings"
 
 	"github.com/northes/go-moonshot"
 	"github.com/showntop/llmack/llm"
@@ -63,7 +65,7 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 
 	resp, err := m.client.Chat().CompletionsStream(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("moonshot chat completions request error: %w", providerError(err))
 	}
 	// 流式响应
 	response := llm.NewStreamResponse()
@@ -73,8 +75,8 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 		for receive := range resp.Receive() {
 			msg, err := receive.GetMessage()
 			if err != nil {
-				if errors.Is(err, io.EOF) {
-					break
+				if !errors.Is(err, io.EOF) {
+					response.Stream().Push(llm.NewErrorChunk(providerError(err)))
 				}
 				break
 			}
@@ -84,6 +86,25 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 	return response, nil
 }
 
+// errorStatus http status of the error types of moonshot
+var errorStatus = map[string]int{
+	"rate_limit_reached_error":     http.StatusTooManyRequests,
+	"invalid_authentication_error": http.StatusUnauthorized,
+	"permission_denied_error":      http.StatusForbidden,
+	"server_error":                 http.StatusInternalServerError,
+	"engine_overloaded_error":      http.StatusServiceUnavailable,
+}
+
+// providerError classifies the api error "[type]message" of go-moonshot by type, others are transport errors
+func providerError(err error) error {
+	message := err.Error()
+	typ, _, ok := strings.Cut(strings.TrimPrefix(message, "["), "]")
+	if !strings.HasPrefix(message, "[") || !ok {
+		return llm.NewTransportError(err)
+	}
+	return llm.NewStatusError(errorStatus[typ], nil, message)
+}
+
 func (m *LLM) setupClient() error {
 	config, _ := llm.Config.Get(Name).(map[string]any)
 	if config == nil {
@@ -0,0 +1,16 @@
+package moonshot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderError(t *testing.T) {
+	assert.ErrorIs(t, providerError(errors.New("[rate_limit_reached_error]max RPM reached")), llm.ErrRateLimited)
+	assert.ErrorIs(t, providerError(errors.New("[engine_overloaded_error]overloaded")), llm.ErrTransient)
+	assert.ErrorIs(t, providerError(errors.New("[invalid_request_error]Invalid request: Your request exceeded model token limit")), llm.ErrContextOverflow)
+	assert.ErrorIs(t, providerError(errors.New("connection reset by peer")), llm.ErrTransient)
+}
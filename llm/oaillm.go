@@ -18,7 +18,8 @@ type OAILLM struct {
 	baseURL string
 	apiKey  string
 
-	client *http.Client
+	client       *http.Client
+	cacheControl bool // send cache_control of messages, e.g. qwen explicit cache
 }
 
 func NewOAILLM(url, apiKey string) *OAILLM {
@@ -55,6 +56,17 @@ func (o *OAILLM) Invoke(ctx context.Context, messages []Message, options *Invoke
 	return o.handleStreamResponse(body)
 }
 
+// WithCacheControl sends cache breakpoints of messages as cache_control of content parts
+func (o *OAILLM) WithCacheControl(enable bool) *OAILLM {
+	o.cacheControl = enable
+	return o
+}
+
+// SupportsResponseFormat openai compatible api supports json_object and json_schema
+func (o *OAILLM) SupportsResponseFormat(t ChatCompletionResponseFormatType) bool {
+	return true
+}
+
 // ChatCompletions ...
 func (o *OAILLM) ChatCompletions(ctx context.Context, req ChatCompletionRequest) (io.ReadCloser, error) {
 	payload, err := json.Marshal(req)
@@ -74,11 +86,12 @@ func (o *OAILLM) ChatCompletions(ctx context.Context, req ChatCompletionRequest)
 	httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
 	resp, err := o.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("oaillm chat completions request error %s", err)
+		return nil, fmt.Errorf("oaillm chat completions request error: %w", NewTransportError(err))
 	}
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		raw, _ := io.ReadAll(resp.Body)
-		return nil, errors.New("oaillm chat completions request statuserror " + resp.Status + ": " + string(raw))
+		return nil, fmt.Errorf("oaillm chat completions request statuserror: %w", NewStatusError(resp.StatusCode, resp.Header, string(raw)))
 	}
 
 	return resp.Body, nil
@@ -112,6 +125,10 @@ func (o *OAILLM) buildRequest(messages []Message, options *InvokeOptions) ChatCo
 		msg.ToolCalls = m.GetToolCalls()
 		msg.Content = m.Content()
 		msg.MultipartContent = m.MultipartContent()
+		if o.cacheControl {
+			msg.cacheControl = true
+			msg.CacheControl = CacheControlOf(m)
+		}
 		chatMessages = append(chatMessages, msg)
 	}
 	request["messages"] = chatMessages
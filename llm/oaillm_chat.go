@@ -18,6 +18,10 @@ type ChatCompletionMessage struct {
 	ToolCalls []*ToolCall `json:"tool_calls,omitempty"`
 	// For Role=tool prompts this should be set to the ID given in the assistant's prior request to call a tool.
 	ToolCallID string `json:"tool_call_id,omitempty"`
+	// CacheControl cache breakpoint of the message, sent as cache_control of the last content part
+	CacheControl *CacheControl `json:"-"`
+
+	cacheControl bool // whether provider accepts cache_control
 }
 
 // 序列化 ChatCompletionMessage
@@ -32,6 +36,9 @@ func (c *ChatCompletionMessage) MarshalJSON() ([]byte, error) {
 	if c.Content != "" {
 		xxx.Content = c.Content
 	}
+	if c.cacheControl && c.CacheControl != nil && c.Content != "" && len(c.MultipartContent) <= 0 {
+		xxx.Content = []map[string]any{{"type": "text", "text": c.Content, "cache_control": c.CacheControl}}
+	}
 	if len(c.MultipartContent) > 0 {
 		parts := []map[string]any{}
 		for _, part := range c.MultipartContent {
@@ -51,6 +58,12 @@ func (c *ChatCompletionMessage) MarshalJSON() ([]byte, error) {
 					part.Type: part.Data,
 				})
 			}
+			if c.cacheControl && part.Cache != nil {
+				parts[len(parts)-1]["cache_control"] = part.Cache
+			}
+		}
+		if c.cacheControl && c.CacheControl != nil {
+			parts[len(parts)-1]["cache_control"] = c.CacheControl
 		}
 		xxx.Content = parts
 	}
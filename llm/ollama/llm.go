@@ -61,7 +61,11 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 	})
 
 	if err != nil {
-		return nil, err
+		var statusErr api.StatusError
+		if errors.As(err, &statusErr) {
+			return nil, llm.NewStatusError(statusErr.StatusCode, nil, statusErr.ErrorMessage)
+		}
+		return nil, llm.NewTransportError(err)
 	}
 	return response, nil
 }
@@ -31,6 +31,11 @@ func (m *LLM) Name() string {
 	return Name
 }
 
+// SupportsResponseFormat ...
+func (m *LLM) SupportsResponseFormat(t llm.ChatCompletionResponseFormatType) bool {
+	return true
+}
+
 // Invoke ...
 func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
 	var err error
@@ -3,7 +3,9 @@ package openai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
@@ -81,6 +83,9 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 	raw, _ := json.Marshal(params)
 	log.InfoContextf(ctx, "openai params: %s", string(raw))
 	stream := m.client.Chat.Completions.NewStreaming(ctx, params)
+	if err := stream.Err(); err != nil { // the request failed, nothing streamed
+		return nil, fmt.Errorf("openai chat completions request error: %w", providerError(err))
+	}
 
 	// 流式响应
 	acc := openai.ChatCompletionAccumulator{}
@@ -90,6 +95,9 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 		defer response.Stream().Close()
 		for stream.Next() {
 			chunk := stream.Current()
+			if len(chunk.Choices) == 0 { // usage only
+				continue
+			}
 			mmm := llm.NewAssistantMessage(chunk.Choices[0].Delta.Content)
 			acc.AddChunk(chunk)
 			// When this fires, the current chunk value will not contain content data
@@ -121,14 +129,32 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 			response.Stream().Push(llm.NewChunk(0, mmm, nil))
 
 		}
-		if stream.Err() != nil {
-			panic(stream.Err())
+		if err := stream.Err(); err != nil {
+			log.ErrorContextf(ctx, "openai chat completions stream error: %v", err)
+			response.Stream().Push(llm.NewErrorChunk(providerError(err)))
 		}
 	}()
 
 	return response, nil
 }
 
+// providerError classifies the api error by status, others are transport errors
+func providerError(err error) error {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return llm.NewTransportError(err)
+	}
+	var header http.Header
+	if apiErr.Response != nil {
+		header = apiErr.Response.Header
+	}
+	body := apiErr.JSON.RawJSON()
+	if body == "" {
+		body = apiErr.Code + ": " + apiErr.Message
+	}
+	return llm.NewStatusError(apiErr.StatusCode, header, body)
+}
+
 func (m *LLM) setupClient() error {
 	config, _ := llm.Config.Get("openai").(map[string]any)
 	if config == nil {
@@ -0,0 +1,18 @@
+package openai
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderError(t *testing.T) {
+	err := providerError(&openai.Error{StatusCode: 429, Code: "rate_limit_exceeded", Message: "slow down"})
+	assert.ErrorIs(t, err, llm.ErrRateLimited)
+	err = providerError(&openai.Error{StatusCode: 400, Code: "context_length_exceeded", Message: "too long"})
+	assert.ErrorIs(t, err, llm.ErrContextOverflow)
+	assert.ErrorIs(t, providerError(errors.New("connection reset by peer")), llm.ErrTransient)
+}
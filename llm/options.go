@@ -8,7 +8,8 @@ import (
 // InvokeOptions ...
 type InvokeOptions struct {
 	Stop []string `json:"stop,omitempty"`
-	// ResponseFormat *ChatCompletionResponseFormat `json:"response_format,omitempty"`
+	// ResponseFormat constrains the output, providers without native support fall back to prompt-and-validate.
+	ResponseFormat *ChatCompletionResponseFormat `json:"response_format,omitempty"`
 	// LogitBias is must be a token id string (specified by their token ID in the tokenizer), not a word string.
 	// incorrect: `"logit_bias":{"You": 6}`, correct: `"logit_bias":{"1639": 6}`
 	// refs: https://platform.openai.com/docs/api-reference/chat/create#chat/create-logit_bias
@@ -90,6 +91,8 @@ const (
 type ChatCompletionResponseFormat struct {
 	Type       ChatCompletionResponseFormatType        `json:"type,omitempty"`
 	JSONSchema *ChatCompletionResponseFormatJSONSchema `json:"json_schema,omitempty"`
+	// Repairs is the max repair retries of prompt-and-validate fallback, default 2.
+	Repairs int `json:"-"`
 }
 
 type ChatCompletionResponseFormatJSONSchema struct {
@@ -158,6 +161,13 @@ func WithMaxTokens(maxTokens int) InvokeOption {
 	}
 }
 
+// WithN specifies how many choices to generate, read by Result().Choices; providers without it return one
+func WithN(n int) InvokeOption {
+	return func(o *InvokeOptions) {
+		o.N = n
+	}
+}
+
 // WithTopP specifies the cumulative probability for top-p sampling.
 func WithTopP(topP float64) InvokeOption {
 	return func(o *InvokeOptions) {
@@ -206,6 +216,20 @@ func WithToolChoice(toolChoice any) InvokeOption {
 	}
 }
 
+// WithResponseFormat specifies the response format.
+func WithResponseFormat(format *ChatCompletionResponseFormat) InvokeOption {
+	return func(o *InvokeOptions) {
+		o.ResponseFormat = format
+	}
+}
+
+// WithJSONSchema constrains the output to the json schema generated from v, e.g. &MyStruct{}.
+func WithJSONSchema(v any) InvokeOption {
+	return func(o *InvokeOptions) {
+		o.ResponseFormat = NewJSONSchemaFormat(v)
+	}
+}
+
 // WithMetadata specifies the metadata for the request.
 func WithMetadata(metadata map[string]any) InvokeOption {
 	return func(o *InvokeOptions) {
@@ -0,0 +1,43 @@
+package llm
+
+// CacheControl 提示词缓存断点，支持的 provider 缓存该断点之前的前缀，不支持的 provider 忽略
+type CacheControl struct {
+	Type string `json:"type"`          // ephemeral
+	TTL  string `json:"ttl,omitempty"` // e.g. 5m, 1h, provider default if empty
+}
+
+// CacheEphemeral default cache breakpoint
+var CacheEphemeral = &CacheControl{Type: "ephemeral"}
+
+// CacheBreakpoint is implemented by messages which may carry a cache breakpoint
+type CacheBreakpoint interface {
+	CacheControl() *CacheControl
+}
+
+// CacheControlOf returns the cache breakpoint of message, nil if none
+func CacheControlOf(m Message) *CacheControl {
+	if b, ok := m.(CacheBreakpoint); ok {
+		return b.CacheControl()
+	}
+	return nil
+}
+
+// MarkCache marks message as a cache breakpoint, cc defaults to CacheEphemeral
+func MarkCache(m Message, cc ...*CacheControl) Message {
+	control := CacheEphemeral
+	if len(cc) > 0 && cc[0] != nil {
+		control = cc[0]
+	}
+	switch msg := m.(type) {
+	case PromptMessage:
+		msg.cacheControl = control
+		return msg
+	case *PromptMessage:
+		msg.cacheControl = control
+	case *AssistantMessage:
+		msg.cacheControl = control
+	case *ToolPromptMessage:
+		msg.cacheControl = control
+	}
+	return m
+}
@@ -0,0 +1,32 @@
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromptCache_OAILLM(t *testing.T) {
+	messages := []Message{MarkCache(NewSystemMessage("long system prompt")), NewUserTextMessage("hi")}
+
+	payload, _ := json.Marshal(NewOAILLM("", "").buildRequest(messages, &InvokeOptions{}))
+	assert.NotContains(t, string(payload), "cache_control") // ignored by default
+
+	payload, _ = json.Marshal(NewOAILLM("", "").WithCacheControl(true).buildRequest(messages, &InvokeOptions{}))
+	assert.Contains(t, string(payload), `{"role":"system","content":[{"cache_control":{"type":"ephemeral"},"text":"long system prompt","type":"text"}]}`)
+	assert.Contains(t, string(payload), `{"role":"user","content":"hi"}`)
+}
+
+func TestPromptCache_Usage(t *testing.T) {
+	chunk, err := buildChunkMessage([]byte(`{"choices":[],"usage":{"prompt_tokens":1000,"completion_tokens":10,"total_tokens":1010,"prompt_tokens_details":{"cached_tokens":800}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 800, chunk.Usage.CacheReadTokens)
+
+	chunk, err = buildChunkMessage([]byte(`{"choices":[],"usage":{"prompt_tokens":1000,"prompt_cache_hit_tokens":600,"prompt_cache_miss_tokens":400}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 600, chunk.Usage.CacheReadTokens)
+
+	price := Price{Prompt: 2, CacheRead: 0.5, Completion: 8}
+	assert.InDelta(t, (200*2+800*0.5+10*8)/1e6, price.cost(Usage{PromptTokens: 1000, CacheReadTokens: 800, CompletionTokens: 10}), 1e-12)
+}
@@ -25,6 +25,11 @@ type LLM struct {
 
 var initOnce sync.Once
 
+// SupportsResponseFormat only json_object is supported natively, json_schema falls back to prompt-and-validate
+func (m *LLM) SupportsResponseFormat(t llm.ChatCompletionResponseFormatType) bool {
+	return t == llm.ChatCompletionResponseFormatTypeJSONObject
+}
+
 // Invoke TODO
 func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
 	var err error
@@ -35,7 +40,7 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 			err = fmt.Errorf(Name + " config not found")
 		}
 		apiKey, _ := config["api_key"].(string)
-		m.engine = llm.NewOAILLM(url, apiKey)
+		m.engine = llm.NewOAILLM(url, apiKey).WithCacheControl(true) // explicit context cache
 	})
 	if err != nil {
 		return nil, err
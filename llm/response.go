@@ -29,39 +29,99 @@ func (resp *Response) Result() *Result {
 	if resp.result != nil {
 		return resp.result
 	}
-	resp.result = &Result{}
 	// 合并 message
-	text := ""
-	reasoning := ""
-	toolcalls := []*ToolCall{}
-	currentTool := &ToolCall{Index: -1}
+	builder := &resultBuilder{}
 	for it := resp.stream.Take(); it != nil; it = resp.stream.Take() {
-		resp.result.Usage.PromptTokens += it.Usage.PromptTokens
-		resp.result.Usage.CompletionTokens += it.Usage.CompletionTokens
-		resp.result.Usage.TotalTokens += it.Usage.TotalTokens
-		if len(it.Choices) <= 0 {
-			continue
+		builder.add(it)
+	}
+	resp.result = builder.build()
+	return resp.result
+}
+
+// resultBuilder merges chunks by choice index, see InvokeOptions.N
+type resultBuilder struct {
+	result  Result
+	choices []*choiceBuilder
+}
+
+func (b *resultBuilder) add(it *Chunk) {
+	b.result.Usage.add(it.Usage)
+	if it.Err != nil {
+		b.result.Err = it.Err
+	}
+	if it.Model != "" {
+		b.result.Model = it.Model
+	}
+	for _, choice := range it.Choices {
+		if choice != nil {
+			b.choice(choice.Index).add(choice)
 		}
-		deltaMessage := it.Choices[0].Delta
-		text += deltaMessage.content
-		reasoning += deltaMessage.ReasoningContent
-		for _, toolcall := range deltaMessage.ToolCalls {
-			if currentTool.Index != toolcall.Index {
-				currentTool = toolcall
-				toolcalls = append(toolcalls, currentTool)
-			} else {
-				currentTool.ID += toolcall.ID
-				currentTool.Type += toolcall.Type
-				currentTool.Function.Name += toolcall.Function.Name
-				currentTool.Function.Arguments += toolcall.Function.Arguments
-			}
+	}
+}
+
+func (b *resultBuilder) choice(index int) *choiceBuilder {
+	for len(b.choices) <= index {
+		b.choices = append(b.choices, &choiceBuilder{index: len(b.choices), current: &ToolCall{Index: -1}})
+	}
+	return b.choices[index]
+}
+
+func (b *resultBuilder) build() *Result {
+	result := b.result
+	b.choice(0) // the empty message of no chunks
+	for _, choice := range b.choices {
+		result.Choices = append(result.Choices, choice.build())
+	}
+	result.Message = result.Choices[0].Message
+	result.FinishReason = result.Choices[0].FinishReason
+	return &result
+}
+
+// choiceBuilder merges the deltas of a choice, tool call deltas of the same index are merged into a copy
+type choiceBuilder struct {
+	index        int
+	finishReason string
+	text         string
+	reasoning    string
+	signature    string
+	toolcalls    []*ToolCall
+	current      *ToolCall
+}
+
+func (b *choiceBuilder) add(choice *ChunkChoice) {
+	if choice.FinishReason != "" {
+		b.finishReason = choice.FinishReason
+	}
+	deltaMessage := choice.Delta
+	if deltaMessage == nil {
+		return
+	}
+	b.text += deltaMessage.content
+	b.reasoning += deltaMessage.ReasoningContent
+	b.signature += deltaMessage.ReasoningSignature
+	for _, toolcall := range deltaMessage.ToolCalls {
+		if b.current.Index != toolcall.Index {
+			copied := *toolcall
+			b.current = &copied
+			b.toolcalls = append(b.toolcalls, b.current)
+		} else {
+			b.current.ID += toolcall.ID
+			b.current.Type += toolcall.Type
+			b.current.Function.Name += toolcall.Function.Name
+			b.current.Function.Arguments += toolcall.Function.Arguments
 		}
 	}
-	message := NewAssistantMessage(text)
-	message.ReasoningContent = reasoning
-	message.ToolCalls = toolcalls
-	resp.result.Message = message
-	return resp.result
+}
+
+func (b *choiceBuilder) build() *ResultChoice {
+	message := NewAssistantMessage(b.text)
+	message.ReasoningContent = b.reasoning
+	message.ReasoningSignature = b.signature
+	message.ToolCalls = b.toolcalls
+	if message.ToolCalls == nil {
+		message.ToolCalls = []*ToolCall{}
+	}
+	return &ResultChoice{Index: b.index, Message: message, FinishReason: b.finishReason}
 }
 
 // Result ...
@@ -70,7 +130,19 @@ type Result struct {
 	// Messages          []*PromptMessage
 	Message           *AssistantMessage `json:"message"`
 	Usage             Usage             `json:"usage"`
+	FinishReason      string            `json:"finish_reason"`
 	SystemFingerprint string            `json:"system_fingerprint"`
+	// Choices all choices of the completion by index, Message and FinishReason are those of the first
+	Choices []*ResultChoice `json:"choices,omitempty"`
+	// Err the error of provider ending the stream, see Chunk.Err
+	Err error `json:"-"`
+}
+
+// ResultChoice a choice of the completion, more than one if InvokeOptions.N > 1
+type ResultChoice struct {
+	Index        int               `json:"index"`
+	Message      *AssistantMessage `json:"message"`
+	FinishReason string            `json:"finish_reason"`
 }
 
 // String ...
@@ -80,7 +152,11 @@ func (r *Result) String() string {
 
 // NewChunk ...
 func NewChunk(i int, msg *AssistantMessage, useage *Usage) *Chunk {
+	if useage == nil {
+		useage = &Usage{}
+	}
 	return &Chunk{
+		Usage: useage,
 		Choices: []*ChunkChoice{
 			{
 				Index:        i,
@@ -91,6 +167,14 @@ func NewChunk(i int, msg *AssistantMessage, useage *Usage) *Chunk {
 	}
 }
 
+// NewErrorChunk the last chunk of a stream failed in the middle, see Chunk.Err
+func NewErrorChunk(err error) *Chunk {
+	chunk := NewChunk(0, NewAssistantMessage(""), nil)
+	chunk.Choices[0].FinishReason = FinishReasonError
+	chunk.Err = err
+	return chunk
+}
+
 // buildChunkMessage ...
 func buildChunkMessage(line []byte) (*Chunk, error) {
 	var mmm struct {
@@ -107,14 +191,23 @@ func buildChunkMessage(line []byte) (*Chunk, error) {
 			} `json:"delta"`
 			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
-		Usage Usage `json:"usage"`
+		Usage struct {
+			Usage
+			PromptTokensDetails struct {
+				CachedTokens             int `json:"cached_tokens"`
+				CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+			} `json:"prompt_tokens_details"`
+			PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"` // deepseek
+		} `json:"usage"`
 	}
 	if err := json.Unmarshal(line, &mmm); err != nil {
 		return nil, err
 	}
 
 	chunk := &Chunk{}
-	chunk.Usage = &mmm.Usage
+	chunk.Usage = &mmm.Usage.Usage
+	chunk.Usage.CacheReadTokens = max(mmm.Usage.PromptTokensDetails.CachedTokens, mmm.Usage.PromptCacheHitTokens)
+	chunk.Usage.CacheWriteTokens = mmm.Usage.PromptTokensDetails.CacheCreationInputTokens
 	chunk.ID = mmm.ID
 	chunk.CreatedAt = mmm.Created
 	chunk.Model = mmm.Model
@@ -123,26 +216,21 @@ func buildChunkMessage(line []byte) (*Chunk, error) {
 		return chunk, nil
 	}
 	// chunk.SystemFingerprint = mmm.SystemFingerprint
-	chunk.Choices = make([]*ChunkChoice, 1, 1)
-	chunk.Choices[0] = &ChunkChoice{}
-	chunk.Choices[0].Index = 0
-
-	if mmm.Choices[0].Delta.ReasoningContent != "" {
-		chunk.Choices[0].Delta = NewAssistantReasoningMessage(mmm.Choices[0].Delta.ReasoningContent)
-	} else if len(mmm.Choices[0].Delta.ToolCalls) > 0 {
-		chunk.Choices[0].Delta = NewAssistantMessage(mmm.Choices[0].Delta.Content)
-		chunk.Choices[0].Delta.ToolCalls = mmm.Choices[0].Delta.ToolCalls
-	} else {
-		chunk.Choices[0].Delta = NewAssistantMessage(mmm.Choices[0].Delta.Content)
-	}
-	chunk.Choices[0].FinishReason = mmm.Choices[0].FinishReason
-
 	choices := []*ChunkChoice{}
-	for i := 0; i < len(mmm.Choices); i++ {
+	for _, choice := range mmm.Choices {
+		var delta *AssistantMessage
+		if choice.Delta.ReasoningContent != "" {
+			delta = NewAssistantReasoningMessage(choice.Delta.ReasoningContent)
+		} else {
+			delta = NewAssistantMessage(choice.Delta.Content)
+			if len(choice.Delta.ToolCalls) > 0 {
+				delta.ToolCalls = choice.Delta.ToolCalls
+			}
+		}
 		choices = append(choices, &ChunkChoice{
-			Index:        i,
-			Delta:        chunk.Choices[0].Delta,
-			FinishReason: mmm.Choices[i].FinishReason,
+			Index:        choice.Index,
+			Delta:        delta,
+			FinishReason: choice.FinishReason,
 		})
 	}
 	chunk.Choices = choices
@@ -159,6 +247,15 @@ type Chunk struct {
 	Choices           []*ChunkChoice `json:"choices"`
 	Usage             *Usage         `json:"usage"`
 	// Delta             *ChunkDelta   `json:"-"`
+
+	// Agent and Depth attribute the chunk to the emitting member of a team, set by agent.Team
+	Agent string `json:"agent,omitempty"`
+	Depth int    `json:"depth,omitempty"`
+	// Plan the plan json of a plan-and-execute run, set with FinishReasonPlan
+	Plan json.RawMessage `json:"plan,omitempty"`
+	// Err the error of provider in the middle of stream, set with FinishReasonError on the last chunk,
+	// e.g. a *ProviderError of ErrTransient
+	Err error `json:"-"`
 }
 
 // ChunkChoice ...
@@ -176,6 +273,21 @@ type Usage struct {
 	TotalTokens      int    `json:"total_tokens"`
 	Currency         string `json:"currency"`
 	Latency          int    `json:"latency"`
+	// CacheReadTokens prompt tokens read from provider prompt cache, included in PromptTokens
+	CacheReadTokens int `json:"cache_read_tokens,omitempty"`
+	// CacheWriteTokens prompt tokens written to provider prompt cache, included in PromptTokens
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+}
+
+func (u *Usage) add(o *Usage) {
+	if o == nil {
+		return
+	}
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+	u.CacheReadTokens += o.CacheReadTokens
+	u.CacheWriteTokens += o.CacheWriteTokens
 }
 
 // Stream ...
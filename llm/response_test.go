@@ -0,0 +1,28 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponse_Choices(t *testing.T) {
+	response := NewStreamResponse()
+	for _, line := range []string{
+		`{"choices":[{"index":0,"delta":{"content":"A"}},{"index":1,"delta":{"content":"B"}}]}`,
+		`{"choices":[{"index":1,"delta":{"content":"b"},"finish_reason":"stop"}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"a"},"finish_reason":"stop"}]}`,
+	} {
+		chunk, err := buildChunkMessage([]byte(line))
+		assert.NoError(t, err)
+		response.Stream().Push(chunk)
+	}
+	response.Stream().Close()
+
+	result := response.Result()
+	assert.Len(t, result.Choices, 2)
+	assert.Equal(t, "Aa", result.Message.Content())
+	assert.Equal(t, "stop", result.FinishReason)
+	assert.Equal(t, 1, result.Choices[1].Index)
+	assert.Equal(t, "Bb", result.Choices[1].Message.Content())
+}
@@ -0,0 +1,373 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/showntop/llmack/log"
+)
+
+// RouterStrategy 路由策略
+type RouterStrategy string
+
+const (
+	// RouterStrategyPriority 按 routes 顺序优先调用，失败后依次降级
+	RouterStrategyPriority RouterStrategy = "priority"
+	// RouterStrategyWeighted 按权重平滑轮询选择首个 route，失败后按顺序降级
+	RouterStrategyWeighted RouterStrategy = "weighted"
+)
+
+var (
+	// ErrNoAvailableRoute all routes are broken or no route configured
+	ErrNoAvailableRoute = errors.New("llm router has no available route")
+	// ErrEmptyStream stream closed before the first chunk
+	ErrEmptyStream = errors.New("llm stream closed before first chunk")
+)
+
+// Route 一个可被路由的 provider + model
+type Route struct {
+	Name     string           // provider name, used to build Provider from registry when Provider is nil
+	Model    string           // model of this route, empty keeps the model of invoke options
+	Weight   int              // weight for RouterStrategyWeighted, default 1
+	Provider Provider         // optional provider instance
+	Options  *ProviderOptions // options to build provider from registry
+
+	once    sync.Once
+	breaker *circuitBreaker
+	current int // current weight of smooth weighted round-robin
+}
+
+func (r *Route) provider() (Provider, error) {
+	r.once.Do(func() {
+		if r.Provider != nil {
+			return
+		}
+		constructor, ok := providers[r.Name]
+		if !ok {
+			return
+		}
+		po := r.Options
+		if po == nil {
+			po = &ProviderOptions{}
+		}
+		r.Provider = constructor(po)
+	})
+	if r.Provider == nil {
+		return nil, fmt.Errorf("llm provider of %v is not registered", r.Name)
+	}
+	return r.Provider, nil
+}
+
+func (r *Route) String() string {
+	if r.Model == "" {
+		return r.Name
+	}
+	return r.Name + "/" + r.Model
+}
+
+// RouterOption ...
+type RouterOption func(*Router)
+
+// WithRoute appends a route of registered provider name and model
+func WithRoute(name string, model string, weight int) RouterOption {
+	return func(r *Router) {
+		r.routes = append(r.routes, &Route{Name: name, Model: model, Weight: weight})
+	}
+}
+
+// WithRoutes appends routes
+func WithRoutes(routes ...*Route) RouterOption {
+	return func(r *Router) {
+		r.routes = append(r.routes, routes...)
+	}
+}
+
+// WithRouterStrategy ...
+func WithRouterStrategy(strategy RouterStrategy) RouterOption {
+	return func(r *Router) {
+		r.strategy = strategy
+	}
+}
+
+// WithCircuitBreaker route 连续失败 threshold 次后熔断 cooldown 时长
+func WithCircuitBreaker(threshold int, cooldown time.Duration) RouterOption {
+	return func(r *Router) {
+		r.threshold = threshold
+		r.cooldown = cooldown
+	}
+}
+
+// WithFirstChunkTimeout 流式响应首包超时后降级到下一个 route
+func WithFirstChunkTimeout(timeout time.Duration) RouterOption {
+	return func(r *Router) {
+		r.firstChunkTimeout = timeout
+	}
+}
+
+// Router a Provider routing requests to several providers with failover,
+// weighted round-robin and per route circuit breaking.
+type Router struct {
+	mu                sync.Mutex
+	routes            []*Route
+	strategy          RouterStrategy
+	threshold         int
+	cooldown          time.Duration
+	firstChunkTimeout time.Duration
+}
+
+// NewRouter ...
+func NewRouter(opts ...RouterOption) *Router {
+	r := &Router{
+		strategy:  RouterStrategyPriority,
+		threshold: 3,
+		cooldown:  30 * time.Second,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	for _, route := range r.routes {
+		if route.Weight <= 0 {
+			route.Weight = 1
+		}
+		route.breaker = &circuitBreaker{threshold: r.threshold, cooldown: r.cooldown}
+	}
+	return r
+}
+
+// RegisterRouter registers a router as provider name, so it can be used by NewInstance(name)
+func RegisterRouter(name string, opts ...RouterOption) *Router {
+	router := NewRouter(opts...)
+	Register(name, func(*ProviderOptions) Provider { return router })
+	return router
+}
+
+// Name ...
+func (r *Router) Name() string {
+	return "router"
+}
+
+// Invoke ...
+func (r *Router) Invoke(ctx context.Context, messages []Message, options *InvokeOptions) (*Response, error) {
+	var errs []error
+	for _, route := range r.candidates() {
+		if !route.breaker.allow() {
+			continue
+		}
+		response, err := r.invoke(ctx, route, messages, options)
+		if err == nil {
+			route.breaker.success()
+			return response, nil
+		}
+		if ctx.Err() != nil { // canceled by caller, not the fault of provider
+			return nil, err
+		}
+		if !errors.Is(err, ErrContextOverflow) && !errors.Is(err, ErrContentFiltered) { // request problem, not provider health
+			route.breaker.failure()
+		}
+		log.WarnContextf(ctx, "llm router route %s failed, fallback to next route: %v", route, err)
+		errs = append(errs, fmt.Errorf("%s: %w", route, err))
+	}
+	if len(errs) == 0 {
+		return nil, ErrNoAvailableRoute
+	}
+	return nil, errors.Join(errs...)
+}
+
+// SupportsResponseFormat delegates to the providers of routes, any route may be selected by failover,
+// so the format is native only if all routes support it, otherwise Instance falls back to prompt-and-validate
+func (r *Router) SupportsResponseFormat(t ChatCompletionResponseFormatType) bool {
+	if len(r.routes) == 0 {
+		return false
+	}
+	for _, route := range r.routes {
+		provider, err := route.provider()
+		if err != nil {
+			return false
+		}
+		supporter, ok := provider.(ResponseFormatSupporter)
+		if !ok || !supporter.SupportsResponseFormat(t) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Router) invoke(ctx context.Context, route *Route, messages []Message, options *InvokeOptions) (*Response, error) {
+	provider, err := route.provider()
+	if err != nil {
+		return nil, err
+	}
+	opts := &InvokeOptions{}
+	if options != nil {
+		*opts = *options // do not leak route model to caller
+	}
+	if route.Model != "" {
+		opts.Model = route.Model
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	response, err := provider.Invoke(ctx, messages, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return r.waitFirstChunk(ctx, cancel, response)
+}
+
+// waitFirstChunk 等待首个有内容的包，之前失败（含流中的 Chunk.Err）的流可以安全降级
+func (r *Router) waitFirstChunk(ctx context.Context, cancel context.CancelFunc, response *Response) (*Response, error) {
+	if response == nil || response.stream == nil {
+		cancel()
+		return response, nil
+	}
+	var timeout <-chan time.Time
+	if r.firstChunkTimeout > 0 {
+		timer := time.NewTimer(r.firstChunkTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	abandon := func() {
+		cancel()
+		go func() { // drain the abandoned stream, let the producer exit
+			for range response.stream.Next() {
+			}
+		}()
+	}
+
+	leading := []*Chunk{} // chunks before content, e.g. usage of anthropic message_start
+	for {
+		select {
+		case chunk, ok := <-response.stream.Next():
+			if !ok {
+				cancel()
+				return nil, ErrEmptyStream
+			}
+			if chunk.Err != nil { // failed before any content, fallback is still safe
+				abandon()
+				return nil, chunk.Err
+			}
+			leading = append(leading, chunk)
+			if !hasContent(chunk) {
+				continue
+			}
+			newResp := NewStreamResponse()
+			go func() {
+				defer cancel()
+				defer newResp.stream.Close()
+				for _, it := range leading {
+					newResp.stream.Push(it)
+				}
+				for it := range response.stream.Next() {
+					newResp.stream.Push(it)
+				}
+			}()
+			return newResp, nil
+		case <-timeout:
+			abandon()
+			return nil, fmt.Errorf("llm stream first chunk timeout after %s", r.firstChunkTimeout)
+		case <-ctx.Done():
+			abandon()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// hasContent whether the chunk streams anything of the answer to caller
+func hasContent(chunk *Chunk) bool {
+	for _, choice := range chunk.Choices {
+		if choice == nil {
+			continue
+		}
+		if choice.FinishReason != "" {
+			return true
+		}
+		if delta := choice.Delta; delta != nil &&
+			(delta.Content() != "" || delta.ReasoningContent != "" || delta.ReasoningSignature != "" || len(delta.ToolCalls) > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates returns routes in the order to try
+func (r *Router) candidates() []*Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	routes := make([]*Route, 0, len(r.routes))
+	if r.strategy != RouterStrategyWeighted || len(r.routes) <= 1 {
+		return append(routes, r.routes...)
+	}
+	// smooth weighted round-robin, only among routes not broken
+	var selected *Route
+	total := 0
+	for _, route := range r.routes {
+		if route.breaker.broken() {
+			continue
+		}
+		route.current += route.Weight
+		total += route.Weight
+		if selected == nil || route.current > selected.current {
+			selected = route
+		}
+	}
+	if selected == nil {
+		return append(routes, r.routes...)
+	}
+	selected.current -= total
+	routes = append(routes, selected)
+	for _, route := range r.routes {
+		if route != selected {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// circuitBreaker 连续失败熔断，冷却后半开放行一次试探
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+func (b *circuitBreaker) broken() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold && time.Now().Before(b.openUntil)
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown) // half open, let one request through
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
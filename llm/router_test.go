@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	name  string
+	err   error
+	empty bool  // stream closes without any chunk
+	fail  error // stream fails after a usage-only chunk, like anthropic message_start then error
+	calls int
+	model string
+}
+
+func (f *fakeProvider) Invoke(ctx context.Context, messages []Message, opts *InvokeOptions) (*Response, error) {
+	f.calls++
+	f.model = opts.Model
+	if f.err != nil {
+		return nil, f.err
+	}
+	response := NewStreamResponse()
+	go func() {
+		defer response.stream.Close()
+		if f.empty {
+			return
+		}
+		if f.fail != nil {
+			response.stream.Push(&Chunk{Usage: &Usage{PromptTokens: 3}})
+			chunk := NewChunk(0, NewAssistantMessage(""), nil)
+			chunk.Choices[0].FinishReason = FinishReasonError
+			chunk.Err = f.fail
+			response.stream.Push(chunk)
+			return
+		}
+		response.stream.Push(NewChunk(0, NewAssistantMessage(f.name), nil))
+	}()
+	return response, nil
+}
+
+func TestRouter_PriorityFailover(t *testing.T) {
+	bad := &fakeProvider{name: "deepseek", err: errors.New("503 service unavailable")}
+	empty := &fakeProvider{name: "qwen", empty: true}
+	good := &fakeProvider{name: "ollama"}
+	router := NewRouter(WithRoutes(
+		&Route{Name: "deepseek", Provider: bad},
+		&Route{Name: "qwen", Provider: empty},
+		&Route{Name: "ollama", Model: "llama3", Provider: good},
+	))
+
+	response, err := NewInstance("router", WithProvider(router)).
+		Invoke(context.Background(), []Message{NewUserTextMessage("hi")}, WithStream(true), WithModel("deepseek-chat"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ollama", response.Result().Message.Content())
+	assert.Equal(t, "llama3", good.model)
+	assert.Equal(t, 1, bad.calls)
+	assert.Equal(t, 1, empty.calls)
+}
+
+func TestRouter_StreamErrorFailover(t *testing.T) {
+	bad := &fakeProvider{name: "claude", fail: &ProviderError{Kind: ErrTransient, Message: "overloaded_error: Overloaded"}}
+	good := &fakeProvider{name: "qwen"}
+	router := NewRouter(
+		WithRoutes(&Route{Name: "claude", Provider: bad}, &Route{Name: "qwen", Provider: good}),
+		WithCircuitBreaker(1, time.Hour),
+	)
+	for range 2 {
+		response, err := router.Invoke(context.Background(), nil, &InvokeOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "qwen", response.Result().Message.Content())
+	}
+	assert.Equal(t, 1, bad.calls) // the stream error is a failure of the route
+}
+
+func TestRouter_CircuitBreaker(t *testing.T) {
+	bad := &fakeProvider{name: "deepseek", err: errors.New("502 bad gateway")}
+	good := &fakeProvider{name: "qwen"}
+	router := NewRouter(
+		WithRoutes(&Route{Name: "deepseek", Provider: bad}, &Route{Name: "qwen", Provider: good}),
+		WithCircuitBreaker(2, time.Hour),
+	)
+	for range 5 {
+		response, err := router.Invoke(context.Background(), nil, &InvokeOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "qwen", response.Result().Message.Content())
+	}
+	assert.Equal(t, 2, bad.calls) // broken after threshold
+	assert.Equal(t, 5, good.calls)
+}
+
+func TestRouter_Weighted(t *testing.T) {
+	a := &fakeProvider{name: "a"}
+	b := &fakeProvider{name: "b"}
+	router := NewRouter(
+		WithRoutes(&Route{Name: "a", Weight: 3, Provider: a}, &Route{Name: "b", Weight: 1, Provider: b}),
+		WithRouterStrategy(RouterStrategyWeighted),
+	)
+	for range 8 {
+		response, err := router.Invoke(context.Background(), nil, &InvokeOptions{})
+		assert.NoError(t, err)
+		response.Result()
+	}
+	assert.Equal(t, 6, a.calls)
+	assert.Equal(t, 2, b.calls)
+}
+
+func TestRouter_AllFailed(t *testing.T) {
+	router := NewRouter(WithRoutes(
+		&Route{Name: "a", Provider: &fakeProvider{err: errors.New("a down")}},
+		&Route{Name: "b", Provider: &fakeProvider{err: errors.New("b down")}},
+	))
+	_, err := router.Invoke(context.Background(), nil, &InvokeOptions{})
+	assert.ErrorContains(t, err, "a down")
+	assert.ErrorContains(t, err, "b down")
+}
+
+// formatProvider supports the response formats natively
+type formatProvider struct {
+	fakeProvider
+}
+
+func (f *formatProvider) SupportsResponseFormat(t ChatCompletionResponseFormatType) bool {
+	return t == ChatCompletionResponseFormatTypeJSONSchema
+}
+
+func TestRouter_SupportsResponseFormat(t *testing.T) {
+	native := NewRouter(WithRoutes(&Route{Name: "a", Provider: &formatProvider{}}, &Route{Name: "b", Provider: &formatProvider{}}))
+	assert.True(t, native.SupportsResponseFormat(ChatCompletionResponseFormatTypeJSONSchema))
+	assert.False(t, native.SupportsResponseFormat(ChatCompletionResponseFormatTypeJSONObject))
+
+	// the fallback route can not constrain output
+	mixed := NewRouter(WithRoutes(&Route{Name: "a", Provider: &formatProvider{}}, &Route{Name: "b", Provider: &fakeProvider{}}))
+	assert.False(t, mixed.SupportsResponseFormat(ChatCompletionResponseFormatTypeJSONSchema))
+}
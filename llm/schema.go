@@ -0,0 +1,184 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ErrInvalidStructuredOutput completion does not match the response format after all repairs
+var ErrInvalidStructuredOutput = errors.New("llm structured output invalid")
+
+// ResponseFormatSupporter is implemented by providers which can constrain output natively,
+// other providers fall back to prompt-and-validate.
+type ResponseFormatSupporter interface {
+	SupportsResponseFormat(ChatCompletionResponseFormatType) bool
+}
+
+var schemaNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// JSONSchemaOf generates json schema of a go value or type, nested structs are inlined
+func JSONSchemaOf(v any) *jsonschema.Schema {
+	reflector := &jsonschema.Reflector{
+		DoNotReference: true,
+		ExpandedStruct: true,
+	}
+	var schema *jsonschema.Schema
+	if t, ok := v.(reflect.Type); ok {
+		schema = reflector.ReflectFromType(t)
+	} else {
+		schema = reflector.Reflect(v)
+	}
+	schema.Version = ""
+	schema.ID = ""
+	return schema
+}
+
+// NewJSONSchemaFormat builds json_schema response format of a go value
+func NewJSONSchemaFormat(v any) *ChatCompletionResponseFormat {
+	t := reflect.TypeOf(v)
+	if rt, ok := v.(reflect.Type); ok {
+		t = rt
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := "response"
+	if t != nil && t.Name() != "" {
+		name = schemaNamePattern.ReplaceAllString(t.Name(), "_")
+	}
+	return &ChatCompletionResponseFormat{
+		Type: ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &ChatCompletionResponseFormatJSONSchema{
+			Name:   name,
+			Schema: JSONSchemaOf(v),
+		},
+	}
+}
+
+// ExtractJSON strips markdown fences and surrounding text of a json completion
+func ExtractJSON(completion string) string {
+	text := strings.TrimSpace(completion)
+	if start := strings.Index(text, "```"); start >= 0 {
+		text = text[start+3:]
+		text = strings.TrimPrefix(text, "json")
+		if end := strings.Index(text, "```"); end >= 0 {
+			text = text[:end]
+		}
+		text = strings.TrimSpace(text)
+	}
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return text
+	}
+	end := strings.LastIndexAny(text, "}]")
+	if end < start {
+		return text[start:]
+	}
+	return text[start : end+1]
+}
+
+// ValidateResponseFormat checks completion against format, returns the extracted json
+func ValidateResponseFormat(format *ChatCompletionResponseFormat, completion string) (string, error) {
+	if format == nil || format.Type == ChatCompletionResponseFormatTypeText || format.Type == "" {
+		return completion, nil
+	}
+	text := ExtractJSON(completion)
+	if !json.Valid([]byte(text)) {
+		return text, errors.New("response is not valid json")
+	}
+	if format.Type != ChatCompletionResponseFormatTypeJSONSchema || format.JSONSchema == nil || format.JSONSchema.Schema == nil {
+		return text, nil
+	}
+	schema, err := json.Marshal(format.JSONSchema.Schema)
+	if err != nil {
+		return text, fmt.Errorf("marshal json schema error: %w", err)
+	}
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewStringLoader(text))
+	if err != nil {
+		return text, fmt.Errorf("validate json schema error: %w", err)
+	}
+	if !result.Valid() {
+		reasons := []string{}
+		for _, e := range result.Errors() {
+			reasons = append(reasons, e.String())
+		}
+		return text, errors.New(strings.Join(reasons, "; "))
+	}
+	return text, nil
+}
+
+func (mi *Instance) supportsResponseFormat(t ChatCompletionResponseFormatType) bool {
+	supporter, ok := mi.provider.(ResponseFormatSupporter)
+	return ok && supporter.SupportsResponseFormat(t)
+}
+
+// invokeStructured 不支持原生结构化输出的 provider，通过提示词约束输出并校验，校验失败后让模型修复
+func (mi *Instance) invokeStructured(ctx context.Context,
+	messages []Message, invokeOpts *InvokeOptions) (*Response, error) {
+	format := invokeOpts.ResponseFormat
+	opts := *invokeOpts
+	opts.ResponseFormat = nil
+	if mi.supportsResponseFormat(ChatCompletionResponseFormatTypeJSONObject) {
+		opts.ResponseFormat = &ChatCompletionResponseFormat{Type: ChatCompletionResponseFormatTypeJSONObject}
+	}
+
+	instruction := "Respond with only a valid JSON value, without markdown or any other text."
+	if format.JSONSchema != nil && format.JSONSchema.Schema != nil {
+		schema, err := json.Marshal(format.JSONSchema.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("marshal json schema error: %w", err)
+		}
+		instruction += "\nThe JSON must conform to the following JSON Schema:\n" + string(schema)
+	}
+	messages = append(append([]Message{}, messages...), NewSystemMessage(instruction))
+
+	repairs := format.Repairs
+	if repairs <= 0 {
+		repairs = 2
+	}
+	usage := Usage{}
+	var lastErr error
+	for attempt := 0; attempt <= repairs; attempt++ {
+		response, err := mi.invoke(ctx, messages, &opts)
+		if err != nil {
+			return nil, err
+		}
+		result := response.Result()
+		usage.add(&result.Usage)
+		completion := ""
+		if result.Message != nil {
+			completion = result.Message.Content()
+		}
+		text, verr := ValidateResponseFormat(format, completion)
+		if verr == nil {
+			result.Message.content = text
+			result.Usage = usage
+			return newResultResponse(result), nil
+		}
+		lastErr = verr
+		mi.opts.logger.WarnContextf(ctx, "llm structured output invalid, repair attempt %d: %v", attempt+1, verr)
+		messages = append(messages,
+			NewAssistantMessage(completion),
+			NewUserTextMessage("The previous response is invalid: "+verr.Error()+"\nFix it and respond again with only the corrected JSON."),
+		)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrInvalidStructuredOutput, lastErr)
+}
+
+// newResultResponse a response of result, which can also be read as a one chunk stream
+func newResultResponse(result *Result) *Response {
+	response := NewStreamResponse()
+	usage := result.Usage
+	response.stream.Push(NewChunk(0, result.Message, &usage))
+	response.stream.Close()
+	response.result = result
+	return response
+}
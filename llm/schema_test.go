@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type weather struct {
+	City        string  `json:"city"`
+	Temperature float64 `json:"temperature"`
+}
+
+type scriptedProvider struct {
+	replies  []string
+	requests [][]Message
+	formats  []*ChatCompletionResponseFormat
+}
+
+func (s *scriptedProvider) Invoke(ctx context.Context, messages []Message, opts *InvokeOptions) (*Response, error) {
+	s.requests = append(s.requests, messages)
+	s.formats = append(s.formats, opts.ResponseFormat)
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+	response := NewStreamResponse()
+	go func() {
+		defer response.stream.Close()
+		response.stream.Push(NewChunk(0, NewAssistantMessage(reply), &Usage{TotalTokens: 10}))
+	}()
+	return response, nil
+}
+
+func TestJSONSchema_FallbackRepair(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{
+		`{"city": "Beijing"}`,
+		"```json\n{\"city\": \"Beijing\", \"temperature\": 21.5}\n```",
+	}}
+	response, err := NewInstance("scripted", WithProvider(provider)).
+		Invoke(context.Background(), []Message{NewUserTextMessage("weather of Beijing")}, WithJSONSchema(&weather{}))
+	assert.NoError(t, err)
+	assert.Len(t, provider.requests, 2)
+	assert.Nil(t, provider.formats[0]) // not supported natively
+	assert.Contains(t, provider.requests[0][1].Content(), `"temperature"`)
+	assert.Contains(t, provider.requests[1][3].Content(), "temperature")
+
+	result := response.Result()
+	assert.Equal(t, 20, result.Usage.TotalTokens)
+	var w weather
+	assert.NoError(t, json.Unmarshal([]byte(result.Message.Content()), &w))
+	assert.Equal(t, weather{City: "Beijing", Temperature: 21.5}, w)
+}
+
+func TestJSONSchema_Invalid(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{"sunny", "sunny"}}
+	_, err := NewInstance("scripted", WithProvider(provider)).
+		Invoke(context.Background(), nil, WithResponseFormat(&ChatCompletionResponseFormat{Type: ChatCompletionResponseFormatTypeJSONObject, Repairs: 1}))
+	assert.ErrorIs(t, err, ErrInvalidStructuredOutput)
+}
+
+func TestJSONSchema_NativeRequest(t *testing.T) {
+	request := NewOAILLM("", "").buildRequest(nil, &InvokeOptions{ResponseFormat: NewJSONSchemaFormat(weather{})})
+	payload, err := json.Marshal(request)
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), `"type":"json_schema"`)
+	assert.Contains(t, string(payload), `"name":"weather"`)
+	assert.Contains(t, string(payload), `"required":["city","temperature"]`)
+}
@@ -0,0 +1,201 @@
+package llm
+
+import "encoding/json"
+
+// StreamEventType ...
+type StreamEventType string
+
+const (
+	StreamEventTextDelta      StreamEventType = "text_delta"
+	StreamEventReasoningDelta StreamEventType = "reasoning_delta"
+	StreamEventToolCallStart  StreamEventType = "tool_call_start"
+	StreamEventToolCallDelta  StreamEventType = "tool_call_delta" // arguments delta
+	StreamEventToolCallDone   StreamEventType = "tool_call_done"  // arguments complete, ready to execute
+	StreamEventUsage          StreamEventType = "usage"
+	StreamEventFinish         StreamEventType = "finish"
+	// StreamEventApprovalRequired a tool call waits for approval, the run is paused
+	StreamEventApprovalRequired StreamEventType = "approval_required"
+	// StreamEventPlan the plan of a plan-and-execute run is created or updated, Plan is the plan json
+	StreamEventPlan StreamEventType = "plan"
+	// StreamEventError the provider failed in the middle of stream, Err is the typed error, followed by finish
+	StreamEventError StreamEventType = "error"
+)
+
+// FinishReasonApprovalRequired finish reason of the chunk carrying the tool calls waiting for approval
+const FinishReasonApprovalRequired = "approval_required"
+
+// FinishReasonError finish reason of the chunk carrying the error of provider in Chunk.Err
+const FinishReasonError = "error"
+
+// FinishReasonPlan finish reason of the chunk carrying the plan json in Chunk.Plan, the stream continues
+const FinishReasonPlan = "plan"
+
+// StreamEvent typed event decoded from chunks
+type StreamEvent struct {
+	Type         StreamEventType `json:"type"`
+	Delta        string          `json:"delta,omitempty"`     // text, reasoning or arguments delta
+	ToolCall     *ToolCall       `json:"tool_call,omitempty"` // merged so far, complete on tool_call_done
+	Usage        *Usage          `json:"usage,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Agent        string          `json:"agent,omitempty"` // emitting member of a team, see Chunk.Agent
+	Depth        int             `json:"depth,omitempty"`
+	Plan         json.RawMessage `json:"plan,omitempty"` // plan json of StreamEventPlan
+	Err          error           `json:"-"`              // error of StreamEventError, e.g. *ProviderError
+}
+
+// StreamDecoder decodes chunks to typed events, tool call deltas are merged by index.
+// A tool call is done once its arguments are a complete json value, or another tool call starts,
+// or the stream finishes.
+type StreamDecoder struct {
+	calls   map[int]*ToolCall
+	order   []int
+	done    map[int]bool
+	current int
+}
+
+// NewStreamDecoder ...
+func NewStreamDecoder() *StreamDecoder {
+	return &StreamDecoder{calls: map[int]*ToolCall{}, done: map[int]bool{}, current: -1}
+}
+
+// Decode returns events of the chunk
+func (d *StreamDecoder) Decode(chunk *Chunk) []*StreamEvent {
+	events := []*StreamEvent{}
+	if chunk == nil {
+		return events
+	}
+	finishReason := ""
+	if len(chunk.Choices) > 0 {
+		choice := chunk.Choices[0]
+		finishReason = choice.FinishReason
+		if finishReason == FinishReasonPlan {
+			event := &StreamEvent{Type: StreamEventPlan, Plan: chunk.Plan, Agent: chunk.Agent, Depth: chunk.Depth}
+			return append(events, event)
+		}
+		if finishReason == FinishReasonApprovalRequired && choice.Delta != nil {
+			events = append(events, d.Flush()...)
+			for _, call := range choice.Delta.ToolCalls {
+				events = append(events, &StreamEvent{Type: StreamEventApprovalRequired, ToolCall: d.snapshot(call)})
+			}
+		} else if delta := choice.Delta; delta != nil {
+			if delta.ReasoningContent != "" {
+				events = append(events, &StreamEvent{Type: StreamEventReasoningDelta, Delta: delta.ReasoningContent})
+			}
+			if delta.content != "" {
+				events = append(events, &StreamEvent{Type: StreamEventTextDelta, Delta: delta.content})
+			}
+			for _, call := range delta.ToolCalls {
+				events = append(events, d.decodeToolCall(call)...)
+			}
+		}
+	}
+	if chunk.Err != nil {
+		events = append(events, &StreamEvent{Type: StreamEventError, Err: chunk.Err})
+	}
+	if usage := chunk.Usage; usage != nil && (usage.TotalTokens > 0 || usage.PromptTokens > 0 || usage.CompletionTokens > 0) {
+		copied := *usage
+		events = append(events, &StreamEvent{Type: StreamEventUsage, Usage: &copied})
+	}
+	if finishReason != "" {
+		events = append(events, d.Flush()...)
+		events = append(events, &StreamEvent{Type: StreamEventFinish, FinishReason: finishReason})
+	}
+	for _, event := range events {
+		event.Agent, event.Depth = chunk.Agent, chunk.Depth
+	}
+	return events
+}
+
+// Flush completes the pending tool calls, called at the end of stream
+func (d *StreamDecoder) Flush() []*StreamEvent {
+	events := []*StreamEvent{}
+	for _, index := range d.order {
+		if !d.done[index] {
+			events = append(events, d.complete(index))
+		}
+	}
+	return events
+}
+
+func (d *StreamDecoder) decodeToolCall(delta *ToolCall) []*StreamEvent {
+	events := []*StreamEvent{}
+	call, ok := d.calls[delta.Index]
+	if !ok || (delta.ID != "" && call.ID != "" && delta.ID != call.ID) { // a new tool call
+		if d.current >= 0 && !d.done[d.current] {
+			events = append(events, d.complete(d.current))
+		}
+		copied := *delta
+		copied.Function.Arguments = ""
+		call = &copied
+		d.calls[delta.Index] = call
+		d.order = append(d.order, delta.Index)
+		delete(d.done, delta.Index)
+		d.current = delta.Index
+		events = append(events, &StreamEvent{Type: StreamEventToolCallStart, ToolCall: d.snapshot(call)})
+	} else {
+		call.ID += delta.ID
+		call.Type += delta.Type
+		call.Function.Name += delta.Function.Name
+	}
+	if delta.Function.Arguments == "" || d.done[delta.Index] {
+		return events
+	}
+	call.Function.Arguments += delta.Function.Arguments
+	events = append(events, &StreamEvent{Type: StreamEventToolCallDelta, Delta: delta.Function.Arguments, ToolCall: d.snapshot(call)})
+	if json.Valid([]byte(call.Function.Arguments)) { // a complete json value can not be extended
+		events = append(events, d.complete(delta.Index))
+	}
+	return events
+}
+
+func (d *StreamDecoder) complete(index int) *StreamEvent {
+	d.done[index] = true
+	return &StreamEvent{Type: StreamEventToolCallDone, ToolCall: d.snapshot(d.calls[index])}
+}
+
+func (d *StreamDecoder) snapshot(call *ToolCall) *ToolCall {
+	copied := *call
+	return &copied
+}
+
+// Events decodes the chunks to typed events until chunks closed,
+// chunks of team members are decoded separately by Agent and Depth
+func Events(chunks <-chan *Chunk) <-chan *StreamEvent {
+	events := make(chan *StreamEvent, 10)
+	go func() {
+		defer close(events)
+		type emitter struct {
+			agent string
+			depth int
+		}
+		decoders := map[emitter]*StreamDecoder{}
+		order := []emitter{}
+		for chunk := range chunks {
+			if chunk == nil {
+				continue
+			}
+			key := emitter{chunk.Agent, chunk.Depth}
+			decoder, ok := decoders[key]
+			if !ok {
+				decoder = NewStreamDecoder()
+				decoders[key] = decoder
+				order = append(order, key)
+			}
+			for _, event := range decoder.Decode(chunk) {
+				events <- event
+			}
+		}
+		for _, key := range order {
+			for _, event := range decoders[key].Flush() {
+				event.Agent, event.Depth = key.agent, key.depth
+				events <- event
+			}
+		}
+	}()
+	return events
+}
+
+// Events decodes the stream to typed events, the stream is consumed
+func (s *Stream) Events() <-chan *StreamEvent {
+	return Events(s.q)
+}
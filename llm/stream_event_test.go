@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream_Events(t *testing.T) {
+	response, err := NewInstance("scripted", WithProvider(&toolCallProvider{})).
+		Invoke(context.Background(), []Message{NewUserTextMessage("weather of Beijing")})
+	assert.NoError(t, err)
+
+	types := []StreamEventType{}
+	var done *ToolCall
+	for event := range response.Stream().Events() {
+		types = append(types, event.Type)
+		if event.Type == StreamEventToolCallDone {
+			done = event.ToolCall
+		}
+	}
+	assert.Equal(t, []StreamEventType{
+		StreamEventToolCallStart, StreamEventToolCallDelta,
+		StreamEventToolCallDelta, StreamEventToolCallDone,
+		StreamEventUsage, StreamEventFinish,
+	}, types)
+	assert.Equal(t, "call_1", done.ID)
+	assert.Equal(t, "weather", done.Function.Name)
+	assert.Equal(t, `{"city":"Beijing"}`, done.Function.Arguments)
+}
+
+func TestStreamDecoder_NextToolCall(t *testing.T) {
+	decoder := NewStreamDecoder()
+	first := NewAssistantMessage("checking")
+	first.ToolCalls = []*ToolCall{{Index: 0, ID: "a", Function: ToolCallFunction{Name: "weather", Arguments: `{"city":`}}}
+	events := decoder.Decode(NewChunk(0, first, nil))
+	assert.Equal(t, StreamEventTextDelta, events[0].Type)
+
+	second := NewAssistantMessage("")
+	second.ToolCalls = []*ToolCall{{Index: 1, ID: "b", Function: ToolCallFunction{Name: "time"}}}
+	events = decoder.Decode(NewChunk(0, second, nil))
+	assert.Equal(t, StreamEventToolCallDone, events[0].Type) // previous one is completed by the next one
+	assert.Equal(t, "a", events[0].ToolCall.ID)
+	assert.Equal(t, StreamEventToolCallStart, events[1].Type)
+
+	events = decoder.Flush()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "b", events[0].ToolCall.ID)
+}
+
+func TestStreamDecoder_ApprovalRequired(t *testing.T) {
+	decoder := NewStreamDecoder()
+	call := &ToolCall{ID: "a", Function: ToolCallFunction{Name: "write_file", Arguments: `{"path":"a.txt"}`}}
+	decoder.Decode(NewChunk(0, NewAssistantMessage("").WithToolCalls([]*ToolCall{call}), nil))
+
+	chunk := NewChunk(0, NewAssistantMessage("").WithToolCalls([]*ToolCall{call}), nil)
+	chunk.Choices[0].FinishReason = FinishReasonApprovalRequired
+	events := decoder.Decode(chunk)
+	assert.Len(t, events, 2)
+	assert.Equal(t, StreamEventApprovalRequired, events[0].Type)
+	assert.Equal(t, `{"path":"a.txt"}`, events[0].ToolCall.Function.Arguments)
+	assert.Equal(t, FinishReasonApprovalRequired, events[1].FinishReason)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/openai/openai-go"
 	"github.com/showntop/llmack/llm"
@@ -89,27 +92,66 @@ func (m *LLM) Invoke(ctx context.Context, messages []llm.Message, opts *llm.Invo
 			Parameters:  params,
 		})
 	}
+	started := make(chan struct{}) // closed once anything is streamed, or the stream ends
+	var once sync.Once
 	service := m.client.
 		ChatCompletion(opts.Model).
 		AddMessage(internalMessages...).
 		AddTool(internalTools...).
 		SetStreamHandler(func(chunk zhipu.ChatCompletionResponse) error {
-			// println("chunk content: ", chunk.Choices[0].Delta.Content)
+			if len(chunk.Choices) == 0 {
+				return nil
+			}
+			once.Do(func() { close(started) })
 			mmm := llm.NewAssistantMessage(chunk.Choices[0].Delta.Content)
 			response.Stream().Push(llm.NewChunk(0, mmm, nil))
 			return nil
 		})
 
+	failed := make(chan error, 1) // the request failed before streaming, returned by Invoke to be retried
 	go func() {
 		defer response.Stream().Close()
 		_, err := service.Do(ctx)
 		if err != nil {
-			panic(err)
-			// return nil, err
+			err = providerError(err)
+			select {
+			case <-started:
+				response.Stream().Push(llm.NewErrorChunk(err))
+			default:
+				failed <- err
+				return
+			}
 		}
+		once.Do(func() { close(started) })
 	}()
 
-	return response, nil
+	select {
+	case <-started:
+		return response, nil
+	case err := <-failed:
+		return nil, fmt.Errorf("zhipu chat completions request error: %w", err)
+	}
+}
+
+// providerError classifies the api error by code and the stream error "429 Too Many Requests" by status,
+// others are transport errors
+func providerError(err error) error {
+	if code := zhipu.GetAPIErrorCode(err); code != "" {
+		return llm.NewStatusError(errorStatus[code], nil, code+": "+zhipu.GetAPIErrorMessage(err))
+	}
+	if status, _, ok := strings.Cut(err.Error(), " "); ok {
+		if code, perr := strconv.Atoi(status); perr == nil && code >= 400 {
+			return llm.NewStatusError(code, nil, err.Error())
+		}
+	}
+	return llm.NewTransportError(err)
+}
+
+// errorStatus http status of the api error codes of zhipu
+var errorStatus = map[string]int{
+	"1000": 401, "1001": 401, "1002": 401, "1003": 401, "1004": 401, // authentication
+	"1302": 429, "1303": 429, "1305": 429, // concurrency and rate limits
+	"500": 500,
 }
 
 func (m *LLM) setupClient() error {
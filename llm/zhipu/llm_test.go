@@ -0,0 +1,17 @@
+package zhipu
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/yankeguo/zhipu"
+)
+
+func TestProviderError(t *testing.T) {
+	assert.ErrorIs(t, providerError(errors.New("429 Too Many Requests")), llm.ErrRateLimited)
+	assert.ErrorIs(t, providerError(errors.New("503 Service Unavailable")), llm.ErrTransient)
+	assert.ErrorIs(t, providerError(zhipu.APIError{Code: "1302", Message: "rate limited"}), llm.ErrRateLimited)
+	assert.ErrorIs(t, providerError(errors.New("dial tcp: i/o timeout")), llm.ErrTransient)
+}
@@ -0,0 +1,49 @@
+package strings
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize 分词用于关键词检索：拉丁文按单词小写切分（保留词内的 - _ .，如产品编号），
+// 中日韩文字无空格分隔，按单字与相邻双字切分
+func Tokenize(s string) []string {
+	tokens := []string{}
+	word := strings.Builder{}
+	cjk := []rune{}
+	flushWord := func() {
+		if token := strings.Trim(word.String(), "-_."); token != "" {
+			tokens = append(tokens, token)
+		}
+		word.Reset()
+	}
+	flushCJK := func() {
+		for i, r := range cjk {
+			tokens = append(tokens, string(r))
+			if i+1 < len(cjk) {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || (word.Len() > 0 && strings.ContainsRune("-_.", r)):
+			flushCJK()
+			word.WriteRune(r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
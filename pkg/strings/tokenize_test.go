@@ -0,0 +1,11 @@
+package strings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"order", "sku-1234", "退", "退款", "款"}, Tokenize("Order SKU-1234. 退款"))
+}
@@ -3,8 +3,10 @@ package program
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -82,13 +84,7 @@ func (ada *MarkableInputAdapter) Format(p *predictor, inputs map[string]any, _ a
 	sysPromptBuilder.WriteByte('\n')
 
 	userPromptBuilder := strings.Builder{}
-	for name, value := range inputs {
-		userPromptBuilder.WriteString("[[ ## " + name + " ## ]]")
-		userPromptBuilder.WriteByte('\n')
-		userPromptBuilder.WriteString(value.(string))
-		userPromptBuilder.WriteByte('\n')
-		userPromptBuilder.WriteByte('\n')
-	}
+	userPromptBuilder.WriteString(markableFields(inputs))
 	userPromptBuilder.WriteString("Respond with the corresponding output fields, starting with the field ")
 	i := 0
 	for _, out := range p.OutputFields {
@@ -103,29 +99,35 @@ func (ada *MarkableInputAdapter) Format(p *predictor, inputs map[string]any, _ a
 	}
 	userPromptBuilder.WriteString(", and then ending with the marker for `[[ ## completed ## ]]`.")
 
-	messages := []llm.Message{
-		llm.NewSystemMessage(sysPromptBuilder.String()),
-		llm.NewUserTextMessage(userPromptBuilder.String()),
+	messages := []llm.Message{llm.NewSystemMessage(sysPromptBuilder.String())}
+	for _, demo := range p.Demos {
+		messages = append(messages,
+			llm.NewUserTextMessage(markableFields(demo.Inputs)),
+			llm.NewAssistantMessage(markableFields(demo.Outputs)+"[[ ## completed ## ]]"))
 	}
+	messages = append(messages, llm.NewUserTextMessage(userPromptBuilder.String()))
 	return messages, nil
 }
 
+// markableFields renders values as marked fields in the order of names
+func markableFields(values map[string]any) string {
+	builder := strings.Builder{}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		builder.WriteString("[[ ## " + name + " ## ]]")
+		builder.WriteByte('\n')
+		builder.WriteString(fmt.Sprint(values[name]))
+		builder.WriteByte('\n')
+		builder.WriteByte('\n')
+	}
+	return builder.String()
+}
+
 type MarkableOutputAdapter struct {
 }
 
 // Parse ...
 func (ada *MarkableOutputAdapter) Parse(completion string, object any) error {
-	fieldHeaderPattern := regexp.MustCompile(`\[\[ ## (\w+) ## \]\]`) // Replace with the actual regex pattern
-
-	sections := make([][2]string, 1)
-	for _, line := range strings.Split(completion, "\n") {
-		match := fieldHeaderPattern.FindStringSubmatch(strings.TrimSpace(line))
-		if match != nil {
-			sections = append(sections, [2]string{match[1], ""})
-		} else {
-			sections[len(sections)-1][1] += line + "\n"
-		}
-	}
+	sections := markableSections(completion)
 	// 处理 object
 	objectValue := reflect.ValueOf(object).Elem()
 	for i := range sections {
@@ -179,6 +181,22 @@ func (ada *MarkableOutputAdapter) Parse(completion string, object any) error {
 	return nil
 }
 
+var fieldHeaderPattern = regexp.MustCompile(`\[\[ ## (\w+) ## \]\]`)
+
+// markableSections splits completion into (field, value) by the field markers, the first is the text before markers
+func markableSections(completion string) [][2]string {
+	sections := make([][2]string, 1)
+	for _, line := range strings.Split(completion, "\n") {
+		match := fieldHeaderPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match != nil {
+			sections = append(sections, [2]string{match[1], ""})
+		} else {
+			sections[len(sections)-1][1] += line + "\n"
+		}
+	}
+	return sections
+}
+
 // JSONAdapter ...
 type JSONAdapter struct {
 	target any
@@ -293,10 +311,17 @@ func (ada *JSONAdapter) Format(p *predictor, inputs map[string]any, target any)
 		i++
 	}
 
-	messages := []llm.Message{
-		llm.NewSystemMessage(sysPromptBuilder.String()),
-		llm.NewUserTextMessage(userPromptBuilder.String()),
+	messages := []llm.Message{llm.NewSystemMessage(sysPromptBuilder.String())}
+	for _, demo := range p.Demos {
+		outputs, err := json.Marshal(demo.Outputs)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages,
+			llm.NewUserTextMessage(markableFields(demo.Inputs)),
+			llm.NewAssistantMessage(string(outputs)))
 	}
+	messages = append(messages, llm.NewUserTextMessage(userPromptBuilder.String()))
 	return messages, nil
 }
 
@@ -330,6 +355,14 @@ func (ada *RawInputAdapter) Format(p *predictor, inputs map[string]any, _ any) (
 	userPromptBuilder := strings.Builder{}
 	userPromptBuilder.WriteString(p.Instruction)
 	userPromptBuilder.WriteByte('\n')
+	if len(p.Demos) > 0 {
+		userPromptBuilder.WriteString("\nExamples:\n")
+		for _, demo := range p.Demos {
+			userPromptBuilder.WriteString("---\n")
+			userPromptBuilder.WriteString(markableFields(demo.Inputs))
+			userPromptBuilder.WriteString(markableFields(demo.Outputs))
+		}
+	}
 	messages := []llm.Message{
 		llm.NewSystemMessage(userPromptBuilder.String()),
 	}
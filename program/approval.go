@@ -0,0 +1,198 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/tool"
+)
+
+// ErrApprovalRequired the run is paused until the pending tool calls are approved, see predictor.Resume
+var ErrApprovalRequired = errors.New("tool call approval required")
+
+// ApprovalAction ...
+type ApprovalAction string
+
+const (
+	ApprovalApprove ApprovalAction = "approve"
+	ApprovalReject  ApprovalAction = "reject"
+	ApprovalEdit    ApprovalAction = "edit" // approve with edited arguments
+)
+
+// ApprovalDecision 审批结果
+type ApprovalDecision struct {
+	Action    ApprovalAction `json:"action"`
+	Arguments string         `json:"arguments,omitempty"` // edited arguments of ApprovalEdit
+	Reason    string         `json:"reason,omitempty"`    // told to the model on ApprovalReject
+}
+
+// Approve ...
+func Approve() *ApprovalDecision {
+	return &ApprovalDecision{Action: ApprovalApprove}
+}
+
+// Reject ...
+func Reject(reason string) *ApprovalDecision {
+	return &ApprovalDecision{Action: ApprovalReject, Reason: reason}
+}
+
+// EditArguments ...
+func EditArguments(arguments string) *ApprovalDecision {
+	return &ApprovalDecision{Action: ApprovalEdit, Arguments: arguments}
+}
+
+// ApprovalPolicy 工具审批策略
+type ApprovalPolicy struct {
+	// Tools require approval by name, a trailing * matches the prefix, e.g. mcp_*.
+	// Tools marked with tool.WithRequireApproval always require approval.
+	Tools []string
+	// Require decides by the tool call, optional
+	Require func(*llm.ToolCall) bool
+	// Approver decides synchronously, the run pauses with ErrApprovalRequired if nil
+	Approver func(context.Context, *llm.ToolCall) (*ApprovalDecision, error)
+}
+
+// RequireApproval returns a policy pausing the run for the tools
+func RequireApproval(tools ...string) *ApprovalPolicy {
+	return &ApprovalPolicy{Tools: tools}
+}
+
+func (p *ApprovalPolicy) requires(call *llm.ToolCall) bool {
+	if p == nil {
+		return false
+	}
+	if tool.Spawn(call.Function.Name).RequireApproval {
+		return true
+	}
+	for _, name := range p.Tools {
+		if name == call.Function.Name || name == "*" ||
+			(strings.HasSuffix(name, "*") && strings.HasPrefix(call.Function.Name, strings.TrimSuffix(name, "*"))) {
+			return true
+		}
+	}
+	return p.Require != nil && p.Require(call)
+}
+
+// RequireActions requires approval of the action tools, e.g. BrowserUse and MobileUse,
+// when any of the actions is requested, e.g. input_text, send_keys
+func RequireActions(actions ...string) func(*llm.ToolCall) bool {
+	return func(call *llm.ToolCall) bool {
+		var arguments struct {
+			Actions []map[string]any `json:"actions"`
+		}
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+			return false
+		}
+		for _, action := range arguments.Actions {
+			for _, name := range actions {
+				if _, ok := action[name]; ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// Checkpoint 等待审批时的运行状态，可序列化后在其他进程中恢复
+type Checkpoint struct {
+	Messages  []*llm.MessageRecord `json:"messages"`  // messages of the run without system prompt, e.g. history and query
+	Observers []*llm.MessageRecord `json:"observers"` // tool calls and results so far, the last one requests the pending tools
+	Results   map[string]string    `json:"results"`   // results of tool calls not requiring approval
+	Pending   []*llm.ToolCall      `json:"pending"`   // tool calls waiting for approval
+	// Plan the plan of PlanExecute paused in a step, the fields above are of the step executor
+	Plan json.RawMessage `json:"plan,omitempty"`
+}
+
+// resumer an invoker checkpointing more than the tool calls, e.g. PlanExecute
+type resumer interface {
+	resumeCheckpoint(ctx context.Context, cp *Checkpoint, decisions map[string]*ApprovalDecision) *predictor
+}
+
+// resume executes the pending tool calls with decisions, returns messages and observers to continue
+func (cp *Checkpoint) resume(ctx context.Context, decisions map[string]*ApprovalDecision,
+	invoke func(context.Context, *llm.ToolCall) string) ([]llm.Message, []llm.Message, error) {
+	observers := llm.RestoreMessages(cp.Observers)
+	if len(observers) == 0 || len(observers[len(observers)-1].GetToolCalls()) == 0 {
+		return nil, nil, fmt.Errorf("invalid checkpoint without tool calls")
+	}
+	results := map[string]string{}
+	for id, result := range cp.Results {
+		results[id] = result
+	}
+	pending := map[string]bool{}
+	for _, call := range cp.Pending {
+		pending[call.ID] = true
+	}
+	toolCalls := observers[len(observers)-1].GetToolCalls()
+	for _, call := range toolCalls {
+		if !pending[call.ID] {
+			continue
+		}
+		decision, ok := decisions[call.ID]
+		if !ok || decision == nil {
+			return nil, nil, fmt.Errorf("no approval decision of tool call %s(%s)", call.Function.Name, call.ID)
+		}
+		if result, run := applyDecision(call, decision); !run {
+			results[call.ID] = result
+			continue
+		}
+		results[call.ID] = invoke(ctx, call)
+	}
+	for _, call := range toolCalls {
+		observers = append(observers, llm.NewToolMessage(results[call.ID], call.ID))
+	}
+	return llm.RestoreMessages(cp.Messages), observers, nil
+}
+
+// applyDecision edits the arguments of call, returns false with the result told to the model if rejected
+func applyDecision(call *llm.ToolCall, decision *ApprovalDecision) (string, bool) {
+	switch decision.Action {
+	case ApprovalReject:
+		result := "tool call rejected by user"
+		if decision.Reason != "" {
+			result += ": " + decision.Reason
+		}
+		return result, false
+	case ApprovalEdit:
+		call.Function.Arguments = decision.Arguments
+	}
+	return "", true
+}
+
+// Checkpoint returns the state of the run paused with ErrApprovalRequired
+func (p *predictor) Checkpoint() *Checkpoint {
+	if p.reponse == nil {
+		return nil
+	}
+	return p.reponse.checkpoint
+}
+
+// Resume continues the run paused with ErrApprovalRequired, decisions of the pending tool calls by id.
+// The predictor must be configured as the paused one, e.g. instruction and tools.
+func (p *predictor) Resume(ctx context.Context, cp *Checkpoint, decisions map[string]*ApprovalDecision) *predictor {
+	p.reponse = NewResponse()
+	if p.stream {
+		go p.resume(ctx, cp, decisions)
+		return p
+	}
+	return p.resume(ctx, cp, decisions)
+}
+
+func (p *predictor) resume(ctx context.Context, cp *Checkpoint, decisions map[string]*ApprovalDecision) *predictor {
+	if r, ok := p.invoker.(resumer); ok {
+		return r.resumeCheckpoint(ctx, cp, decisions)
+	}
+	messages, observers, err := cp.resume(ctx, decisions, p.invokeTool)
+	if err != nil {
+		p.reponse.err = err
+		close(p.reponse.stream)
+		return p
+	}
+	p.observers = observers
+	return p.invoker.Invoke(ctx, messages, "", p.inputs)
+}
@@ -0,0 +1,94 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/tool"
+	"github.com/stretchr/testify/assert"
+)
+
+// toolCallingProvider requests the tool once, then answers done
+type toolCallingProvider struct {
+	requests [][]llm.Message
+}
+
+func (s *toolCallingProvider) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	s.requests = append(s.requests, messages)
+	message := llm.NewAssistantMessage("done")
+	if len(s.requests) == 1 {
+		call := &llm.ToolCall{ID: "call_1", Type: "function",
+			Function: llm.ToolCallFunction{Name: "approval_note", Arguments: `{"text":"rm -rf /"}`}}
+		message = llm.NewAssistantMessage("").WithToolCalls([]*llm.ToolCall{call})
+	}
+	response := llm.NewStreamResponse()
+	go func() {
+		defer response.Stream().Close()
+		response.Stream().Push(llm.NewChunk(0, message, &llm.Usage{TotalTokens: 10}))
+	}()
+	return response, nil
+}
+
+func TestFuncall_Approval(t *testing.T) {
+	invoked := []string{}
+	tool.Register(tool.New(
+		tool.WithName("approval_note"),
+		tool.WithRequireApproval(true),
+		tool.WithFunction(func(ctx context.Context, args string) (string, error) {
+			invoked = append(invoked, args)
+			return "saved", nil
+		}),
+	))
+	ctx := context.Background()
+
+	// pause without approver
+	provider := &toolCallingProvider{}
+	model := llm.NewInstance("scripted", llm.WithProvider(provider))
+	p := FunCall(WithLLMInstance(model), WithApproval(RequireApproval())).
+		WithTools("approval_note").WithStream(true).InvokeQuery(ctx, "take a note")
+	finishReasons := []string{}
+	for chunk := range p.Stream() {
+		finishReasons = append(finishReasons, chunk.Choices[0].FinishReason)
+	}
+	assert.ErrorIs(t, p.Error(), ErrApprovalRequired)
+	assert.Contains(t, finishReasons, llm.FinishReasonApprovalRequired)
+	assert.Empty(t, invoked)
+	assert.Len(t, p.Checkpoint().Pending, 1)
+
+	// resume from the persisted checkpoint with edited arguments
+	raw, err := json.Marshal(p.Checkpoint())
+	assert.NoError(t, err)
+	checkpoint := &Checkpoint{}
+	assert.NoError(t, json.Unmarshal(raw, checkpoint))
+	resumed := FunCall(WithLLMInstance(model), WithApproval(RequireApproval())).WithTools("approval_note").
+		Resume(ctx, checkpoint, map[string]*ApprovalDecision{"call_1": EditArguments(`{"text":"hello"}`)})
+	assert.NoError(t, resumed.Error())
+	assert.Equal(t, "done", resumed.Completion())
+	assert.Equal(t, []string{`{"text":"hello"}`}, invoked)
+	last := provider.requests[1]
+	assert.Equal(t, "take a note", last[len(last)-3].Content())
+	assert.Equal(t, `{"text":"hello"}`, last[len(last)-2].GetToolCalls()[0].Function.Arguments)
+	assert.Equal(t, "saved", last[len(last)-1].Content())
+	assert.Len(t, resumed.Messages(), 3)
+
+	// reject by approver synchronously
+	provider = &toolCallingProvider{}
+	rejected := FunCall(WithLLMInstance(llm.NewInstance("scripted", llm.WithProvider(provider))),
+		WithApproval(&ApprovalPolicy{Approver: func(ctx context.Context, call *llm.ToolCall) (*ApprovalDecision, error) {
+			return Reject("not allowed"), nil
+		}})).WithTools("approval_note").InvokeQuery(ctx, "take a note")
+	assert.NoError(t, rejected.Error())
+	assert.Len(t, invoked, 1)
+	last = provider.requests[1]
+	assert.Equal(t, "tool call rejected by user: not allowed", last[len(last)-1].Content())
+}
+
+func TestRequireActions(t *testing.T) {
+	require := RequireActions("input_text")
+	assert.True(t, require(&llm.ToolCall{Function: llm.ToolCallFunction{Name: "BrowserUse",
+		Arguments: `{"actions":[{"go_to_url":{"url":"x"}},{"input_text":{"index":1,"text":"a"}}]}`}}))
+	assert.False(t, require(&llm.ToolCall{Function: llm.ToolCallFunction{Name: "BrowserUse",
+		Arguments: `{"actions":[{"go_to_url":{"url":"x"}}]}`}}))
+}
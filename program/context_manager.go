@@ -0,0 +1,209 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/log"
+)
+
+// ContextStrategy 接近上下文上限时的压缩策略
+type ContextStrategy string
+
+const (
+	// TruncateToolResults truncates tool results longer than MaxToolResultTokens
+	TruncateToolResults ContextStrategy = "truncate_tool_results"
+	// DropToolOutputs replaces the oldest tool outputs with a placeholder
+	DropToolOutputs ContextStrategy = "drop_tool_outputs"
+	// SummarizeTurns asks the llm to summarize the earlier steps
+	SummarizeTurns ContextStrategy = "summarize_turns"
+)
+
+const droppedToolOutput = "[tool output removed to save context]"
+
+var summarizeStepsPrompt = `Summarize the earlier steps of the task below: the tools called, the key results
+and what is still to be done. Keep exact values that later steps may need. Reply with the summary only.`
+
+// ContextManager 上下文窗口管理：按模型上下文长度统计每条消息的 token，接近上限时按策略压缩
+// 工具调用（assistant tool_calls 与其 tool 结果）作为整体保留或丢弃，避免 provider 拒绝请求。
+type ContextManager struct {
+	MaxTokens           int                      // context length, llm.ContextWindow of the model if 0
+	Reserve             int                      // tokens reserved for completion, default 4096
+	Threshold           float64                  // compact once over Threshold of the available tokens, default 0.8
+	MaxToolResultTokens int                      // default 2000
+	KeepRecent          int                      // recent tool call groups never compacted, default 2
+	Strategies          []ContextStrategy        // applied in order until under the limit
+	Counter             func(...llm.Message) int // default llm.EstimateTokens
+	Summarizer          *llm.Instance            // model to summarize, the invoking model if nil
+}
+
+// NewContextManager ...
+func NewContextManager(strategies ...ContextStrategy) *ContextManager {
+	if len(strategies) == 0 {
+		strategies = []ContextStrategy{TruncateToolResults, DropToolOutputs, SummarizeTurns}
+	}
+	return &ContextManager{Strategies: strategies}
+}
+
+func (m *ContextManager) count(messages ...llm.Message) int {
+	if m.Counter != nil {
+		return m.Counter(messages...)
+	}
+	return llm.EstimateTokens(messages...)
+}
+
+// limit of the tail tokens
+func (m *ContextManager) limit(model *llm.Instance, head []llm.Message) int {
+	maxTokens := m.MaxTokens
+	if maxTokens <= 0 && model != nil {
+		maxTokens = llm.ContextWindow(model.Model())
+	}
+	if maxTokens <= 0 {
+		maxTokens = llm.DefaultContextWindow
+	}
+	reserve := m.Reserve
+	if reserve <= 0 {
+		reserve = min(4096, maxTokens/4)
+	}
+	threshold := m.Threshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = 0.8
+	}
+	return int(float64(maxTokens-reserve)*threshold) - m.count(head...)
+}
+
+// Fit compacts tail, the messages appended by the program (assistant tool calls and tool results),
+// so that head and tail fit the context window of model. head, the system prompt and query, is kept as is.
+func (m *ContextManager) Fit(ctx context.Context, model *llm.Instance, head, tail []llm.Message) ([]llm.Message, error) {
+	limit := m.limit(model, head)
+	if m.count(tail...) <= limit {
+		return tail, nil
+	}
+	if limit <= 0 {
+		log.WarnContextf(ctx, "program context manager: head messages exceed the context window")
+	}
+	groups := groupToolCalls(tail)
+	keepRecent := m.KeepRecent
+	if keepRecent <= 0 {
+		keepRecent = 2
+	}
+	for _, strategy := range m.Strategies {
+		var err error
+		switch strategy {
+		case TruncateToolResults:
+			groups = m.truncateToolResults(groups)
+		case DropToolOutputs:
+			groups = m.dropToolOutputs(groups, keepRecent, limit)
+		case SummarizeTurns:
+			groups, err = m.summarize(ctx, model, head, groups, keepRecent)
+		default:
+			err = fmt.Errorf("unknown context strategy %s", strategy)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m.count(flattenGroups(groups)...) <= limit {
+			return flattenGroups(groups), nil
+		}
+	}
+	// drop the oldest groups as the last resort, keep at least the latest one
+	for len(groups) > 1 && m.count(flattenGroups(groups)...) > limit {
+		groups = groups[1:]
+	}
+	return flattenGroups(groups), nil
+}
+
+func (m *ContextManager) truncateToolResults(groups [][]llm.Message) [][]llm.Message {
+	maxTokens := m.MaxToolResultTokens
+	if maxTokens <= 0 {
+		maxTokens = 2000
+	}
+	for _, group := range groups {
+		for i, message := range group {
+			if message.Role() != llm.MessageRoleTool || m.count(message) <= maxTokens {
+				continue
+			}
+			runes := []rune(message.Content())
+			keep := len(runes) * maxTokens / m.count(message)
+			content := string(runes[:keep]) + fmt.Sprintf("\n...[truncated %d characters]", len(runes)-keep)
+			group[i] = llm.NewToolMessage(content, message.ToolID())
+		}
+	}
+	return groups
+}
+
+func (m *ContextManager) dropToolOutputs(groups [][]llm.Message, keepRecent int, limit int) [][]llm.Message {
+	for _, group := range groups[:max(len(groups)-keepRecent, 0)] {
+		for i, message := range group {
+			if m.count(flattenGroups(groups)...) <= limit {
+				return groups
+			}
+			if message.Role() == llm.MessageRoleTool && message.Content() != droppedToolOutput {
+				group[i] = llm.NewToolMessage(droppedToolOutput, message.ToolID())
+			}
+		}
+	}
+	return groups
+}
+
+func (m *ContextManager) summarize(ctx context.Context, model *llm.Instance,
+	head []llm.Message, groups [][]llm.Message, keepRecent int) ([][]llm.Message, error) {
+	n := len(groups) - keepRecent
+	if n <= 0 {
+		return groups, nil
+	}
+	if m.Summarizer != nil {
+		model = m.Summarizer
+	}
+	if model == nil {
+		return groups, nil
+	}
+	builder := strings.Builder{}
+	for _, message := range head {
+		if message.Role() == llm.MessageRoleUser {
+			builder.WriteString("task: " + message.Content() + "\n")
+		}
+	}
+	for _, message := range flattenGroups(groups[:n]) {
+		builder.WriteString(string(message.Role()) + ": " + message.Content())
+		for _, call := range message.GetToolCalls() {
+			builder.WriteString(" call " + call.Function.Name + "(" + call.Function.Arguments + ")")
+		}
+		builder.WriteString("\n")
+	}
+	response, err := model.Invoke(ctx, []llm.Message{
+		llm.NewSystemMessage(summarizeStepsPrompt),
+		llm.NewUserTextMessage(builder.String()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("program context manager summarize error: %w", err)
+	}
+	summary := llm.NewUserTextMessage("Summary of the earlier steps:\n" + response.Result().Message.Content())
+	return append([][]llm.Message{{summary}}, groups[n:]...), nil
+}
+
+// groupToolCalls groups an assistant message with tool calls and its tool results, other messages are single groups
+func groupToolCalls(messages []llm.Message) [][]llm.Message {
+	groups := [][]llm.Message{}
+	for _, message := range messages {
+		if message.Role() == llm.MessageRoleTool && len(groups) > 0 {
+			last := groups[len(groups)-1]
+			if len(last[0].GetToolCalls()) > 0 {
+				groups[len(groups)-1] = append(last, message)
+				continue
+			}
+		}
+		groups = append(groups, []llm.Message{message})
+	}
+	return groups
+}
+
+func flattenGroups(groups [][]llm.Message) []llm.Message {
+	messages := []llm.Message{}
+	for _, group := range groups {
+		messages = append(messages, group...)
+	}
+	return messages
+}
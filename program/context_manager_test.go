@@ -0,0 +1,45 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func toolSteps(n int, result string) []llm.Message {
+	messages := []llm.Message{}
+	for i := range n {
+		id := fmt.Sprintf("call_%d", i)
+		call := &llm.ToolCall{ID: id, Type: "function", Function: llm.ToolCallFunction{Name: "search", Arguments: `{}`}}
+		messages = append(messages,
+			llm.NewAssistantMessage("").WithToolCalls([]*llm.ToolCall{call}),
+			llm.NewToolMessage(result, id))
+	}
+	return messages
+}
+
+func TestContextManager_Fit(t *testing.T) {
+	head := []llm.Message{llm.NewSystemMessage("you are a researcher"), llm.NewUserTextMessage("find it")}
+	manager := &ContextManager{MaxTokens: 3000, Reserve: 500, Threshold: 1, MaxToolResultTokens: 400,
+		Strategies: []ContextStrategy{TruncateToolResults, DropToolOutputs}}
+
+	tail := toolSteps(6, strings.Repeat("result ", 2000)) // ~3500 tokens per result
+	fitted, err := manager.Fit(context.Background(), nil, head, tail)
+	assert.NoError(t, err)
+	assert.Len(t, fitted, len(tail)) // tool call pairs are intact
+	assert.LessOrEqual(t, llm.EstimateTokens(append(head, fitted...)...), 2500)
+	for i := 0; i < len(fitted); i += 2 {
+		assert.Equal(t, fitted[i].GetToolCalls()[0].ID, fitted[i+1].ToolID())
+	}
+	assert.Contains(t, fitted[len(fitted)-1].Content(), "[truncated")
+
+	manager.Strategies = []ContextStrategy{DropToolOutputs}
+	fitted, err = manager.Fit(context.Background(), nil, head, tail)
+	assert.NoError(t, err)
+	assert.Less(t, len(fitted), len(tail)) // oldest groups are dropped as the last resort
+	assert.Equal(t, llm.MessageRoleAssistant, fitted[0].Role())
+}
@@ -3,8 +3,10 @@ package program
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 
+	"github.com/showntop/llmack/hooks"
 	"github.com/showntop/llmack/llm"
 	"github.com/showntop/llmack/log"
 	"github.com/showntop/llmack/prompt"
@@ -59,11 +61,14 @@ func (rp *funcall) invoke(ctx context.Context, messages []llm.Message, query str
 		rp.reponse.err = err
 		return rp.predictor, false
 	}
-	messages = append(systemMessages, messages...)
-
+	if rp.promptCache && len(systemMessages) > 0 { // system prompt is resent on every iteration
+		systemMessages[len(systemMessages)-1] = llm.MarkCache(systemMessages[len(systemMessages)-1])
+	}
+	conversation := append([]llm.Message{}, messages...)
 	if len(query) > 0 {
-		messages = append(messages, llm.NewUserTextMessage(query))
+		conversation = append(conversation, llm.NewUserTextMessage(query))
 	}
+	messages = append(systemMessages, conversation...)
 
 	llmResponse, err := rp.invokeLLM(ctx, messages)
 	if err != nil {
@@ -90,10 +95,17 @@ func (rp *funcall) invoke(ctx context.Context, messages []llm.Message, query str
 		toolCalls = append(toolCalls, t)
 		return t
 	}
+	var streamErr error
 	for chunk := range stream.Next() {
-		rp.Usage.PromptTokens += chunk.Usage.PromptTokens
-		rp.Usage.CompletionTokens += chunk.Usage.CompletionTokens
-		rp.Usage.TotalTokens += chunk.Usage.TotalTokens
+		if chunk.Err != nil { // the provider failed in the middle of stream
+			streamErr = chunk.Err
+		}
+		if chunk.Usage != nil {
+			rp.addUsage(*chunk.Usage)
+		}
+		if len(chunk.Choices) <= 0 { // usage only chunk
+			continue
+		}
 		deltaMessage := chunk.Choices[0].Delta
 		if len(deltaMessage.ToolCalls) > 0 { // tool call
 			for i := range deltaMessage.ToolCalls {
@@ -109,6 +121,10 @@ func (rp *funcall) invoke(ctx context.Context, messages []llm.Message, query str
 			rp.reponse.stream <- chunk
 		}
 	}
+	if streamErr != nil {
+		rp.reponse.err = streamErr
+		return rp.predictor, finish
+	}
 	rp.reponse.message = llm.NewAssistantMessage(answer)
 	if len(toolCalls) > 0 {
 		// 格式化输出 pretty
@@ -117,7 +133,7 @@ func (rp *funcall) invoke(ctx context.Context, messages []llm.Message, query str
 			log.InfoContextf(ctx, "%d: %s", i+1, toolCalls[i])
 		}
 		rp.observers = append(rp.observers, llm.NewAssistantMessage(answer).WithToolCalls(toolCalls))
-		toolResults, err := rp.invokeTools(ctx, toolCalls)
+		toolResults, pending, err := rp.invokeTools(ctx, toolCalls)
 		if err != nil { // 调用工具出错
 			if rp.stream {
 				rp.reponse.stream <- llm.NewChunk(0, llm.NewAssistantMessage(err.Error()), nil)
@@ -125,6 +141,10 @@ func (rp *funcall) invoke(ctx context.Context, messages []llm.Message, query str
 			rp.reponse.err = err
 			return rp.predictor, finish
 		}
+		if len(pending) > 0 { // 等待审批
+			rp.pause(conversation, toolResults, pending)
+			return rp.predictor, finish
+		}
 		log.InfoContextf(ctx, "\nprogram funcall invoke tools result:")
 		for i := range toolCalls {
 			log.InfoContextf(ctx, "%d: %s", i+1, toolResults[toolCalls[i].ID])
@@ -147,6 +167,13 @@ func (rp *funcall) invokeLLM(ctx context.Context, messages []llm.Message) (*llm.
 	if len(messageTools) <= 0 {
 		rp.toolChoice = "none"
 	}
+	if rp.contextManager != nil { // compact observers near the context window
+		observers, err := rp.contextManager.Fit(ctx, rp.model, messages, rp.observers)
+		if err != nil {
+			return nil, err
+		}
+		rp.observers = observers
+	}
 	// append observer message
 	messages = append(messages, rp.observers...)
 	if rp.resetMessages != nil {
@@ -233,23 +260,45 @@ func (rp *funcall) buildTools(tools ...any) []*llm.Tool {
 	return messageTools
 }
 
-func (rp *funcall) invokeTools(ctx context.Context, toolCalls []*llm.ToolCall) (map[string]string, error) {
-	// 并发调用
-	ch := make(chan [2]string, len(toolCalls))
-	// wg := errgroup.Group{}
-	wg := sync.WaitGroup{}
+func (rp *funcall) invokeTools(ctx context.Context, toolCalls []*llm.ToolCall) (map[string]string, []*llm.ToolCall, error) {
+	results := make(map[string]string) // 使用 chan fix 并发冲突
+	// 审批
+	approved, pending := []*llm.ToolCall{}, []*llm.ToolCall{}
 	for _, toolCall := range toolCalls {
+		if !rp.approval.requires(toolCall) {
+			approved = append(approved, toolCall)
+			continue
+		}
+		if rp.approval.Approver == nil {
+			pending = append(pending, toolCall)
+			continue
+		}
+		decision, err := rp.approval.Approver(ctx, toolCall)
+		if err != nil {
+			return nil, nil, fmt.Errorf("approve tool call %s error: %w", toolCall.Function.Name, err)
+		}
+		if result, run := applyDecision(toolCall, decision); !run {
+			results[toolCall.ID] = result
+			continue
+		}
+		approved = append(approved, toolCall)
+	}
+
+	// 并发调用，toolConcurrency 限制并发数
+	ch := make(chan [2]string, len(approved))
+	concurrency := len(approved)
+	if rp.toolConcurrency > 0 {
+		concurrency = min(concurrency, rp.toolConcurrency)
+	}
+	limit := make(chan struct{}, max(concurrency, 1))
+	wg := sync.WaitGroup{}
+	for _, toolCall := range approved {
 		wg.Add(1)
-		go func() error {
+		go func() {
 			defer wg.Done()
-			toolResult, err := tool.Spawn(toolCall.Function.Name).Invoke(ctx, toolCall.Function.Arguments)
-			if err != nil {
-				ch <- [2]string{toolCall.ID, "error with " + err.Error()}
-				return err
-			}
-			// log.InfoContextf(ctx, "program funcall invoke tool: %s, %s response: %s error: %v \n", toolCall.ID, toolCall.Function.Arguments, toolResult, err)
-			ch <- [2]string{toolCall.ID, toolResult}
-			return nil
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			ch <- [2]string{toolCall.ID, rp.invokeTool(ctx, toolCall)}
 		}()
 	}
 
@@ -258,9 +307,36 @@ func (rp *funcall) invokeTools(ctx context.Context, toolCalls []*llm.ToolCall) (
 		close(ch)
 	}()
 
-	results := make(map[string]string) // 使用 chan fix 并发冲突
 	for result := range ch {
 		results[result[0]] = result[1]
 	}
-	return results, nil
+	return results, pending, nil
+}
+
+// pause saves the checkpoint and emits the pending tool calls with llm.FinishReasonApprovalRequired
+func (rp *funcall) pause(conversation []llm.Message, results map[string]string, pending []*llm.ToolCall) {
+	rp.reponse.checkpoint = &Checkpoint{
+		Messages:  llm.NewMessageRecords(conversation),
+		Observers: llm.NewMessageRecords(rp.observers),
+		Results:   results,
+		Pending:   pending,
+	}
+	rp.reponse.err = ErrApprovalRequired
+	if rp.stream {
+		chunk := llm.NewChunk(0, llm.NewAssistantMessage("").WithToolCalls(pending), nil)
+		chunk.Choices[0].FinishReason = llm.FinishReasonApprovalRequired
+		rp.reponse.stream <- chunk
+	}
+}
+
+// invokeTool invokes the tool of call, errors are returned to the model as structured result to self-correct
+func (p *predictor) invokeTool(ctx context.Context, call *llm.ToolCall) string {
+	ctx, span := hooks.StartToolSpan(ctx, call.Function.Name, call.ID)
+	result, err := tool.Call(ctx, call.Function.Name, call.Function.Arguments, p.toolTimeout)
+	hooks.EndSpan(span, err)
+	if err != nil {
+		log.WarnContextf(ctx, "program funcall invoke tool %s error: %v", call.Function.Name, err)
+		return tool.AsError(call.Function.Name, err).Result()
+	}
+	return result
 }
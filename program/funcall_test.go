@@ -116,8 +116,30 @@ func TestFuncall_InvokeTools(t *testing.T) {
 		},
 	}
 
-	results, err := rp.invokeTools(ctx, toolCalls)
+	results, _, err := rp.invokeTools(ctx, toolCalls)
 	assert.NoError(t, err)
 	assert.NotNil(t, results)
 	assert.Contains(t, results, "test-id-1")
 }
+
+// streamErrorProvider fails in the middle of stream
+type streamErrorProvider struct{}
+
+func (streamErrorProvider) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	response := llm.NewStreamResponse()
+	go func() {
+		defer response.Stream().Close()
+		response.Stream().Push(llm.NewChunk(0, llm.NewAssistantMessage("Hel"), nil))
+		chunk := llm.NewChunk(0, llm.NewAssistantMessage(""), nil)
+		chunk.Choices[0].FinishReason = llm.FinishReasonError
+		chunk.Err = &llm.ProviderError{Kind: llm.ErrTransient, Message: "overloaded"}
+		response.Stream().Push(chunk)
+	}()
+	return response, nil
+}
+
+func TestFuncall_StreamError(t *testing.T) {
+	model := llm.NewInstance("stream-error", llm.WithProvider(streamErrorProvider{}))
+	p := FunCall(WithLLMInstance(model)).InvokeQuery(context.Background(), "hi")
+	assert.ErrorIs(t, p.Error(), llm.ErrTransient)
+}
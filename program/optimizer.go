@@ -0,0 +1,300 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/log"
+	"github.com/showntop/llmack/prompt"
+	"github.com/showntop/llmack/prompt/templates"
+)
+
+// Example 训练样本，输入输出按字段名
+type Example struct {
+	Inputs  map[string]any `json:"inputs"`
+	Outputs map[string]any `json:"outputs"`
+}
+
+// Metric scores the prediction of the example, higher is better, usually in [0, 1]
+type Metric func(ctx context.Context, example *Example, prediction map[string]any) float64
+
+// ExactMatch scores 1 if the fields (all outputs of the example if none) equal ignoring case and spaces
+func ExactMatch(fields ...string) Metric {
+	return func(ctx context.Context, example *Example, prediction map[string]any) float64 {
+		names := fields
+		if len(names) == 0 {
+			for name := range example.Outputs {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			expected := strings.TrimSpace(fmt.Sprint(example.Outputs[name]))
+			actual := strings.TrimSpace(fmt.Sprint(prediction[name]))
+			if !strings.EqualFold(expected, actual) {
+				return 0
+			}
+		}
+		return 1
+	}
+}
+
+// Optimizer DSPy 风格的提示词优化器：引导生成 few-shot 示例，并以 templates.MetaInstruction 与
+// templates.ThinkingStyles 生成指令变体，在训练集上按 Metric 选出最优组合
+type Optimizer struct {
+	TrainSet      []*Example
+	Metric        Metric
+	Teacher       *llm.Instance // 引导示例与生成指令变体的模型，默认 predictor 的模型
+	MaxDemos      int           // 最多示例数，默认 4
+	NumCandidates int           // 指令变体数，默认 5
+	Threshold     float64       // 预测得分不低于阈值才作为示例，默认 1
+	Concurrency   int           // 评估并发数，默认 4
+	Seed          int64         // 随机种子，用于打乱训练集与选择思考风格
+}
+
+// Compile tunes the instruction and demos of p on the train set in place and returns p,
+// the compiled predictor is saved by json.Marshal and reloaded by Load
+func (o *Optimizer) Compile(ctx context.Context, p *predictor) (*predictor, error) {
+	if len(o.TrainSet) == 0 || o.Metric == nil {
+		return nil, errors.New("optimizer requires train set and metric")
+	}
+	if err := plain(p); err != nil {
+		return nil, err
+	}
+	random := rand.New(rand.NewSource(o.Seed))
+	examples := append([]*Example{}, o.TrainSet...)
+	random.Shuffle(len(examples), func(i, j int) { examples[i], examples[j] = examples[j], examples[i] })
+
+	demos, used := o.bootstrap(ctx, p, examples)
+	valset := []*Example{}
+	for i, example := range examples {
+		if !used[i] {
+			valset = append(valset, example)
+		}
+	}
+	if len(valset) == 0 {
+		valset = examples
+	}
+
+	instructions, err := o.propose(ctx, p, random)
+	if err != nil { // keep the original instruction
+		log.WarnContextf(ctx, "optimizer propose instructions error: %v", err)
+	}
+	instructions = append([]string{p.Instruction}, instructions...)
+
+	best, bestScore := 0, -1.0
+	for i, instruction := range instructions {
+		candidate := *p
+		candidate.Instruction, candidate.Demos = instruction, demos
+		candidate.invoker = &candidate
+		score, err := o.Evaluate(ctx, &candidate, valset)
+		if err != nil {
+			return nil, err
+		}
+		log.InfoContextf(ctx, "optimizer candidate %d score %.3f", i, score)
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	p.Instruction, p.Demos = instructions[best], demos
+	return p, nil
+}
+
+// bootstrap runs the teacher on the examples, the predictions of enough score are the demos
+func (o *Optimizer) bootstrap(ctx context.Context, p *predictor, examples []*Example) ([]*Example, map[int]bool) {
+	maxDemos := o.MaxDemos
+	if maxDemos <= 0 {
+		maxDemos = 4
+	}
+	threshold := o.Threshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+	teacher := *p
+	teacher.Demos = nil
+	if o.Teacher != nil {
+		teacher.model = o.Teacher
+	}
+	demos, used := []*Example{}, map[int]bool{}
+	for i, example := range examples {
+		if len(demos) >= maxDemos {
+			break
+		}
+		prediction, err := teacher.predict(ctx, example.Inputs)
+		if err != nil {
+			log.WarnContextf(ctx, "optimizer bootstrap example %d error: %v", i, err)
+			continue
+		}
+		if o.Metric(ctx, example, prediction) >= threshold {
+			demos = append(demos, &Example{Inputs: example.Inputs, Outputs: prediction})
+			used[i] = true
+		}
+	}
+	return demos, used
+}
+
+var generatedPromptPattern = regexp.MustCompile(`(?s)<START>(.*?)<END>`)
+
+// propose generates the instruction variants with thinking styles as meta prompts
+func (o *Optimizer) propose(ctx context.Context, p *predictor, random *rand.Rand) ([]string, error) {
+	num := o.NumCandidates
+	if num <= 0 {
+		num = 5
+	}
+	styles := []string{}
+	for _, i := range random.Perm(len(templates.ThinkingStyles))[:min(num, len(templates.ThinkingStyles))] {
+		styles = append(styles, templates.ThinkingStyles[i])
+	}
+	description := p.Description
+	if description == "" {
+		description = p.Instruction
+	}
+	metaPrompt, err := prompt.Render(templates.MetaInstruction, map[string]any{
+		"task_description":   description,
+		"meta_prompts":       strings.Join(styles, "\n"),
+		"num_variations":     num,
+		"prompt_instruction": p.Instruction,
+	})
+	if err != nil {
+		return nil, err
+	}
+	model := o.Teacher
+	if model == nil {
+		model = p.model
+	}
+	response, err := model.Invoke(ctx, []llm.Message{llm.NewUserTextMessage(metaPrompt)}, llm.WithStream(true))
+	if err != nil {
+		return nil, err
+	}
+	variables := templateVariablePattern.FindAllString(p.Instruction, -1)
+	instructions := []string{}
+	for _, match := range generatedPromptPattern.FindAllStringSubmatch(response.Result().Message.Content(), num) {
+		instruction := strings.TrimSpace(match[1])
+		if instruction != "" && keepsVariables(instruction, variables) {
+			instructions = append(instructions, instruction)
+		}
+	}
+	return instructions, nil
+}
+
+var templateVariablePattern = regexp.MustCompile(`{{\s*[\w.]+\s*}}`)
+
+// keepsVariables whether the variant keeps the template variables of the instruction, e.g. inputs of RawAdapter
+func keepsVariables(instruction string, variables []string) bool {
+	kept := map[string]bool{}
+	for _, variable := range templateVariablePattern.FindAllString(instruction, -1) {
+		kept[strings.Join(strings.Fields(variable), "")] = true
+	}
+	for _, variable := range variables {
+		if !kept[strings.Join(strings.Fields(variable), "")] {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate the average metric of p on the examples
+func (o *Optimizer) Evaluate(ctx context.Context, p *predictor, examples []*Example) (float64, error) {
+	if err := plain(p); err != nil {
+		return 0, err
+	}
+	if len(examples) == 0 {
+		return 0, nil
+	}
+	concurrency := o.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	scores := make([]float64, len(examples))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for i, example := range examples {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			prediction, err := p.predict(ctx, example.Inputs)
+			if err != nil { // scored 0
+				log.WarnContextf(ctx, "optimizer evaluate example %d error: %v", i, err)
+				return
+			}
+			scores[i] = o.Metric(ctx, example, prediction)
+		}()
+	}
+	wg.Wait()
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+	return total / float64(len(examples)), nil
+}
+
+// plain rejects the predictors of other invokers, e.g. FunCall and PlanExecute, as predict evaluates a single completion
+func plain(p *predictor) error {
+	if p.invoker != nil && p.invoker != Invoker(p) {
+		return fmt.Errorf("optimizer supports plain predictors only, got %T", p.invoker)
+	}
+	return nil
+}
+
+// predict runs the model on inputs, the completion is parsed into outputs by output field names.
+// It runs on a copy of p, as Format of RawAdapter renders the instruction in place.
+func (p *predictor) predict(ctx context.Context, inputs map[string]any) (map[string]any, error) {
+	copied := *p
+	p = &copied
+	p.inputs = inputs
+	if adapter, ok := p.adapter.(*JSONAdapter); ok { // JSONAdapter keeps the target of Format
+		adapter := *adapter
+		p.adapter = &adapter
+	}
+	outputs := map[string]any{}
+	messages, err := p.adapter.Format(p, inputs, &outputs)
+	if err != nil {
+		return nil, err
+	}
+	completion, err := p.complete(ctx, messages, llm.WithStream(true))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.adapter.(*MarkableAdapter); ok {
+		for _, section := range markableSections(completion)[1:] {
+			if _, ok := p.OutputFields[section[0]]; ok {
+				outputs[section[0]] = strings.TrimSpace(section[1])
+			}
+		}
+		return outputs, nil
+	}
+	if err := json.Unmarshal([]byte(llm.ExtractJSON(completion)), &outputs); err == nil {
+		return outputs, nil
+	}
+	if len(p.OutputFields) != 1 { // a single output field may be answered as text
+		return nil, fmt.Errorf("optimizer parse prediction error: %s", completion)
+	}
+	for name := range p.OutputFields {
+		outputs[name] = strings.TrimSpace(completion)
+	}
+	return outputs, nil
+}
+
+// Load restores the prompt of a compiled predictor saved by json.Marshal, e.g. into a new predictor of the same program
+func (p *predictor) Load(data []byte) error {
+	promptx := Promptx{}
+	if err := json.Unmarshal(data, &promptx); err != nil {
+		return fmt.Errorf("predictor load error: %w", err)
+	}
+	if promptx.InputFields == nil {
+		promptx.InputFields = make(map[string]*Field)
+	}
+	if promptx.OutputFields == nil {
+		promptx.OutputFields = make(map[string]*Field)
+	}
+	p.Promptx = promptx
+	return nil
+}
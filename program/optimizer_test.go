@@ -0,0 +1,79 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+// funcProvider replies by the function of messages
+type funcProvider func(messages []llm.Message) string
+
+func (f funcProvider) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	response := llm.NewStreamResponse()
+	go func() {
+		defer response.Stream().Close()
+		response.Stream().Push(llm.NewChunk(0, llm.NewAssistantMessage(f(messages)), &llm.Usage{}))
+	}()
+	return response, nil
+}
+
+func TestOptimizer_Compile(t *testing.T) {
+	model := llm.NewInstance("scripted", llm.WithProvider(funcProvider(func(messages []llm.Message) string {
+		content, _, _ := strings.Cut(messages[0].Content(), "Examples:") // the instruction without demos
+		if strings.Contains(content, "[Meta Prompt]") {
+			return "<START>Drop the text<END>\n<START>Label the email as spam or ham carefully: {{ text }}<END>"
+		}
+		if !strings.Contains(content, "carefully") { // the original instruction always answers spam
+			return "spam"
+		}
+		if strings.Contains(content, "buy") || strings.Contains(content, "cheap") {
+			return "spam"
+		}
+		return "ham"
+	})))
+	p := NewPredictor(WithLLMInstance(model)).
+		WithInstruction("Classify the email: {{text}}").
+		WithOutputField("label", "spam or ham")
+	optimizer := &Optimizer{
+		TrainSet: []*Example{
+			{Inputs: map[string]any{"text": "buy now"}, Outputs: map[string]any{"label": "spam"}},
+			{Inputs: map[string]any{"text": "hello friend"}, Outputs: map[string]any{"label": "ham"}},
+			{Inputs: map[string]any{"text": "cheap pills"}, Outputs: map[string]any{"label": "spam"}},
+			{Inputs: map[string]any{"text": "meeting at 5"}, Outputs: map[string]any{"label": "ham"}},
+		},
+		Metric:      ExactMatch("label"),
+		MaxDemos:    1,
+		Concurrency: 1,
+	}
+	ctx := context.Background()
+	before, err := optimizer.Evaluate(ctx, p, optimizer.TrainSet)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, before)
+
+	compiled, err := optimizer.Compile(ctx, p)
+	assert.NoError(t, err)
+	assert.Contains(t, compiled.Instruction, "carefully")
+	assert.Len(t, compiled.Demos, 1)
+	assert.Equal(t, "spam", compiled.Demos[0].Outputs["label"])
+	after, err := optimizer.Evaluate(ctx, compiled, optimizer.TrainSet)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, after)
+
+	// a single completion can not evaluate the tool calls of FunCall
+	_, err = optimizer.Compile(ctx, FunCall(WithLLMInstance(model)))
+	assert.ErrorContains(t, err, "plain predictors only")
+
+	// save and reload
+	data, err := json.Marshal(compiled)
+	assert.NoError(t, err)
+	reloaded := NewPredictor(WithLLMInstance(model))
+	assert.NoError(t, reloaded.Load(data))
+	assert.Equal(t, compiled.Instruction, reloaded.Instruction)
+	assert.Equal(t, compiled.Demos, reloaded.Demos)
+	assert.Contains(t, reloaded.OutputFields, "label")
+}
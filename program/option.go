@@ -2,6 +2,7 @@ package program
 
 import (
 	"context"
+	"time"
 
 	"github.com/showntop/llmack/llm"
 )
@@ -33,6 +34,55 @@ func WithMaxIterationNum(num int) option {
 	}
 }
 
+// WithContextManager ...
+func WithContextManager(m *ContextManager) option {
+	return func(p *predictor) {
+		p.contextManager = m
+	}
+}
+
+// WithApproval ...
+func WithApproval(policy *ApprovalPolicy) option {
+	return func(p *predictor) {
+		p.approval = policy
+	}
+}
+
+// WithToolTimeout ...
+func WithToolTimeout(timeout time.Duration) option {
+	return func(p *predictor) {
+		p.toolTimeout = timeout
+	}
+}
+
+// WithToolConcurrency ...
+func WithToolConcurrency(n int) option {
+	return func(p *predictor) {
+		p.toolConcurrency = n
+	}
+}
+
+// WithCritic ...
+func WithCritic(critic *llm.Instance) option {
+	return func(p *predictor) {
+		p.critic = critic
+	}
+}
+
+// WithCriteria ...
+func WithCriteria(criteria ...string) option {
+	return func(p *predictor) {
+		p.criteria = append(p.criteria, criteria...)
+	}
+}
+
+// WithSampling ...
+func WithSampling(sampling *Sampling) option {
+	return func(p *predictor) {
+		p.sampling = sampling
+	}
+}
+
 func WithResetMessages(resetMessages func(ctx context.Context, messages []llm.Message) []llm.Message) option {
 	return func(p *predictor) {
 		p.resetMessages = resetMessages
@@ -0,0 +1,423 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/log"
+	"github.com/showntop/llmack/tool"
+)
+
+// MaxPlanSteps steps executed at most by PlanExecute unless WithMaxIterationNum
+var MaxPlanSteps = 20
+
+// PlanStepStatus ...
+type PlanStepStatus string
+
+const (
+	PlanStepPending PlanStepStatus = "pending"
+	PlanStepRunning PlanStepStatus = "running"
+	PlanStepDone    PlanStepStatus = "done"
+	PlanStepFailed  PlanStepStatus = "failed"
+)
+
+// PlanStep 计划步骤
+type PlanStep struct {
+	Task     string         `json:"task"`
+	Expected string         `json:"expected,omitempty"` // expected output of the step
+	Status   PlanStepStatus `json:"status"`
+	Result   string         `json:"result,omitempty"`
+}
+
+// Plan 计划，执行中随流推送，见 PlanFromEvent
+type Plan struct {
+	Task     string      `json:"task"`
+	Steps    []*PlanStep `json:"steps"`
+	Revision int         `json:"revision"` // times of re-planning
+}
+
+// plannedStep the step generated by the model
+type plannedStep struct {
+	Task     string `json:"task" jsonschema:"description=a self-contained instruction of the step"`
+	Expected string `json:"expected" jsonschema:"description=the expected output of the step"`
+}
+
+type planOutput struct {
+	Steps []plannedStep `json:"steps" jsonschema:"description=the steps to complete the task in order"`
+}
+
+type replanOutput struct {
+	Finished bool          `json:"finished" jsonschema:"description=whether the task is completed by the executed steps"`
+	Answer   string        `json:"answer" jsonschema:"description=the final answer to the task if finished"`
+	Replan   bool          `json:"replan" jsonschema:"description=whether the remaining steps should be replaced"`
+	Steps    []plannedStep `json:"steps" jsonschema:"description=the new remaining steps if replan"`
+}
+
+var plannerPrompt = `You are a planner. Devise a step by step plan to complete the task below.
+Each step is executed in order by an assistant with the tools:
+%s
+Keep the plan short, every step must be self-contained and necessary. Do not add a final step to answer the task.`
+
+var replannerPrompt = `You are a planner reviewing the progress of a plan for the task below.
+Based on the results of the executed steps, decide:
+- finished: the task is completed, give the final answer to the task.
+- replan: a step failed or returned unexpected output, replace the remaining steps with new ones.
+- otherwise continue with the remaining steps as planned.`
+
+var executorPrompt = `You are executing one step of a plan for the task:
+<task>
+%s
+</task>
+Results of the previous steps:
+<previous_steps>
+%s
+</previous_steps>
+Complete only the current step given by the user and reply with its result.`
+
+// PlanExecute plan-and-execute program: the model plans the steps of the task in structured output,
+// each step is executed by FunCall with the tools, the plan is revised when a step fails or surprises.
+func PlanExecute(opts ...option) *predictor {
+	p := NewPredictor(opts...)
+	p.Mode = "plan_execute"
+	p.invoker = &planExecute{p}
+	return p
+}
+
+type planExecute struct {
+	*predictor
+}
+
+func (pe *planExecute) InvokeOnce(ctx context.Context, messages []llm.Message) *predictor {
+	panic("not implemented")
+}
+
+func (pe *planExecute) Invoke(ctx context.Context, messages []llm.Message, query string, inputs map[string]any) *predictor {
+	defer close(pe.reponse.stream)
+	// the last user message is the task, the messages before are context
+	if query == "" && len(messages) > 0 && messages[len(messages)-1].Role() == llm.MessageRoleUser {
+		query = messages[len(messages)-1].Content()
+		messages = messages[:len(messages)-1]
+	}
+	systemMessages, err := pe.adapter.Format(pe.predictor, inputs, nil)
+	if err != nil {
+		pe.reponse.err = err
+		return pe.predictor
+	}
+	head := append(systemMessages, messages...) // instruction and history, shared by planner and executor
+
+	plan := &Plan{Task: query}
+	steps, err := pe.plan(ctx, head, query)
+	if err != nil {
+		pe.reponse.err = err
+		return pe.predictor
+	}
+	plan.Steps = steps
+	pe.emitPlan(plan)
+	pe.run(ctx, head, plan)
+	return pe.predictor
+}
+
+// resumeCheckpoint continues the step paused for approval, then the rest of the plan
+func (pe *planExecute) resumeCheckpoint(ctx context.Context, cp *Checkpoint, decisions map[string]*ApprovalDecision) *predictor {
+	defer close(pe.reponse.stream)
+	plan := &Plan{}
+	if err := json.Unmarshal(cp.Plan, plan); err != nil {
+		pe.reponse.err = fmt.Errorf("program plan resume error: invalid plan of checkpoint: %w", err)
+		return pe.predictor
+	}
+	step := plan.running()
+	if step == nil || len(cp.Messages) == 0 {
+		pe.reponse.err = errors.New("program plan resume error: no paused step in checkpoint")
+		return pe.predictor
+	}
+	// the messages of the executor are the head and the task of step
+	head := llm.RestoreMessages(cp.Messages[:len(cp.Messages)-1])
+	executorCheckpoint := *cp
+	executorCheckpoint.Plan = nil
+	executor := pe.executor(plan).Resume(ctx, &executorCheckpoint, decisions)
+	result, err := pe.wait(executor, plan)
+	if pe.review(ctx, head, plan, step, result, err) {
+		pe.run(ctx, head, plan)
+	}
+	return pe.predictor
+}
+
+// run executes the pending steps of plan, the plan is reviewed after each step
+func (pe *planExecute) run(ctx context.Context, head []llm.Message, plan *Plan) {
+	maxSteps := MaxPlanSteps
+	if pe.maxIterationNum > 0 {
+		maxSteps = pe.maxIterationNum
+	}
+	for executed := plan.executed(); executed < maxSteps; executed++ {
+		step := plan.next()
+		if step == nil {
+			break
+		}
+		step.Status = PlanStepRunning
+		pe.emitPlan(plan)
+		result, err := pe.execute(ctx, head, plan, step)
+		if !pe.review(ctx, head, plan, step, result, err) {
+			return
+		}
+	}
+	if plan.next() != nil {
+		log.WarnContextf(ctx, "program plan execute stopped after %d steps", maxSteps)
+	}
+	// steps run out without the final answer
+	if err := pe.synthesize(ctx, head, plan); err != nil {
+		pe.reponse.err = err
+	}
+}
+
+// review records the result of step and asks the replanner, returns false if the run ends
+func (pe *planExecute) review(ctx context.Context, head []llm.Message, plan *Plan, step *PlanStep, result string, err error) bool {
+	if errors.Is(err, ErrApprovalRequired) { // paused with the plan in checkpoint, the step is still running
+		pe.emitPlan(plan)
+		pe.reponse.err = err
+		return false
+	}
+	if errors.Is(err, llm.ErrBudgetExceeded) {
+		step.Status, step.Result = PlanStepFailed, err.Error()
+		pe.emitPlan(plan)
+		pe.reponse.err = err
+		return false
+	}
+	if err != nil {
+		log.WarnContextf(ctx, "program plan execute step %q error: %v", step.Task, err)
+		step.Status, step.Result = PlanStepFailed, err.Error()
+	} else {
+		step.Status, step.Result = PlanStepDone, result
+	}
+
+	review, err := pe.replan(ctx, head, plan)
+	if err != nil {
+		pe.reponse.err = err
+		return false
+	}
+	if review.Finished && review.Answer != "" {
+		pe.emitPlan(plan)
+		pe.answer(review.Answer)
+		return false
+	}
+	if review.Replan || len(review.Steps) > 0 { // otherwise the remaining steps are kept
+		plan.revise(review.Steps)
+	}
+	pe.emitPlan(plan)
+	return true
+}
+
+// plan asks the model for the steps of task
+func (pe *planExecute) plan(ctx context.Context, head []llm.Message, task string) ([]*PlanStep, error) {
+	messages := append(append([]llm.Message{}, head...),
+		llm.NewSystemMessage(fmt.Sprintf(plannerPrompt, pe.describeTools())),
+		llm.NewUserTextMessage(task))
+	var output planOutput
+	if err := pe.decide(ctx, messages, &output); err != nil {
+		return nil, fmt.Errorf("program plan error: %w", err)
+	}
+	if len(output.Steps) == 0 {
+		return nil, errors.New("program plan error: no steps planned")
+	}
+	return newPlanSteps(output.Steps), nil
+}
+
+// replan reviews the executed steps
+func (pe *planExecute) replan(ctx context.Context, head []llm.Message, plan *Plan) (*replanOutput, error) {
+	raw, _ := json.Marshal(plan)
+	messages := append(append([]llm.Message{}, head...),
+		llm.NewSystemMessage(replannerPrompt+"\nThe tools are:\n"+pe.describeTools()),
+		llm.NewUserTextMessage("<task>\n"+plan.Task+"\n</task>\n<plan>\n"+string(raw)+"\n</plan>"))
+	output := &replanOutput{}
+	if err := pe.decide(ctx, messages, output); err != nil {
+		return nil, fmt.Errorf("program replan error: %w", err)
+	}
+	return output, nil
+}
+
+// decide invokes the model for structured output into value
+func (pe *planExecute) decide(ctx context.Context, messages []llm.Message, value any) error {
+	response, err := pe.model.Invoke(ctx, messages, llm.WithJSONSchema(value))
+	if err != nil {
+		return err
+	}
+	result := response.Result()
+	pe.addUsage(result.Usage)
+	return json.Unmarshal([]byte(llm.ExtractJSON(result.Message.Content())), value)
+}
+
+// execute runs the step with FunCall, the chunks are forwarded if streaming
+func (pe *planExecute) execute(ctx context.Context, head []llm.Message, plan *Plan, step *PlanStep) (string, error) {
+	task := step.Task
+	if step.Expected != "" {
+		task += "\nExpected output: " + step.Expected
+	}
+	executor := pe.executor(plan).InvokeWithMessages(ctx, append(append([]llm.Message{}, head...), llm.NewUserTextMessage(task)))
+	return pe.wait(executor, plan)
+}
+
+// executor the FunCall executing the current step with the results of the previous steps
+func (pe *planExecute) executor(plan *Plan) *predictor {
+	previous := strings.Builder{}
+	for i, s := range plan.Steps {
+		if s.Status == PlanStepDone || s.Status == PlanStepFailed {
+			previous.WriteString(fmt.Sprintf("%d. [%s] %s\n%s\n", i+1, s.Status, s.Task, s.Result))
+		}
+	}
+	executor := FunCall(WithLLMInstance(pe.model)).
+		WithInstruction(fmt.Sprintf(executorPrompt, plan.Task, previous.String())).
+		WithTools(pe.tools...).
+		WithStream(pe.stream).
+		WithApproval(pe.approval).
+		WithContextManager(pe.contextManager).
+		WithToolTimeout(pe.toolTimeout).
+		WithToolConcurrency(pe.toolConcurrency)
+	executor.maxIterationNum = pe.maxIterationNum // MaxIterationNum if unset
+	return executor
+}
+
+// wait forwards the chunks of executor and returns its answer, the checkpoint of an executor
+// paused for approval is kept with the plan to be resumed by Resume
+func (pe *planExecute) wait(executor *predictor, plan *Plan) (string, error) {
+	if pe.stream {
+		for chunk := range executor.Stream() {
+			pe.reponse.stream <- chunk
+		}
+	}
+	pe.addUsage(executor.Usage)
+	err := executor.Error()
+	if errors.Is(err, ErrApprovalRequired) {
+		checkpoint := *executor.Checkpoint()
+		checkpoint.Plan, _ = json.Marshal(plan)
+		pe.reponse.checkpoint = &checkpoint
+	}
+	if err != nil {
+		return "", err
+	}
+	return executor.Completion(), nil
+}
+
+// synthesize answers the task with the results of the steps
+func (pe *planExecute) synthesize(ctx context.Context, head []llm.Message, plan *Plan) error {
+	raw, _ := json.Marshal(plan)
+	messages := append(append([]llm.Message{}, head...),
+		llm.NewUserTextMessage("<task>\n"+plan.Task+"\n</task>\n<plan>\n"+string(raw)+"\n</plan>\n"+
+			"Answer the task with the results of the executed steps above."))
+	response, err := pe.model.Invoke(ctx, messages, llm.WithStream(true))
+	if err != nil {
+		return err
+	}
+	answer := ""
+	for chunk := range response.Stream().Next() {
+		if chunk.Usage != nil {
+			pe.addUsage(*chunk.Usage)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta != nil {
+			answer += chunk.Choices[0].Delta.Content()
+		}
+		if pe.stream {
+			pe.reponse.stream <- chunk
+		}
+	}
+	pe.reponse.message = llm.NewAssistantMessage(answer)
+	return nil
+}
+
+// answer the final answer given by the replanner
+func (pe *planExecute) answer(answer string) {
+	pe.reponse.message = llm.NewAssistantMessage(answer)
+	if pe.stream {
+		pe.reponse.stream <- llm.NewChunk(0, llm.NewAssistantMessage(answer), nil)
+	}
+}
+
+// emitPlan pushes the plan in Chunk.Plan with llm.FinishReasonPlan, the delta is empty
+func (pe *planExecute) emitPlan(plan *Plan) {
+	if !pe.stream {
+		return
+	}
+	raw, _ := json.Marshal(plan)
+	chunk := llm.NewChunk(0, llm.NewAssistantMessage(""), nil)
+	chunk.Choices[0].FinishReason = llm.FinishReasonPlan
+	chunk.Plan = raw
+	pe.reponse.stream <- chunk
+}
+
+func (pe *planExecute) describeTools() string {
+	if len(pe.tools) == 0 {
+		return "(no tools)"
+	}
+	builder := strings.Builder{}
+	for _, name := range pe.tools {
+		if t, ok := tool.Lookup(fmt.Sprint(name)); ok {
+			builder.WriteString("- " + t.Name + ": " + t.Description + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// running the step paused for approval
+func (plan *Plan) running() *PlanStep {
+	for _, step := range plan.Steps {
+		if step.Status == PlanStepRunning {
+			return step
+		}
+	}
+	return nil
+}
+
+// executed the number of finished steps
+func (plan *Plan) executed() int {
+	executed := 0
+	for _, step := range plan.Steps {
+		if step.Status == PlanStepDone || step.Status == PlanStepFailed {
+			executed++
+		}
+	}
+	return executed
+}
+
+// next the first pending step
+func (plan *Plan) next() *PlanStep {
+	for _, step := range plan.Steps {
+		if step.Status == PlanStepPending {
+			return step
+		}
+	}
+	return nil
+}
+
+// revise replaces the pending steps
+func (plan *Plan) revise(steps []plannedStep) {
+	kept := []*PlanStep{}
+	for _, step := range plan.Steps {
+		if step.Status != PlanStepPending {
+			kept = append(kept, step)
+		}
+	}
+	plan.Steps = append(kept, newPlanSteps(steps)...)
+	plan.Revision++
+}
+
+func newPlanSteps(planned []plannedStep) []*PlanStep {
+	steps := make([]*PlanStep, 0, len(planned))
+	for _, s := range planned {
+		steps = append(steps, &PlanStep{Task: s.Task, Expected: s.Expected, Status: PlanStepPending})
+	}
+	return steps
+}
+
+// PlanFromEvent decodes the live plan of a llm.StreamEventPlan event
+func PlanFromEvent(event *llm.StreamEvent) (*Plan, bool) {
+	if event == nil || event.Type != llm.StreamEventPlan {
+		return nil, false
+	}
+	plan := &Plan{}
+	if err := json.Unmarshal(event.Plan, plan); err != nil {
+		return nil, false
+	}
+	return plan, true
+}
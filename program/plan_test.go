@@ -0,0 +1,145 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/tool"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedProvider replies in order, a reply prefixed with "error: " fails the request
+type scriptedProvider struct {
+	replies  []string
+	requests [][]llm.Message
+}
+
+func (s *scriptedProvider) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	reply := s.replies[len(s.requests)]
+	s.requests = append(s.requests, messages)
+	if message, ok := strings.CutPrefix(reply, "error: "); ok {
+		return nil, errors.New(message)
+	}
+	response := llm.NewStreamResponse()
+	go func() {
+		defer response.Stream().Close()
+		response.Stream().Push(llm.NewChunk(0, llm.NewAssistantMessage(reply), &llm.Usage{TotalTokens: 10}))
+	}()
+	return response, nil
+}
+
+func TestPlanExecute(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{
+		`{"steps":[{"task":"step one","expected":"one"},{"task":"step two","expected":"two"}]}`,
+		"one failed unexpectedly",
+		`{"finished":false,"answer":"","replan":true,"steps":[{"task":"step three","expected":"three"}]}`,
+		"three done",
+		`{"finished":true,"answer":"all done","replan":false,"steps":[]}`,
+	}}
+	model := llm.NewInstance("scripted", llm.WithProvider(provider))
+	p := PlanExecute(WithLLMInstance(model)).WithStream(true).InvokeQuery(context.Background(), "do the task")
+
+	var plan *Plan
+	decoder := llm.NewStreamDecoder()
+	for chunk := range p.Stream() {
+		if chunk.Choices[0].FinishReason == llm.FinishReasonPlan { // the plan is not part of the content
+			assert.Empty(t, chunk.Choices[0].Delta.Content())
+		}
+		for _, event := range decoder.Decode(chunk) {
+			if current, ok := PlanFromEvent(event); ok {
+				plan = current
+			}
+		}
+	}
+	assert.NoError(t, p.Error())
+	assert.Equal(t, "all done", p.Completion())
+	assert.Len(t, provider.requests, 5)
+	assert.Equal(t, 1, plan.Revision)
+	assert.Len(t, plan.Steps, 2)
+	assert.Equal(t, "step one", plan.Steps[0].Task)
+	assert.Equal(t, "step three", plan.Steps[1].Task)
+	assert.Equal(t, PlanStepDone, plan.Steps[1].Status)
+	assert.Equal(t, "three done", plan.Steps[1].Result)
+	assert.Equal(t, 50, p.Usage.TotalTokens)
+	// the executor of step three sees the result of step one
+	executor := provider.requests[3]
+	assert.Contains(t, executor[0].Content(), "one failed unexpectedly")
+	assert.Equal(t, "step three\nExpected output: three", executor[len(executor)-1].Content())
+}
+
+func TestPlanExecute_KeepSteps(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{
+		`{"steps":[{"task":"step one","expected":"one"},{"task":"step two","expected":"two"}]}`,
+		"error: step one failed",
+		`{"finished":false,"answer":"","replan":false,"steps":[]}`,
+		"two done",
+		`{"finished":true,"answer":"all done","replan":false,"steps":[]}`,
+	}}
+	model := llm.NewInstance("scripted", llm.WithProvider(provider))
+	p := PlanExecute(WithLLMInstance(model)).InvokeQuery(context.Background(), "do the task")
+
+	assert.NoError(t, p.Error())
+	assert.Equal(t, "all done", p.Completion())
+	assert.Len(t, provider.requests, 5)
+	// the failed step is not replanned, step two is executed as planned
+	executor := provider.requests[3]
+	assert.Equal(t, "step two\nExpected output: two", executor[len(executor)-1].Content())
+}
+
+// messageProvider replies the messages in order
+type messageProvider struct {
+	replies  []*llm.AssistantMessage
+	requests int
+}
+
+func (s *messageProvider) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	reply := s.replies[s.requests]
+	s.requests++
+	response := llm.NewStreamResponse()
+	go func() {
+		defer response.Stream().Close()
+		response.Stream().Push(llm.NewChunk(0, reply, &llm.Usage{TotalTokens: 10}))
+	}()
+	return response, nil
+}
+
+func TestPlanExecute_ResumeApproval(t *testing.T) {
+	invoked := 0
+	tool.Register(tool.New(
+		tool.WithName("plan_note"),
+		tool.WithRequireApproval(true),
+		tool.WithFunction(func(ctx context.Context, args string) (string, error) {
+			invoked++
+			return "saved", nil
+		}),
+	))
+	call := &llm.ToolCall{ID: "call_1", Type: "function", Function: llm.ToolCallFunction{Name: "plan_note", Arguments: `{}`}}
+	provider := &messageProvider{replies: []*llm.AssistantMessage{
+		llm.NewAssistantMessage(`{"steps":[{"task":"take a note","expected":"saved"}]}`),
+		llm.NewAssistantMessage("").WithToolCalls([]*llm.ToolCall{call}),
+		llm.NewAssistantMessage("note saved"),
+		llm.NewAssistantMessage(`{"finished":true,"answer":"all done","replan":false,"steps":[]}`),
+	}}
+	model := llm.NewInstance("scripted", llm.WithProvider(provider))
+	ctx := context.Background()
+
+	p := PlanExecute(WithLLMInstance(model), WithApproval(RequireApproval())).WithTools("plan_note").InvokeQuery(ctx, "do the task")
+	assert.ErrorIs(t, p.Error(), ErrApprovalRequired)
+	assert.Equal(t, 0, invoked)
+	assert.NotEmpty(t, p.Checkpoint().Plan)
+
+	raw, err := json.Marshal(p.Checkpoint())
+	assert.NoError(t, err)
+	checkpoint := &Checkpoint{}
+	assert.NoError(t, json.Unmarshal(raw, checkpoint))
+	resumed := PlanExecute(WithLLMInstance(model), WithApproval(RequireApproval())).WithTools("plan_note").
+		Resume(ctx, checkpoint, map[string]*ApprovalDecision{"call_1": Approve()})
+	assert.NoError(t, resumed.Error())
+	assert.Equal(t, "all done", resumed.Completion())
+	assert.Equal(t, 1, invoked)
+	assert.Equal(t, 4, provider.requests)
+}
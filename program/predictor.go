@@ -3,6 +3,7 @@ package program
 import (
 	"context"
 	"reflect"
+	"time"
 
 	"github.com/showntop/llmack/llm"
 )
@@ -12,6 +13,7 @@ type predictor struct {
 	Usage           llm.Usage
 	Mode            string
 	stream          bool
+	promptCache     bool
 	toolChoice      any
 	model           *llm.Instance
 	maxIterationNum int
@@ -21,9 +23,26 @@ type predictor struct {
 	tools           []any
 	Promptx
 
-	resetMessages func(ctx context.Context, messages []llm.Message) []llm.Message
-	invoker       Invoker
-	reponse       *Response
+	resetMessages  func(ctx context.Context, messages []llm.Message) []llm.Message
+	contextManager *ContextManager
+	approval       *ApprovalPolicy
+
+	toolTimeout     time.Duration // default timeout of each tool call
+	toolConcurrency int           // max concurrent tool calls, unlimited if 0
+	critic          *llm.Instance // reviewer model of Reflexion
+	criteria        []string      // success criteria of Reflexion besides the output fields
+	sampling        *Sampling     // samples of Result
+	invoker         Invoker
+	reponse         *Response
+}
+
+// addUsage accumulates the usage of an llm call of the predictor, not safe for concurrent calls
+func (p *predictor) addUsage(usage llm.Usage) {
+	p.Usage.PromptTokens += usage.PromptTokens
+	p.Usage.CompletionTokens += usage.CompletionTokens
+	p.Usage.TotalTokens += usage.TotalTokens
+	p.Usage.CacheReadTokens += usage.CacheReadTokens
+	p.Usage.CacheWriteTokens += usage.CacheWriteTokens
 }
 
 // Invoker 定义了 predictor 的调用方式
@@ -126,6 +145,54 @@ func (p *predictor) WithStream(stream bool) *predictor {
 	return p
 }
 
+// WithPromptCache marks the system prompt as a cache breakpoint, ignored by providers without prompt caching
+func (p *predictor) WithPromptCache(enable bool) *predictor {
+	p.promptCache = enable
+	return p
+}
+
+// WithContextManager compacts the tool calls and results of funcall near the context window
+func (p *predictor) WithContextManager(m *ContextManager) *predictor {
+	p.contextManager = m
+	return p
+}
+
+// WithApproval requires approval of the tool calls of funcall by policy
+func (p *predictor) WithApproval(policy *ApprovalPolicy) *predictor {
+	p.approval = policy
+	return p
+}
+
+// WithToolTimeout sets the default timeout of each tool call, overridden by tool.WithTimeout
+func (p *predictor) WithToolTimeout(timeout time.Duration) *predictor {
+	p.toolTimeout = timeout
+	return p
+}
+
+// WithToolConcurrency limits the concurrent tool calls of one step
+func (p *predictor) WithToolConcurrency(n int) *predictor {
+	p.toolConcurrency = n
+	return p
+}
+
+// WithCritic sets the reviewer model of Reflexion, e.g. a cheaper one
+func (p *predictor) WithCritic(critic *llm.Instance) *predictor {
+	p.critic = critic
+	return p
+}
+
+// WithCriteria adds the success criteria reviewed by the critic of Reflexion
+func (p *predictor) WithCriteria(criteria ...string) *predictor {
+	p.criteria = append(p.criteria, criteria...)
+	return p
+}
+
+// WithSampling draws the samples of Result and selects one, e.g. by majority vote
+func (p *predictor) WithSampling(sampling *Sampling) *predictor {
+	p.sampling = sampling
+	return p
+}
+
 func (p *predictor) WithToolChoice(toolChoice any) *predictor {
 	p.toolChoice = toolChoice
 	return p
@@ -22,6 +22,7 @@ type Promptx struct {
 	Instruction  string
 	InputFields  map[string]*Field
 	OutputFields map[string]*Field
+	Demos        []*Example // few-shot demonstrations, e.g. bootstrapped by Optimizer
 }
 
 // ValidateInputs checks if the provided inputs match the signature
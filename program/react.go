@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/showntop/flatmap"
+	"github.com/showntop/llmack/hooks"
 	"github.com/showntop/llmack/llm"
 	"github.com/showntop/llmack/log"
 	"github.com/showntop/llmack/prompt"
@@ -142,11 +143,12 @@ func (rp *react) Invoke(ctx context.Context, messages []llm.Message, query strin
 				})
 				break
 			} else {
-				// TODO check function name valid?
-				toolResult, err := tool.Spawn(result.Tool.Name).Invoke(ctx, result.Tool.Args)
+				toolCtx, span := hooks.StartToolSpan(ctx, result.Tool.Name, "")
+				toolResult, err := tool.Call(toolCtx, result.Tool.Name, result.Tool.Args, rp.toolTimeout)
+				hooks.EndSpan(span, err)
 				log.InfoContextf(ctx, "react agent invoke tool: %s, %v response: %s error: %v \n", result.Tool.Name, result.Tool.Args, toolResult, err)
-				if err != nil {
-					continue
+				if err != nil { // fed back to self-correct
+					toolResult = tool.AsError(result.Tool.Name, err).Result()
 				}
 				thoughts = append(thoughts, map[string]any{
 					"thought":     result.Thoughts,
@@ -172,7 +174,9 @@ func (rp *react) Invoke(ctx context.Context, messages []llm.Message, query strin
 	var answer string
 	for chunk := stream.Take(); chunk != nil; chunk = stream.Take() {
 		value.stream <- chunk
-		answer += chunk.Choices[0].Delta.Content()
+		if len(chunk.Choices) > 0 {
+			answer += chunk.Choices[0].Delta.Content()
+		}
 	}
 	value.completion = answer
 	close(value.stream)
@@ -0,0 +1,167 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/showntop/llmack/llm"
+)
+
+// MaxReflexionRounds revisions at most by Reflexion unless WithMaxIterationNum
+var MaxReflexionRounds = 3
+
+// Critique 评审意见
+type Critique struct {
+	Round    int    `json:"round"`
+	Answer   string `json:"answer"` // the critiqued answer
+	Approved bool   `json:"approved"`
+	Feedback string `json:"feedback"`
+}
+
+type critiqueOutput struct {
+	Approved bool   `json:"approved" jsonschema:"description=whether the answer meets all the requirements"`
+	Feedback string `json:"feedback" jsonschema:"description=the problems of the answer and how to fix them, empty if approved"`
+}
+
+var criticPrompt = `You are a strict reviewer. Review the answer to the task below against the requirements.
+Approve the answer only if it meets all the requirements, otherwise give concrete feedback to revise it.
+Requirements:
+%s`
+
+var revisePrompt = `A reviewer gave the following feedback on your answer:
+<feedback>
+%s
+</feedback>
+Revise your answer to address the feedback. Respond with the complete revised answer in the same output format.`
+
+// Reflexion self-critique program: generates the answer with the model of predictor, critiques it against the
+// output fields and criteria with the critic model (see WithCritic), then revises until the critic approves.
+// Critiques are kept in the response, see Critiques.
+func Reflexion(opts ...option) *predictor {
+	p := NewPredictor(opts...)
+	p.Mode = "reflexion"
+	p.invoker = &reflexion{p}
+	if p.critic == nil {
+		p.critic = p.model
+	}
+	return p
+}
+
+type reflexion struct {
+	*predictor
+}
+
+func (r *reflexion) InvokeOnce(ctx context.Context, messages []llm.Message) *predictor {
+	panic("not implemented")
+}
+
+func (r *reflexion) Invoke(ctx context.Context, messages []llm.Message, query string, inputs map[string]any) *predictor {
+	defer close(r.reponse.stream)
+	systemMessages, err := r.adapter.Format(r.predictor, inputs, nil)
+	if err != nil {
+		r.reponse.err = err
+		return r.predictor
+	}
+	messages = append(systemMessages, messages...)
+	if len(query) > 0 {
+		messages = append(messages, llm.NewUserTextMessage(query))
+	}
+	completion, err := r.complete(ctx, messages)
+	if err != nil {
+		r.reponse.err = err
+		return r.predictor
+	}
+	r.reponse.message = llm.NewAssistantMessage(completion)
+	if r.stream { // only the final answer is streamed
+		r.reponse.stream <- llm.NewChunk(0, llm.NewAssistantMessage(completion), &llm.Usage{})
+	}
+	return r.predictor
+}
+
+// complete generates, critiques and revises the answer, used by Invoke and Result
+func (r *reflexion) complete(ctx context.Context, messages []llm.Message, opts ...llm.InvokeOption) (string, error) {
+	rounds := MaxReflexionRounds
+	if r.maxIterationNum > 0 {
+		rounds = r.maxIterationNum
+	}
+	conversation := append([]llm.Message{}, messages...)
+	for round := 0; ; round++ {
+		answer, err := r.generate(ctx, conversation, opts...)
+		if err != nil {
+			return "", err
+		}
+		if round >= rounds { // the last revision is not critiqued
+			return answer, nil
+		}
+		critique, err := r.critique(ctx, messages, answer)
+		if err != nil {
+			return "", err
+		}
+		critique.Round = round
+		r.reponse.critiques = append(r.reponse.critiques, critique)
+		if critique.Approved {
+			return answer, nil
+		}
+		conversation = append(conversation,
+			llm.NewAssistantMessage(answer),
+			llm.NewUserTextMessage(fmt.Sprintf(revisePrompt, critique.Feedback)))
+	}
+}
+
+func (r *reflexion) generate(ctx context.Context, messages []llm.Message, opts ...llm.InvokeOption) (string, error) {
+	response, err := r.model.Invoke(ctx, messages, append([]llm.InvokeOption{llm.WithStream(true)}, opts...)...)
+	if err != nil {
+		return "", err
+	}
+	result := response.Result()
+	r.addUsage(result.Usage)
+	return result.Message.Content(), nil
+}
+
+// critique reviews answer to the task of messages with the critic model
+func (r *reflexion) critique(ctx context.Context, messages []llm.Message, answer string) (*Critique, error) {
+	task := strings.Builder{}
+	for _, message := range messages {
+		task.WriteString(fmt.Sprintf("[%s]\n%s\n", message.Role(), message.Content()))
+	}
+	reviewMessages := []llm.Message{
+		llm.NewSystemMessage(fmt.Sprintf(criticPrompt, r.requirements())),
+		llm.NewUserTextMessage("<task>\n" + task.String() + "</task>\n<answer>\n" + answer + "\n</answer>"),
+	}
+	output := &critiqueOutput{}
+	response, err := r.critic.Invoke(ctx, reviewMessages, llm.WithJSONSchema(output))
+	if err != nil {
+		return nil, fmt.Errorf("program reflexion critique error: %w", err)
+	}
+	result := response.Result()
+	r.addUsage(result.Usage)
+	if err := json.Unmarshal([]byte(llm.ExtractJSON(result.Message.Content())), output); err != nil {
+		return nil, fmt.Errorf("program reflexion critique unmarshal error: %w", err)
+	}
+	return &Critique{Answer: answer, Approved: output.Approved, Feedback: output.Feedback}, nil
+}
+
+// requirements the criteria and output fields of predictor
+func (r *reflexion) requirements() string {
+	builder := strings.Builder{}
+	for _, criterion := range r.criteria {
+		builder.WriteString("- " + criterion + "\n")
+	}
+	for _, out := range r.OutputFields {
+		builder.WriteString("- the output field '" + out.Name + "': " + out.Description + "\n")
+	}
+	if builder.Len() == 0 {
+		builder.WriteString("- the answer completes the task correctly\n")
+	}
+	return builder.String()
+}
+
+// Critiques the critiques of Reflexion in order
+func (p *predictor) Critiques() []*Critique {
+	if p.reponse == nil {
+		return nil
+	}
+	return p.reponse.critiques
+}
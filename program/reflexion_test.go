@@ -0,0 +1,49 @@
+package program
+
+import (
+	"context"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+type reflexionTitle struct {
+	Title string `json:"title"`
+}
+
+func TestReflexion_Result(t *testing.T) {
+	generator := &scriptedProvider{replies: []string{`{"title":"draft"}`, `{"title":"final"}`}}
+	critic := &scriptedProvider{replies: []string{
+		`{"approved":false,"feedback":"too short"}`,
+		`{"approved":true,"feedback":""}`,
+	}}
+	p := Reflexion(
+		WithLLMInstance(llm.NewInstance("scripted", llm.WithProvider(generator))),
+		WithCritic(llm.NewInstance("scripted", llm.WithProvider(critic))),
+	).WithInstruction("write a title").WithCriteria("at least two words")
+
+	value := reflexionTitle{}
+	assert.NoError(t, p.Result(context.Background(), &value))
+	assert.Equal(t, "final", value.Title)
+	assert.Len(t, p.Critiques(), 2)
+	assert.False(t, p.Critiques()[0].Approved)
+	assert.Equal(t, `{"title":"draft"}`, p.Critiques()[0].Answer)
+	assert.True(t, p.Critiques()[1].Approved)
+	assert.Contains(t, critic.requests[0][0].Content(), "at least two words")
+	revision := generator.requests[1]
+	assert.Contains(t, revision[len(revision)-2].Content(), "too short") // followed by the json schema instruction
+}
+
+func TestReflexion_MaxRounds(t *testing.T) {
+	generator := &scriptedProvider{replies: []string{"a", "b"}}
+	critic := &scriptedProvider{replies: []string{`{"approved":false,"feedback":"wrong"}`}}
+	p := Reflexion(
+		WithLLMInstance(llm.NewInstance("scripted", llm.WithProvider(generator))),
+		WithCritic(llm.NewInstance("scripted", llm.WithProvider(critic))),
+		WithMaxIterationNum(1),
+	).InvokeQuery(context.Background(), "answer")
+	assert.NoError(t, p.Error())
+	assert.Equal(t, "b", p.Completion())
+	assert.Len(t, p.Critiques(), 1)
+}
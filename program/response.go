@@ -2,6 +2,7 @@ package program
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -33,6 +34,15 @@ func (p *predictor) ToolCalls() []*llm.ToolCall {
 	return p.reponse.toolCalls
 }
 
+// Messages returns the assistant and tool messages generated by the invoke, e.g. to append to session history
+func (p *predictor) Messages() []llm.Message {
+	messages := append([]llm.Message{}, p.observers...)
+	if p.reponse != nil && p.reponse.message != nil {
+		messages = append(messages, p.reponse.message)
+	}
+	return messages
+}
+
 type Response struct {
 	p          *predictor
 	err        error
@@ -40,7 +50,10 @@ type Response struct {
 	toolCalls  []*llm.ToolCall
 	stream     chan *llm.Chunk
 
-	message *llm.AssistantMessage
+	message    *llm.AssistantMessage
+	checkpoint *Checkpoint  // set when paused with ErrApprovalRequired
+	critiques  []*Critique  // set by Reflexion
+	candidates []*Candidate // set by Sampling
 
 	HasToolCalls bool
 }
@@ -72,7 +85,12 @@ func (r *Response) Stream() chan *llm.Chunk {
 	return r.stream
 }
 
-// Result ...
+// Critiques ...
+func (r *Response) Critiques() []*Critique {
+	return r.critiques
+}
+
+// Result invoke and parse completion into value, struct, map and slice values are constrained by json schema
 func (p *predictor) Result(ctx context.Context, value any) error {
 	if reflect.TypeOf(value).Kind() != reflect.Ptr {
 		return fmt.Errorf("predictor result target value must be a pointer")
@@ -82,14 +100,62 @@ func (p *predictor) Result(ctx context.Context, value any) error {
 	if err != nil {
 		return err
 	}
-	response, err := p.model.Invoke(ctx, messages,
-		llm.WithStream(true),
-	)
+	opts := []llm.InvokeOption{llm.WithStream(true)}
+	structured := p.structured(value)
+	if structured {
+		opts = append(opts, llm.WithJSONSchema(value))
+	}
+	p.reponse = NewResponse()
+	complete := p.complete
+	if c, ok := p.invoker.(completer); ok { // e.g. Reflexion revises the completion
+		complete = c.complete
+	}
+	if p.sampling != nil && p.sampling.N > 1 {
+		complete = func(ctx context.Context, messages []llm.Message, opts ...llm.InvokeOption) (string, error) {
+			return p.sample(ctx, messages, value, structured, opts...)
+		}
+	}
+	completion, err := complete(ctx, messages, opts...)
 	if err != nil {
 		return err
 	}
-	completion := response.Result().Message.Content()
+	p.reponse.message = llm.NewAssistantMessage(completion)
 	log.InfoContextf(ctx, "response: %s", completion)
+	return p.parse(completion, value, structured)
+}
 
+// parse completion into value
+func (p *predictor) parse(completion string, value any, structured bool) error {
+	if structured {
+		if err := json.Unmarshal([]byte(llm.ExtractJSON(completion)), value); err != nil {
+			return fmt.Errorf("predictor result unmarshal error: %w", err)
+		}
+		return nil
+	}
 	return p.adapter.Parse(completion, value)
 }
+
+// completer completes the formatted messages for Result
+type completer interface {
+	complete(ctx context.Context, messages []llm.Message, opts ...llm.InvokeOption) (string, error)
+}
+
+func (p *predictor) complete(ctx context.Context, messages []llm.Message, opts ...llm.InvokeOption) (string, error) {
+	response, err := p.model.Invoke(ctx, messages, opts...)
+	if err != nil {
+		return "", err
+	}
+	return response.Result().Message.Content(), nil
+}
+
+// structured markable adapter keeps its own output format
+func (p *predictor) structured(value any) bool {
+	if _, ok := p.adapter.(*MarkableAdapter); ok {
+		return false
+	}
+	switch reflect.TypeOf(value).Elem().Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/log"
+)
+
+// Sampling 多次采样后选出结果，用于 Result，例如 self-consistency 与 best-of-N
+type Sampling struct {
+	N           int      // 采样数
+	Native      bool     // 以 llm.WithN 一次请求 N 个 choice，provider 返回不足时以并发调用补足；否则并发调用 N 次
+	Temperature float64  // 采样温度，0 则使用模型默认
+	Selector    Selector // 选择策略，默认 MajorityVote()
+}
+
+// Candidate 采样的候选结果
+type Candidate struct {
+	Index      int     `json:"index"`
+	Completion string  `json:"completion"`
+	Value      any     `json:"value,omitempty"` // parsed into a new value of the Result target type
+	Err        error   `json:"-"`               // parse error, excluded from selection
+	Score      float64 `json:"score"`           // votes of MajorityVote, score of ScoreBy
+	Selected   bool    `json:"selected"`
+}
+
+// Selector selects the result among the candidates parsed without error, messages are the prompt of the candidates
+type Selector interface {
+	Select(ctx context.Context, messages []llm.Message, candidates []*Candidate) (*Candidate, error)
+}
+
+// SelectorFunc ...
+type SelectorFunc func(ctx context.Context, messages []llm.Message, candidates []*Candidate) (*Candidate, error)
+
+// Select ...
+func (f SelectorFunc) Select(ctx context.Context, messages []llm.Message, candidates []*Candidate) (*Candidate, error) {
+	return f(ctx, messages, candidates)
+}
+
+// sample draws the candidates and returns the completion of the selected one
+func (p *predictor) sample(ctx context.Context, messages []llm.Message, value any, structured bool,
+	opts ...llm.InvokeOption) (string, error) {
+	if p.sampling.Temperature > 0 {
+		opts = append(opts, llm.WithTemperature(p.sampling.Temperature))
+	}
+	completions, err := p.draw(ctx, messages, p.sampling.N, opts...)
+	if err != nil {
+		return "", err
+	}
+	candidates := make([]*Candidate, 0, len(completions))
+	valid := []*Candidate{}
+	for i, completion := range completions {
+		candidate := &Candidate{Index: i, Completion: completion}
+		target := reflect.New(reflect.TypeOf(value).Elem()).Interface()
+		if candidate.Err = p.parse(completion, target, structured); candidate.Err == nil {
+			candidate.Value = reflect.ValueOf(target).Elem().Interface()
+			valid = append(valid, candidate)
+		}
+		candidates = append(candidates, candidate)
+	}
+	p.reponse.candidates = candidates
+	if len(valid) == 0 {
+		return "", fmt.Errorf("predictor sampling no valid candidate of %d: %w", len(candidates), candidates[0].Err)
+	}
+	selector := p.sampling.Selector
+	if selector == nil {
+		selector = MajorityVote()
+	}
+	selected, err := selector.Select(context.WithValue(ctx, selectUsageKey{}, p.addUsage), messages, valid)
+	if err != nil {
+		return "", fmt.Errorf("predictor sampling select error: %w", err)
+	}
+	selected.Selected = true
+	return selected.Completion, nil
+}
+
+// selectUsageKey the usage of the llm calls of a selector, e.g. JudgeBy, is added to the predictor by the func in context
+type selectUsageKey struct{}
+
+// draw n completions, natively by llm.WithN then topped up by concurrent calls
+func (p *predictor) draw(ctx context.Context, messages []llm.Message, n int, opts ...llm.InvokeOption) ([]string, error) {
+	completions := []string{}
+	if p.sampling.Native {
+		response, err := p.model.Invoke(ctx, messages, append(opts, llm.WithN(n))...)
+		if err != nil {
+			return nil, err
+		}
+		result := response.Result()
+		p.addUsage(result.Usage)
+		for _, choice := range result.Choices {
+			completions = append(completions, choice.Message.Content())
+		}
+		if len(completions) >= n {
+			return completions[:n], nil
+		}
+		log.WarnContextf(ctx, "predictor sampling got %d of %d choices, topped up by calls", len(completions), n)
+	}
+
+	results := make([]string, n-len(completions))
+	errs := make([]error, len(results))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := p.model.Invoke(ctx, messages, opts...)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			result := response.Result()
+			results[i] = result.Message.Content()
+			mu.Lock()
+			defer mu.Unlock()
+			p.addUsage(result.Usage)
+		}()
+	}
+	wg.Wait()
+	for i := range results { // failed calls are dropped
+		if errs[i] != nil {
+			log.WarnContextf(ctx, "predictor sampling call error: %v", errs[i])
+			continue
+		}
+		completions = append(completions, results[i])
+	}
+	if len(completions) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return completions, nil
+}
+
+// MajorityVote selects the most frequent value of the output fields (json names of the parsed value),
+// the whole value if no fields, ties are broken by the order of candidates
+func MajorityVote(fields ...string) Selector {
+	return SelectorFunc(func(ctx context.Context, messages []llm.Message, candidates []*Candidate) (*Candidate, error) {
+		votes := map[string]float64{}
+		keys := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			key, err := voteKey(candidate.Value, fields)
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = key
+			votes[key]++
+		}
+		var selected *Candidate
+		for i, candidate := range candidates {
+			candidate.Score = votes[keys[i]]
+			if selected == nil || candidate.Score > selected.Score {
+				selected = candidate
+			}
+		}
+		return selected, nil
+	})
+}
+
+// voteKey the normalized json of the fields of value
+func voteKey(value any, fields []string) (string, error) {
+	if text, ok := value.(string); ok {
+		return strings.ToLower(strings.TrimSpace(text)), nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) == 0 {
+		return string(raw), nil
+	}
+	object := map[string]any{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return "", fmt.Errorf("vote on fields of non object value: %w", err)
+	}
+	projected := map[string]any{}
+	for _, field := range fields {
+		projected[field] = object[field]
+	}
+	raw, err = json.Marshal(projected) // keys are sorted
+	return string(raw), err
+}
+
+// ScoreBy selects the candidate of the highest score, e.g. by a verifier
+func ScoreBy(score func(ctx context.Context, value any) (float64, error)) Selector {
+	return SelectorFunc(func(ctx context.Context, messages []llm.Message, candidates []*Candidate) (*Candidate, error) {
+		var selected *Candidate
+		for _, candidate := range candidates {
+			s, err := score(ctx, candidate.Value)
+			if err != nil {
+				return nil, err
+			}
+			candidate.Score = s
+			if selected == nil || candidate.Score > selected.Score {
+				selected = candidate
+			}
+		}
+		return selected, nil
+	})
+}
+
+type judgeOutput struct {
+	Best   int    `json:"best" jsonschema:"description=the number of the best answer"`
+	Reason string `json:"reason" jsonschema:"description=why the answer is the best"`
+}
+
+var judgePrompt = `You are a judge. Compare the candidate answers to the task below and choose the best one.
+%s`
+
+// JudgeBy selects the best candidate by the judge model, criteria are optional
+func JudgeBy(judge *llm.Instance, criteria ...string) Selector {
+	return SelectorFunc(func(ctx context.Context, messages []llm.Message, candidates []*Candidate) (*Candidate, error) {
+		requirements := ""
+		if len(criteria) > 0 {
+			requirements = "Judge by the criteria:\n- " + strings.Join(criteria, "\n- ")
+		}
+		builder := strings.Builder{}
+		builder.WriteString("<task>\n")
+		for _, message := range messages {
+			builder.WriteString(fmt.Sprintf("[%s]\n%s\n", message.Role(), message.Content()))
+		}
+		builder.WriteString("</task>\n")
+		for i, candidate := range candidates {
+			builder.WriteString(fmt.Sprintf("<answer number=\"%d\">\n%s\n</answer>\n", i+1, candidate.Completion))
+		}
+		output := &judgeOutput{}
+		response, err := judge.Invoke(ctx, []llm.Message{
+			llm.NewSystemMessage(fmt.Sprintf(judgePrompt, requirements)),
+			llm.NewUserTextMessage(builder.String()),
+		}, llm.WithJSONSchema(output))
+		if err != nil {
+			return nil, err
+		}
+		result := response.Result()
+		if addUsage, ok := ctx.Value(selectUsageKey{}).(func(llm.Usage)); ok {
+			addUsage(result.Usage)
+		}
+		if err := json.Unmarshal([]byte(llm.ExtractJSON(result.Message.Content())), output); err != nil {
+			return nil, fmt.Errorf("judge output unmarshal error: %w", err)
+		}
+		if output.Best < 1 || output.Best > len(candidates) {
+			return nil, fmt.Errorf("judge chose answer %d out of %d", output.Best, len(candidates))
+		}
+		selected := candidates[output.Best-1]
+		selected.Score = 1
+		return selected, nil
+	})
+}
+
+// Candidates the candidates of Sampling in order, Selected is the result
+func (p *predictor) Candidates() []*Candidate {
+	if p.reponse == nil {
+		return nil
+	}
+	return p.reponse.candidates
+}
@@ -0,0 +1,86 @@
+package program
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+// samplingProvider replies in order, at most two replies at once as choices if n requested
+type samplingProvider struct {
+	mu      sync.Mutex
+	replies []string
+	n       []int
+}
+
+func (s *samplingProvider) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n = append(s.n, opts.N)
+	chunk := llm.NewChunk(0, llm.NewAssistantMessage(s.replies[0]), &llm.Usage{TotalTokens: 10})
+	s.replies = s.replies[1:]
+	for i := 1; i < min(opts.N, 2) && len(s.replies) > 0; i++ {
+		chunk.Choices = append(chunk.Choices, &llm.ChunkChoice{Index: i, Delta: llm.NewAssistantMessage(s.replies[0])})
+		s.replies = s.replies[1:]
+	}
+	response := llm.NewStreamResponse()
+	go func() {
+		defer response.Stream().Close()
+		response.Stream().Push(chunk)
+	}()
+	return response, nil
+}
+
+type samplingLabel struct {
+	Label string `json:"label"`
+	Note  string `json:"note"`
+}
+
+func TestPredictor_SamplingMajorityVote(t *testing.T) {
+	provider := &samplingProvider{replies: []string{
+		`{"label":"spam","note":"a"}`, `{"label":"ham","note":"b"}`, // native choices, one short of n
+		`{"label":"spam","note":"c"}`, // topped up
+	}}
+	p := NewPredictor(WithLLMInstance(llm.NewInstance("scripted", llm.WithProvider(provider)))).
+		WithInstruction("classify the email").
+		WithSampling(&Sampling{N: 3, Native: true, Selector: MajorityVote("label")})
+
+	value := samplingLabel{}
+	assert.NoError(t, p.Result(context.Background(), &value))
+	assert.Equal(t, "spam", value.Label)
+	assert.Equal(t, "a", value.Note)
+	assert.Equal(t, []int{3, 0}, provider.n)
+	assert.Len(t, p.Candidates(), 3)
+	assert.True(t, p.Candidates()[0].Selected)
+	assert.Equal(t, float64(2), p.Candidates()[0].Score)
+	assert.Equal(t, 20, p.Usage.TotalTokens)
+}
+
+func TestPredictor_SamplingScoreBy(t *testing.T) {
+	provider := &samplingProvider{replies: []string{`{"label":"a","note":""}`, `{"label":"bbb","note":""}`, `{"label":"cc","note":""}`}}
+	p := NewPredictor(WithLLMInstance(llm.NewInstance("scripted", llm.WithProvider(provider)))).
+		WithSampling(&Sampling{N: 3, Selector: ScoreBy(func(ctx context.Context, value any) (float64, error) {
+			return float64(len(value.(samplingLabel).Label)), nil
+		})})
+
+	value := samplingLabel{}
+	assert.NoError(t, p.Result(context.Background(), &value))
+	assert.Equal(t, "bbb", value.Label)
+	assert.Len(t, p.Candidates(), 3)
+}
+
+func TestPredictor_SamplingJudgeBy(t *testing.T) {
+	provider := &samplingProvider{replies: []string{`{"label":"spam","note":"a"}`, `{"label":"ham","note":"b"}`}}
+	judge := &samplingProvider{replies: []string{`{"best":2,"reason":"not an ad"}`}}
+	p := NewPredictor(WithLLMInstance(llm.NewInstance("scripted", llm.WithProvider(provider)))).
+		WithSampling(&Sampling{N: 2, Native: true,
+			Selector: JudgeBy(llm.NewInstance("judge", llm.WithProvider(judge)))})
+
+	value := samplingLabel{}
+	assert.NoError(t, p.Result(context.Background(), &value))
+	assert.Equal(t, "ham", value.Label)
+	assert.Equal(t, 20, p.Usage.TotalTokens) // the judge call is counted
+}
@@ -0,0 +1,139 @@
+package rag
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/showntop/llmack/pkg/strings"
+	"github.com/showntop/llmack/vdb"
+)
+
+// BM25 进程内的倒排索引，按 BM25 对关键词检索打分，作为不支持全文检索的向量库的关键词索引
+type BM25 struct {
+	K1 float64 // 词频饱和度，默认 1.2
+	B  float64 // 文档长度归一化，默认 0.75
+
+	mutex    sync.RWMutex
+	docs     map[string]*bm25Document
+	postings map[string]map[string]int // term -> doc id -> term frequency
+	length   int                       // total tokens of all documents
+}
+
+type bm25Document struct {
+	doc    *vdb.Document
+	terms  map[string]int
+	length int
+}
+
+// NewBM25 ...
+func NewBM25() *BM25 {
+	return &BM25{
+		K1:       1.2,
+		B:        0.75,
+		docs:     map[string]*bm25Document{},
+		postings: map[string]map[string]int{},
+	}
+}
+
+// Store indexes the title and content of docs, the document of the same id is replaced
+func (b *BM25) Store(_ context.Context, docs ...*vdb.Document) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, doc := range docs {
+		b.remove(doc.ID)
+		tokens := strings.Tokenize(doc.Title + " " + doc.Content)
+		indexed := &bm25Document{doc: doc, terms: map[string]int{}, length: len(tokens)}
+		for _, token := range tokens {
+			indexed.terms[token]++
+		}
+		for term, frequency := range indexed.terms {
+			if b.postings[term] == nil {
+				b.postings[term] = map[string]int{}
+			}
+			b.postings[term][doc.ID] = frequency
+		}
+		b.docs[doc.ID] = indexed
+		b.length += indexed.length
+	}
+	return nil
+}
+
+// Delete ...
+func (b *BM25) Delete(_ context.Context, id string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.remove(id)
+	return nil
+}
+
+func (b *BM25) remove(id string) {
+	indexed, ok := b.docs[id]
+	if !ok {
+		return
+	}
+	for term := range indexed.terms {
+		delete(b.postings[term], id)
+		if len(b.postings[term]) == 0 {
+			delete(b.postings, term)
+		}
+	}
+	b.length -= indexed.length
+	delete(b.docs, id)
+}
+
+// KeywordSearch ranks the documents matching any term of query by BM25, the filter of options is evaluated on metadata
+func (b *BM25) KeywordSearch(_ context.Context, query string, options *vdb.SearchOptions) ([]*vdb.Document, error) {
+	if options.Filter != nil {
+		if err := options.Filter.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if len(b.docs) == 0 {
+		return []*vdb.Document{}, nil
+	}
+	avgLength := float64(b.length) / float64(len(b.docs))
+	scores := map[string]float64{}
+	terms := map[string]struct{}{}
+	for _, term := range strings.Tokenize(query) {
+		if _, ok := terms[term]; ok { // repeated terms of query are scored once
+			continue
+		}
+		terms[term] = struct{}{}
+		postings := b.postings[term]
+		n := float64(len(postings))
+		idf := math.Log(1 + (float64(len(b.docs))-n+0.5)/(n+0.5))
+		for id, frequency := range postings {
+			tf := float64(frequency)
+			norm := b.K1 * (1 - b.B + b.B*float64(b.docs[id].length)/avgLength)
+			scores[id] += idf * tf * (b.K1 + 1) / (tf + norm)
+		}
+	}
+
+	docs := make([]*vdb.Document, 0, len(scores))
+	for id, score := range scores {
+		indexed := b.docs[id]
+		if options.Filter != nil && !options.Filter.Match(indexed.doc.Metadata) {
+			continue
+		}
+		doc := *indexed.doc
+		doc.Similarity = float32(score)
+		docs = append(docs, &doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Similarity != docs[j].Similarity {
+			return docs[i].Similarity > docs[j].Similarity
+		}
+		return docs[i].ID < docs[j].ID
+	})
+	if options.TopK > 0 && len(docs) > options.TopK {
+		docs = docs[:options.TopK]
+	}
+	return docs, nil
+}
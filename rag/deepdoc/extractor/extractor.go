@@ -14,6 +14,31 @@ var reCsv = regexp.MustCompile(`\.csv$`)
 var reJson = regexp.MustCompile(`\.json$`)
 var reMdx = regexp.MustCompile(`\.md$`)
 
+// Detect the document type of filename by extension: docx, xlsx, pptx, pdf, txt, doc, csv, json, md, or empty if unknown
+func Detect(filename string) string {
+	switch {
+	case reDocx.MatchString(filename):
+		return "docx"
+	case reXlsx.MatchString(filename):
+		return "xlsx"
+	case rePptx.MatchString(filename):
+		return "pptx"
+	case rePdf.MatchString(filename):
+		return "pdf"
+	case reTxtx.MatchString(filename):
+		return "txt"
+	case reDoc.MatchString(filename):
+		return "doc"
+	case reCsv.MatchString(filename):
+		return "csv"
+	case reJson.MatchString(filename):
+		return "json"
+	case reMdx.MatchString(filename):
+		return "md"
+	}
+	return ""
+}
+
 var extractors = map[string]Extractor{}
 
 func init() {
@@ -0,0 +1,65 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/showntop/llmack/log"
+	"github.com/showntop/llmack/rag"
+	"github.com/showntop/llmack/rag/deepdoc"
+)
+
+// SectionExtractor 按文件类型（扩展名不区分大小写）以 deepdoc 抽取片段，用于 rag.Ingester：pdf 按页，markdown 按标题，其余为整个文件；
+// 未知类型按文本抽取，非 UTF-8 内容返回错误
+type SectionExtractor struct {
+}
+
+// NewSectionExtractor ...
+func NewSectionExtractor() *SectionExtractor {
+	return &SectionExtractor{}
+}
+
+// Extract ...
+func (e *SectionExtractor) Extract(ctx context.Context, filename string, binary []byte) ([]*rag.Section, error) {
+	var sections []string
+	var err error
+	separator := ""
+	switch Detect(strings.ToLower(filename)) {
+	case "pdf":
+		if sections, err = deepdoc.Pdf().Extract(filename, binary); err != nil {
+			return nil, err
+		}
+		pages := make([]*rag.Section, 0, len(sections))
+		for i, text := range sections {
+			pages = append(pages, &rag.Section{Text: text, Page: i + 1})
+		}
+		return pages, nil
+	case "md":
+		return rag.MarkdownSections(string(binary)), nil
+	case "txt", "csv":
+		return []*rag.Section{{Text: string(binary)}}, nil
+	case "docx":
+		sections, err = deepdoc.Docx().Extract(filename, binary)
+	case "pptx":
+		sections, err = deepdoc.Pptx().Extract(filename, binary)
+	case "doc":
+		sections, err = deepdoc.Doc().Extract(filename, binary)
+	case "xlsx":
+		sections, err = deepdoc.Excel().Extract(filename, binary)
+		separator = "\n"
+	case "json":
+		sections, err = deepdoc.Json().Extract(filename, binary)
+	default:
+		if !utf8.Valid(binary) {
+			return nil, fmt.Errorf("section extractor does not support binary content of %s", filename)
+		}
+		log.WarnContextf(ctx, "extract unknow document filename: %s by txt", filename)
+		return []*rag.Section{{Text: string(binary)}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []*rag.Section{{Text: strings.Join(sections, separator)}}, nil
+}
@@ -0,0 +1,93 @@
+package rag
+
+import (
+	"sort"
+
+	"github.com/showntop/llmack/vdb"
+)
+
+// Fusion 混合检索中向量与关键词结果的融合方式
+type Fusion string
+
+const (
+	// FusionRRF reciprocal rank fusion，按排名融合，与两路打分的量纲无关
+	FusionRRF Fusion = "rrf"
+	// FusionWeighted 两路打分各自 min-max 归一化后加权求和
+	FusionWeighted Fusion = "weighted"
+)
+
+// RRFK reciprocal rank fusion 的平滑常数
+const RRFK = 60
+
+// fuse merges the ranked lists by id, the Similarity of the fused documents is the fused score.
+// distances[i] is whether the Similarity of lists[i] is a distance, see vdb.DistanceScorer
+func fuse(fusion Fusion, lists [][]*vdb.Document, weights []float64, distances []bool, topK int) []*vdb.Document {
+	scores := map[string]float64{}
+	docs := map[string]*vdb.Document{}
+	for i, list := range lists {
+		normalized := normalize(list, distances[i])
+		for rank, doc := range list {
+			key := documentKey(doc)
+			if _, ok := docs[key]; !ok {
+				docs[key] = doc
+			}
+			if fusion == FusionWeighted {
+				scores[key] += weights[i] * normalized[rank]
+			} else {
+				scores[key] += weights[i] / float64(RRFK+rank+1)
+			}
+		}
+	}
+
+	fused := make([]*vdb.Document, 0, len(docs))
+	for key, doc := range docs {
+		doc := *doc
+		doc.Similarity = float32(scores[key])
+		fused = append(fused, &doc)
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		if fused[i].Similarity != fused[j].Similarity {
+			return fused[i].Similarity > fused[j].Similarity
+		}
+		return documentKey(fused[i]) < documentKey(fused[j])
+	})
+	if topK > 0 && len(fused) > topK {
+		fused = fused[:topK]
+	}
+	return fused
+}
+
+// normalize min-max scales the similarities of the ranked list to [0, 1], the best is 1.
+// If distance the smaller similarity is better.
+func normalize(list []*vdb.Document, distance bool) []float64 {
+	normalized := make([]float64, len(list))
+	if len(list) == 0 {
+		return normalized
+	}
+	low, high := list[0].Similarity, list[0].Similarity
+	for _, doc := range list {
+		low, high = min(low, doc.Similarity), max(high, doc.Similarity)
+	}
+	for i, doc := range list {
+		switch {
+		case high == low:
+			normalized[i] = 1
+		case distance:
+			normalized[i] = float64((high - doc.Similarity) / (high - low))
+		default:
+			normalized[i] = float64((doc.Similarity - low) / (high - low))
+		}
+	}
+	return normalized
+}
+
+// documentKey identifies the same document in both lists
+func documentKey(doc *vdb.Document) string {
+	if doc.ID != "" {
+		return doc.ID
+	}
+	if doc.ContentHash != "" {
+		return doc.ContentHash
+	}
+	return doc.Content
+}
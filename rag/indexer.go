@@ -2,6 +2,7 @@ package rag
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/showntop/llmack/log"
 	"github.com/showntop/llmack/vdb"
@@ -10,7 +11,12 @@ import (
 // Indexer ...
 type Indexer struct {
 	vdb      vdb.VDB
-	scalarDB ScalarDB // object
+	scalarDB ScalarDB            // object
+	keyword  vdb.KeywordSearcher // 关键词索引，vdb 不支持全文检索时为进程内的 BM25
+	bm25     *BM25
+
+	reranker   Reranker
+	rerankTopN int
 }
 
 // NewIndexer ...
@@ -20,7 +26,25 @@ func NewIndexer(name string, config any) (*Indexer, error) {
 		return nil, err
 	}
 
-	return &Indexer{vdb: vdb}, nil
+	return newIndexer(vdb), nil
+}
+
+func newIndexer(db vdb.VDB) *Indexer {
+	indexer := &Indexer{vdb: db}
+	if keyword, ok := db.(vdb.KeywordSearcher); ok {
+		indexer.keyword = keyword
+	} else {
+		indexer.bm25 = NewBM25()
+		indexer.keyword = indexer.bm25
+	}
+	return indexer
+}
+
+// WithReranker 检索结果经 reranker 重排后保留前 topN 个（0 为全部保留），可被 WithRerankTopN 覆盖
+func (r *Indexer) WithReranker(reranker Reranker, topN int) *Indexer {
+	r.reranker = reranker
+	r.rerankTopN = topN
+	return r
 }
 
 // Retrieve TODO: 实现检索逻辑
@@ -34,21 +58,101 @@ func (r *Indexer) Retrieve(ctx context.Context, query string, opts ...SearchOpti
 	vdbSearchOpts := &vdb.SearchOptions{
 		TopK:      searchOpts.TopK,
 		Threshold: searchOpts.ScoreThreshold,
+		Filter:    searchOpts.filter(),
+	}
+	var docs []*vdb.Document
+	var err error
+	if searchOpts.Hybrid {
+		docs, err = r.hybrid(ctx, query, searchOpts, vdbSearchOpts)
+	} else {
+		docs, err = r.vdb.SearchQueryWithOptions(ctx, query, vdbSearchOpts)
 	}
-	docs, err := r.vdb.SearchQueryWithOptions(ctx, query, vdbSearchOpts)
 	if err != nil {
 		return nil, err
 	}
+	if r.reranker == nil || len(docs) == 0 {
+		return docs, nil
+	}
 
+	docs, err = r.reranker.Rerank(ctx, query, docs)
+	if err != nil {
+		return nil, fmt.Errorf("rerank error: %w", err)
+	}
+	topN := r.rerankTopN
+	if searchOpts.RerankTopN > 0 {
+		topN = searchOpts.RerankTopN
+	}
+	if topN > 0 && len(docs) > topN {
+		docs = docs[:topN]
+	}
 	return docs, nil
 }
 
+// hybrid retrieves by vector and keyword, the two ranked lists are fused
+func (r *Indexer) hybrid(ctx context.Context, query string, opts *SearchOptions, vdbOpts *vdb.SearchOptions) ([]*vdb.Document, error) {
+	orDefault := func(value, defaultValue int) int {
+		if value > 0 {
+			return value
+		}
+		return defaultValue
+	}
+	topK := orDefault(opts.TopK, 10)
+
+	vectorOpts := *vdbOpts
+	vectorOpts.TopK = orDefault(opts.VectorTopK, topK)
+	vectorDocs, err := r.vdb.SearchQueryWithOptions(ctx, query, &vectorOpts)
+	if err != nil {
+		return nil, err
+	}
+	keywordOpts := *vdbOpts
+	keywordOpts.TopK = orDefault(opts.KeywordTopK, topK)
+	keywordDocs, err := r.keyword.KeywordSearch(ctx, query, &keywordOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	vectorWeight, keywordWeight := opts.VectorWeight, opts.KeywordWeight
+	if vectorWeight == 0 && keywordWeight == 0 {
+		vectorWeight, keywordWeight = 1, 1
+	}
+	lists := [][]*vdb.Document{vectorDocs, keywordDocs}
+	// keyword scores are relevance (bm25, ts_rank), higher is better even if the vector scores of the same backend are distances
+	distances := []bool{vdb.IsDistance(r.vdb), false}
+	return fuse(opts.Fusion, lists, []float64{vectorWeight, keywordWeight}, distances, topK), nil
+}
+
 func (r *Indexer) Index(ctx context.Context, docs []*vdb.Document, opts *SearchOptions) ([]*vdb.Document, error) {
 	log.InfoContextf(ctx, "Index documents %+v with options %+v", docs, opts)
+	if opts != nil && opts.LibraryID != 0 { // filtered by library on retrieve
+		for _, doc := range docs {
+			if doc.Metadata == nil {
+				doc.Metadata = map[string]any{}
+			}
+			doc.Metadata[MetadataLibraryID] = opts.LibraryID
+		}
+	}
 	// 将知识库中的数据转换为向量
 	if err := r.vdb.Store(ctx, docs...); err != nil {
 		return nil, err
 	}
+	if r.bm25 != nil { // the keyword index of vdb is stored with the documents
+		if err := r.bm25.Store(ctx, docs...); err != nil {
+			return nil, err
+		}
+	}
 
 	return nil, nil
 }
+
+// Delete deletes the documents of ids from the vdb and the keyword index in bulk
+func (r *Indexer) Delete(ctx context.Context, ids ...string) error {
+	if err := vdb.Delete(ctx, r.vdb, ids...); err != nil {
+		return err
+	}
+	if r.bm25 != nil {
+		for _, id := range ids {
+			r.bm25.Delete(ctx, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package rag
+
+import (
+	"context"
+	"testing"
+
+	"github.com/showntop/llmack/vdb"
+	"github.com/showntop/llmack/vdb/memo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBM25_KeywordSearch(t *testing.T) {
+	ctx := context.Background()
+	index := NewBM25()
+	assert.NoError(t, index.Store(ctx,
+		&vdb.Document{ID: "1", Content: "退款政策：七天无理由退款"},
+		&vdb.Document{ID: "2", Content: "SKU-9931 的保修说明", Metadata: map[string]any{"lang": "zh"}},
+		&vdb.Document{ID: "3", Content: "shipping policy for orders"},
+	))
+
+	docs, err := index.KeywordSearch(ctx, "如何退款", &vdb.SearchOptions{TopK: 10})
+	assert.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.Equal(t, "1", docs[0].ID)
+
+	docs, err = index.KeywordSearch(ctx, "sku-9931 policy", &vdb.SearchOptions{TopK: 10, Filter: vdb.Eq("lang", "zh")})
+	assert.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.Equal(t, "2", docs[0].ID)
+
+	assert.NoError(t, index.Delete(ctx, "2"))
+	docs, err = index.KeywordSearch(ctx, "SKU-9931", &vdb.SearchOptions{TopK: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, docs)
+}
+
+func TestIndexer_RetrieveHybrid(t *testing.T) {
+	ctx := context.Background()
+	indexer := newIndexer(memo.New())
+	_, err := indexer.Index(ctx, []*vdb.Document{
+		{ID: "1", Content: "return policy of the store"},
+		{ID: "2", Content: "warranty of product SKU-9931"},
+		{ID: "3", Content: "shipping and delivery times"},
+	}, &SearchOptions{LibraryID: 1})
+	assert.NoError(t, err)
+
+	docs, err := indexer.Retrieve(ctx, "SKU-9931", WithTopK(2), WithHybrid(FusionRRF), WithLibraryID(1))
+	assert.NoError(t, err)
+	assert.Len(t, docs, 2)
+	assert.Equal(t, "2", docs[0].ID) // ranked by both vector and keyword
+
+	docs, err = indexer.Retrieve(ctx, "SKU-9931", WithTopK(2), WithHybrid(FusionWeighted), WithFusionWeights(0, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, "2", docs[0].ID)
+
+	docs, err = indexer.Retrieve(ctx, "SKU-9931", WithHybrid(FusionRRF), WithLibraryID(2))
+	assert.NoError(t, err)
+	assert.Empty(t, docs)
+}
+
+// distanceStore scores vectors by distance and keywords by relevance, like pgvector
+type distanceStore struct {
+	vdb.VDB
+}
+
+func (distanceStore) DistanceScore() bool { return true }
+
+func (distanceStore) SearchQueryWithOptions(ctx context.Context, query string, options *vdb.SearchOptions) ([]*vdb.Document, error) {
+	return []*vdb.Document{{ID: "1", Similarity: 0.2}, {ID: "2", Similarity: 0.4}}, nil
+}
+
+func (distanceStore) KeywordSearch(ctx context.Context, query string, options *vdb.SearchOptions) ([]*vdb.Document, error) {
+	return []*vdb.Document{{ID: "2", Similarity: 0.9}, {ID: "3", Similarity: 0.1}}, nil // ts_rank desc
+}
+
+func TestIndexer_HybridDistanceStore(t *testing.T) {
+	indexer := newIndexer(distanceStore{memo.New()})
+	docs, err := indexer.Retrieve(context.Background(), "q", WithHybrid(FusionWeighted), WithFusionWeights(0, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, "2", docs[0].ID) // the best keyword match
+
+	docs, err = indexer.Retrieve(context.Background(), "q", WithHybrid(FusionWeighted), WithFusionWeights(1, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", docs[0].ID) // the smallest distance
+}
+
+func TestFuse_Weighted(t *testing.T) {
+	vector := []*vdb.Document{{ID: "a", Similarity: 0.1}, {ID: "b", Similarity: 0.5}}
+	keyword := []*vdb.Document{{ID: "b", Similarity: 3}}
+	lists := [][]*vdb.Document{vector, keyword}
+
+	fused := fuse(FusionWeighted, lists, []float64{1, 0}, []bool{true, false}, 0)
+	assert.Equal(t, "a", fused[0].ID) // the smaller distance is better
+	assert.Equal(t, float32(1), fused[0].Similarity)
+
+	fused = fuse(FusionWeighted, lists, []float64{1, 0}, []bool{false, false}, 0)
+	assert.Equal(t, "b", fused[0].ID)
+}
@@ -0,0 +1,395 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/showntop/llmack/embedding"
+	"github.com/showntop/llmack/log"
+	"github.com/showntop/llmack/rag/deepdoc/chunk"
+	"github.com/showntop/llmack/vdb"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// 导入时写入文档元数据的来源信息
+const (
+	MetadataFilename   = "filename"
+	MetadataPage       = "page"        // 页码，从 1 开始
+	MetadataHeading    = "heading"     // 所属章节标题
+	MetadataChunkIndex = "chunk_index" // 文件内的分片序号，从 0 开始
+)
+
+// Source 待导入的文件，Reader 为空时从 Filename 读取
+type Source struct {
+	Filename string
+	Reader   io.Reader
+}
+
+// Section 抽取出的文档片段及其位置
+type Section struct {
+	Text    string
+	Page    int    // 页码，从 1 开始，0 为未知
+	Heading string // 所属章节标题
+}
+
+// Extractor 从文件内容中抽取片段，deepdoc 的实现见 rag/deepdoc/extractor.NewSectionExtractor
+type Extractor interface {
+	Extract(ctx context.Context, filename string, content []byte) ([]*Section, error)
+}
+
+// ExtractorFunc ...
+type ExtractorFunc func(ctx context.Context, filename string, content []byte) ([]*Section, error)
+
+// Extract ...
+func (f ExtractorFunc) Extract(ctx context.Context, filename string, content []byte) ([]*Section, error) {
+	return f(ctx, filename, content)
+}
+
+var markdownHeadingPattern = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*\s*$`)
+
+// binaryExtensions the document types not extracted by TextExtractor
+var binaryExtensions = []string{".pdf", ".doc", ".docx", ".xlsx", ".pptx"}
+
+// TextExtractor 纯文本抽取，markdown 按标题切分为片段；pdf、docx 等二进制文件返回错误，
+// 需使用 rag/deepdoc/extractor.NewSectionExtractor
+type TextExtractor struct {
+}
+
+// Extract ...
+func (e *TextExtractor) Extract(_ context.Context, filename string, content []byte) ([]*Section, error) {
+	if ext := strings.ToLower(filepath.Ext(filename)); slices.Contains(binaryExtensions, ext) {
+		return nil, fmt.Errorf("text extractor does not support %s files, use extractor.NewSectionExtractor", ext)
+	}
+	if !utf8.Valid(content) {
+		return nil, fmt.Errorf("text extractor does not support binary content of %s", filename)
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".md") {
+		return []*Section{{Text: string(content)}}, nil
+	}
+	return MarkdownSections(string(content)), nil
+}
+
+// MarkdownSections splits the markdown by headings, the heading of a section is its nearest heading
+func MarkdownSections(content string) []*Section {
+	sections := []*Section{}
+	current := &Section{}
+	lines := []string{}
+	flush := func() {
+		if current.Text = strings.TrimSpace(strings.Join(lines, "\n")); current.Text != "" {
+			sections = append(sections, current)
+		}
+		lines = lines[:0]
+	}
+	fenced := false
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+		}
+		if match := markdownHeadingPattern.FindStringSubmatch(line); match != nil && !fenced {
+			flush()
+			current = &Section{Heading: match[1]}
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return sections
+}
+
+// IngestStage ...
+type IngestStage string
+
+const (
+	IngestExtracted IngestStage = "extracted"
+	IngestChunked   IngestStage = "chunked"
+	IngestStored    IngestStage = "stored"  // 每批写入后上报，Stored 为累计写入的分片数
+	IngestDeleted   IngestStage = "deleted" // 删除过期分片后上报
+	IngestFailed    IngestStage = "failed"
+	IngestDone      IngestStage = "done"
+)
+
+// IngestProgress 单个文件的导入进度
+type IngestProgress struct {
+	Filename  string
+	Stage     IngestStage
+	Sections  int
+	Chunks    int
+	Unchanged int // 内容与序号均与上次导入相同、跳过向量化与写入的分片数
+	Stored    int
+	Deleted   int // 上次导入后已不存在的过期分片数
+	Err       error
+}
+
+// Ingester 文档导入：抽取、切分、批量向量化，附加来源元数据后写入 Indexer 的向量库。
+// 按 Manifest 增量导入：分片 ID 由知识库、源文档与内容哈希组成，重复导入时只写入变化的分片，并批量删除过期分片
+type Ingester struct {
+	Indexer    *Indexer
+	Extractor  Extractor          // 默认 TextExtractor，仅支持纯文本与 markdown
+	Chunker    chunk.Chunker      // 默认按段落、句子递归切分，500 字符，重叠 50
+	Embedder   embedding.Embedder // 可选，批量向量化后随文档写入，否则由向量库向量化
+	BatchSize  int                // 每批写入的分片数，默认 32
+	Options    *SearchOptions     // 写入选项，如 LibraryID
+	Manifest   Manifest           // 默认 MemoryManifest，跨进程增量导入需持久化，如 FileManifest
+	OnProgress func(*IngestProgress)
+}
+
+// NewIngester ...
+func NewIngester(indexer *Indexer) *Ingester {
+	return &Ingester{Indexer: indexer, Manifest: NewMemoryManifest()}
+}
+
+// IngestFiles ingests the files of paths
+func (i *Ingester) IngestFiles(ctx context.Context, paths ...string) ([]*IngestProgress, error) {
+	sources := make([]*Source, 0, len(paths))
+	for _, path := range paths {
+		sources = append(sources, &Source{Filename: path})
+	}
+	return i.Ingest(ctx, sources...)
+}
+
+// Ingest ingests the sources one by one, a failed file does not stop the others.
+// It returns the final progress of every source and the joined errors of the failed.
+func (i *Ingester) Ingest(ctx context.Context, sources ...*Source) ([]*IngestProgress, error) {
+	results := make([]*IngestProgress, 0, len(sources))
+	errs := []error{}
+	for _, source := range sources {
+		progress := &IngestProgress{Filename: source.Filename}
+		if err := i.ingest(ctx, source, progress); err != nil {
+			log.WarnContextf(ctx, "ingest %s error: %v", source.Filename, err)
+			progress.Stage, progress.Err = IngestFailed, err
+			errs = append(errs, fmt.Errorf("ingest %s: %w", source.Filename, err))
+		} else {
+			progress.Stage = IngestDone
+		}
+		i.report(progress)
+		results = append(results, progress)
+	}
+	return results, errors.Join(errs...)
+}
+
+func (i *Ingester) ingest(ctx context.Context, source *Source, progress *IngestProgress) error {
+	content, err := read(source)
+	if err != nil {
+		return err
+	}
+	extractor := i.Extractor
+	if extractor == nil {
+		extractor = &TextExtractor{}
+	}
+	sections, err := extractor.Extract(ctx, source.Filename, content)
+	if err != nil {
+		return fmt.Errorf("extract: %w", err)
+	}
+	progress.Stage, progress.Sections = IngestExtracted, len(sections)
+	i.report(progress)
+
+	key := i.source(source.Filename)
+	docs, err := i.chunk(key, source.Filename, sections)
+	if err != nil {
+		return fmt.Errorf("chunk: %w", err)
+	}
+	progress.Stage, progress.Chunks = IngestChunked, len(docs)
+	i.report(progress)
+
+	manifest := i.manifest()
+	previous, err := manifest.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	current := &SourceManifest{Source: key, Chunks: map[string]*ManifestChunk{}, UpdatedAt: time.Now()}
+	changed := []*vdb.Document{}
+	for index, doc := range docs {
+		current.Chunks[doc.ID] = &ManifestChunk{Hash: doc.ContentHash, Index: index}
+		// a moved chunk is written again, the chunk_index of metadata is kept up to date
+		if previous == nil || previous.Chunks[doc.ID] == nil || *previous.Chunks[doc.ID] != *current.Chunks[doc.ID] {
+			changed = append(changed, doc)
+		}
+	}
+	progress.Unchanged = len(docs) - len(changed)
+
+	batchSize := i.BatchSize
+	if batchSize <= 0 {
+		batchSize = 32
+	}
+	for from := 0; from < len(changed); from += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch := changed[from:min(from+batchSize, len(changed))]
+		if err := i.embed(ctx, batch); err != nil {
+			return fmt.Errorf("embed: %w", err)
+		}
+		if _, err := i.Indexer.Index(ctx, batch, i.Options); err != nil {
+			return fmt.Errorf("store: %w", err)
+		}
+		progress.Stage, progress.Stored = IngestStored, progress.Stored+len(batch)
+		i.report(progress)
+	}
+
+	if previous != nil {
+		stale := []string{}
+		for id := range previous.Chunks {
+			if _, ok := current.Chunks[id]; !ok {
+				stale = append(stale, id)
+			}
+		}
+		if len(stale) > 0 {
+			sort.Strings(stale)
+			if err := i.Indexer.Delete(ctx, stale...); err != nil {
+				return fmt.Errorf("delete stale chunks: %w", err)
+			}
+			progress.Stage, progress.Deleted = IngestDeleted, len(stale)
+			i.report(progress)
+		}
+	}
+	// recorded after the vdb is updated, a failed ingestion is retried by the previous manifest
+	if err := manifest.Put(ctx, current); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes all chunks of the source document ingested before into the library of Options
+func (i *Ingester) Remove(ctx context.Context, source string) error {
+	manifest := i.manifest()
+	key := i.source(source)
+	previous, err := manifest.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	if previous == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(previous.Chunks))
+	for id := range previous.Chunks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if err := i.Indexer.Delete(ctx, ids...); err != nil {
+		return fmt.Errorf("remove %s: %w", source, err)
+	}
+	return manifest.Delete(ctx, key)
+}
+
+// source returns the key of the source document in the manifest and chunk ids,
+// the same file ingested into different libraries does not share chunks
+func (i *Ingester) source(filename string) string {
+	if i.Options == nil || i.Options.LibraryID == 0 {
+		return filename
+	}
+	return fmt.Sprintf("%d:%s", i.Options.LibraryID, filename)
+}
+
+func (i *Ingester) manifest() Manifest {
+	if i.Manifest == nil {
+		i.Manifest = NewMemoryManifest()
+	}
+	return i.Manifest
+}
+
+func read(source *Source) ([]byte, error) {
+	if source.Reader != nil {
+		return io.ReadAll(source.Reader)
+	}
+	return os.ReadFile(source.Filename)
+}
+
+// chunk splits the sections into documents with source metadata, the duplicated chunks of the file are skipped
+func (i *Ingester) chunk(key, filename string, sections []*Section) ([]*vdb.Document, error) {
+	chunker := i.Chunker
+	if chunker == nil {
+		chunker = chunk.NewRecursiveCharacterChunker(500, 50, []string{"\n\n", "\n", "。", " ", ""})
+	}
+	docs := []*vdb.Document{}
+	hashes := map[string]bool{}
+	for _, section := range sections {
+		if strings.TrimSpace(section.Text) == "" {
+			continue
+		}
+		chunks, err := chunker.Chunk(section.Text)
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range chunks {
+			content = strings.TrimSpace(content)
+			hash := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+			if content == "" || hashes[hash] {
+				continue
+			}
+			hashes[hash] = true
+			metadata := map[string]any{
+				MetadataFilename:   filepath.Base(filename),
+				MetadataChunkIndex: len(docs),
+			}
+			if section.Page > 0 {
+				metadata[MetadataPage] = section.Page
+			}
+			if section.Heading != "" {
+				metadata[MetadataHeading] = section.Heading
+			}
+			docs = append(docs, &vdb.Document{
+				ID:          fmt.Sprintf("%s#%s", key, hash[:16]), // unchanged chunks keep the id on re-ingestion
+				Title:       section.Heading,
+				Content:     content,
+				ContentHash: hash,
+				Metadata:    metadata,
+			})
+		}
+	}
+	return docs, nil
+}
+
+// batchEmbedder embeds texts in one request, e.g. embedding.StringEmbedder
+type batchEmbedder interface {
+	BatchEmbed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+func (i *Ingester) embed(ctx context.Context, docs []*vdb.Document) error {
+	if i.Embedder == nil {
+		return nil
+	}
+	texts := make([]string, len(docs))
+	for j, doc := range docs {
+		texts[j] = doc.Content
+	}
+	var embeddings [][]float32
+	if batch, ok := i.Embedder.(batchEmbedder); ok {
+		var err error
+		if embeddings, err = batch.BatchEmbed(ctx, texts); err != nil {
+			return err
+		}
+	} else {
+		for _, text := range texts {
+			embedding, err := i.Embedder.Embed(ctx, text)
+			if err != nil {
+				return err
+			}
+			embeddings = append(embeddings, embedding)
+		}
+	}
+	if len(embeddings) != len(docs) {
+		return fmt.Errorf("embedded %d of %d chunks", len(embeddings), len(docs))
+	}
+	for j, doc := range docs {
+		doc.Embedding = pgvector.NewVector(embeddings[j])
+	}
+	return nil
+}
+
+func (i *Ingester) report(progress *IngestProgress) {
+	if i.OnProgress != nil {
+		snapshot := *progress
+		i.OnProgress(&snapshot)
+	}
+}
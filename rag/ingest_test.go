@@ -0,0 +1,141 @@
+package rag
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/showntop/llmack/embedding"
+	"github.com/showntop/llmack/vdb"
+	"github.com/showntop/llmack/vdb/memo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngester_Ingest(t *testing.T) {
+	ctx := context.Background()
+	db := memo.New()
+	ingester := NewIngester(newIndexer(db))
+	ingester.Embedder = embedding.NewStringEmbedder()
+	ingester.BatchSize = 1
+	ingester.Options = &SearchOptions{LibraryID: 7}
+	stages := map[string][]IngestStage{}
+	ingester.OnProgress = func(progress *IngestProgress) {
+		stages[progress.Filename] = append(stages[progress.Filename], progress.Stage)
+	}
+
+	markdown := "# Refunds\nRefunds are issued within 7 days.\n\n# Shipping\nOrders ship in 2 days.\n\n# Shipping\nOrders ship in 2 days."
+	results, err := ingester.Ingest(ctx,
+		&Source{Filename: "docs/policy.md", Reader: strings.NewReader(markdown)},
+		&Source{Filename: "missing.txt"},
+		&Source{Filename: "report.pdf", Reader: strings.NewReader("%PDF-1.7")},
+	)
+	assert.Error(t, err)
+	assert.Equal(t, IngestDone, results[0].Stage)
+	assert.Equal(t, 3, results[0].Sections)
+	assert.Equal(t, 2, results[0].Chunks) // the duplicated chunk is skipped
+	assert.Equal(t, 2, results[0].Stored)
+	assert.Equal(t, []IngestStage{IngestExtracted, IngestChunked, IngestStored, IngestStored, IngestDone}, stages["docs/policy.md"])
+	assert.Equal(t, IngestFailed, results[1].Stage)
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, IngestFailed, results[2].Stage) // not extracted as text by default
+	assert.ErrorContains(t, results[2].Err, "NewSectionExtractor")
+
+	docs, err := db.SearchQuery(ctx, "refund", vdb.WithFilter(vdb.Eq(MetadataHeading, "Shipping")))
+	assert.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.True(t, strings.HasPrefix(docs[0].ID, "7:docs/policy.md#"))
+	assert.Equal(t, "Shipping\nOrders ship in 2 days.", strings.TrimPrefix(docs[0].Content, "# "))
+	assert.NotEmpty(t, docs[0].ContentHash)
+	assert.Equal(t, "policy.md", docs[0].Metadata[MetadataFilename])
+	assert.Equal(t, 1, docs[0].Metadata[MetadataChunkIndex])
+	assert.Equal(t, int64(7), docs[0].Metadata[MetadataLibraryID])
+}
+
+func TestIngester_Reingest(t *testing.T) {
+	ctx := context.Background()
+	db := memo.New()
+	manifest, err := NewFileManifest(filepath.Join(t.TempDir(), "manifest.json"))
+	assert.NoError(t, err)
+	ingester := NewIngester(newIndexer(db))
+	ingester.Manifest = manifest
+	ingest := func(content string) *IngestProgress {
+		results, err := ingester.Ingest(ctx, &Source{Filename: "faq.md", Reader: strings.NewReader(content)})
+		assert.NoError(t, err)
+		return results[0]
+	}
+	count := func() int {
+		docs, err := db.SearchQuery(ctx, "faq", vdb.WithTopk(100))
+		assert.NoError(t, err)
+		return len(docs)
+	}
+
+	progress := ingest("# Refunds\nWithin 7 days.\n\n# Shipping\nIn 2 days.")
+	assert.Equal(t, 2, progress.Stored)
+	assert.Equal(t, 2, count())
+
+	progress = ingest("# Refunds\nWithin 7 days.\n\n# Shipping\nIn 3 days.\n\n# Returns\nFree.")
+	assert.Equal(t, 1, progress.Unchanged)
+	assert.Equal(t, 2, progress.Stored)
+	assert.Equal(t, 1, progress.Deleted)
+	assert.Equal(t, 3, count())
+
+	reloaded, err := NewFileManifest(manifest.path) // persisted across processes
+	assert.NoError(t, err)
+	ingester.Manifest = reloaded
+	progress = ingest("# Refunds\nWithin 7 days.\n\n# Shipping\nIn 3 days.\n\n# Returns\nFree.")
+	assert.Equal(t, 3, progress.Unchanged)
+	assert.Equal(t, 0, progress.Stored)
+
+	// the chunks after a removed section are moved, written again with the new chunk_index
+	progress = ingest("# Shipping\nIn 3 days.\n\n# Returns\nFree.")
+	assert.Equal(t, 0, progress.Unchanged)
+	assert.Equal(t, 2, progress.Stored)
+	assert.Equal(t, 1, progress.Deleted)
+	docs, err := db.SearchQuery(ctx, "faq", vdb.WithTopk(100))
+	assert.NoError(t, err)
+	indexes := map[string]any{}
+	for _, doc := range docs {
+		indexes[doc.Title] = doc.Metadata[MetadataChunkIndex]
+	}
+	assert.Equal(t, map[string]any{"Shipping": 0, "Returns": 1}, indexes)
+
+	assert.NoError(t, ingester.Remove(ctx, "faq.md"))
+	assert.Equal(t, 0, count())
+	removed, err := reloaded.Get(ctx, "faq.md")
+	assert.NoError(t, err)
+	assert.Nil(t, removed)
+	docs, err = ingester.Indexer.Retrieve(ctx, "Returns", WithHybrid(FusionRRF))
+	assert.NoError(t, err)
+	assert.Empty(t, docs) // removed from the keyword index too
+}
+
+func TestIngester_IngestLibraries(t *testing.T) {
+	ctx := context.Background()
+	db := memo.New()
+	ingester := NewIngester(newIndexer(db))
+	ingest := func(libraryID int64, content string) *IngestProgress {
+		ingester.Options = &SearchOptions{LibraryID: libraryID}
+		results, err := ingester.Ingest(ctx, &Source{Filename: "faq.md", Reader: strings.NewReader(content)})
+		assert.NoError(t, err)
+		return results[0]
+	}
+	count := func(libraryID int64) int {
+		docs, err := ingester.Indexer.Retrieve(ctx, "faq", WithLibraryID(libraryID), WithTopK(100))
+		assert.NoError(t, err)
+		return len(docs)
+	}
+
+	assert.Equal(t, 2, ingest(1, "# Refunds\nWithin 7 days.\n\n# Shipping\nIn 2 days.").Stored)
+	// the same file of another library is stored, not skipped as unchanged
+	assert.Equal(t, 2, ingest(2, "# Refunds\nWithin 7 days.\n\n# Shipping\nIn 2 days.").Stored)
+	progress := ingest(2, "# Refunds\nWithin 7 days.")
+	assert.Equal(t, 1, progress.Deleted)
+	assert.Equal(t, 2, count(1))
+	assert.Equal(t, 1, count(2))
+
+	ingester.Options = &SearchOptions{LibraryID: 1}
+	assert.NoError(t, ingester.Remove(ctx, "faq.md"))
+	assert.Equal(t, 0, count(1))
+	assert.Equal(t, 1, count(2))
+}
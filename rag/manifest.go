@@ -0,0 +1,135 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SourceManifest 源文档已写入向量库的分片
+type SourceManifest struct {
+	Source    string                    `json:"source"`
+	Chunks    map[string]*ManifestChunk `json:"chunks"` // chunk id -> chunk
+	UpdatedAt time.Time                 `json:"updated_at"`
+}
+
+// ManifestChunk 已写入的分片，内容哈希或序号变化时重新写入
+type ManifestChunk struct {
+	Hash  string `json:"hash"`
+	Index int    `json:"index"` // chunk_index of metadata
+}
+
+// Manifest 记录源文档与分片的对应关系，用于增量导入与按源文档删除
+type Manifest interface {
+	Get(ctx context.Context, source string) (*SourceManifest, error) // nil if not ingested
+	Put(ctx context.Context, manifest *SourceManifest) error
+	Delete(ctx context.Context, source string) error
+}
+
+// MemoryManifest 内存中的 Manifest，进程重启后丢失
+type MemoryManifest struct {
+	mutex     sync.RWMutex
+	manifests map[string]*SourceManifest
+}
+
+// NewMemoryManifest ...
+func NewMemoryManifest() *MemoryManifest {
+	return &MemoryManifest{manifests: map[string]*SourceManifest{}}
+}
+
+// Get ...
+func (m *MemoryManifest) Get(_ context.Context, source string) (*SourceManifest, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.manifests[source], nil
+}
+
+// Put ...
+func (m *MemoryManifest) Put(_ context.Context, manifest *SourceManifest) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.manifests[manifest.Source] = manifest
+	return nil
+}
+
+// Delete ...
+func (m *MemoryManifest) Delete(_ context.Context, source string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.manifests, source)
+	return nil
+}
+
+// FileManifest 保存在 JSON 文件中的 Manifest，每次修改写回整个文件
+type FileManifest struct {
+	path   string
+	mutex  sync.Mutex // serializes the writes of file
+	memory *MemoryManifest
+}
+
+// NewFileManifest loads the manifest of path if exists
+func NewFileManifest(path string) (*FileManifest, error) {
+	manifest := &FileManifest{path: path, memory: NewMemoryManifest()}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	if err := json.Unmarshal(content, &manifest.memory.manifests); err != nil {
+		return nil, fmt.Errorf("unmarshal manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Get ...
+func (m *FileManifest) Get(ctx context.Context, source string) (*SourceManifest, error) {
+	return m.memory.Get(ctx, source)
+}
+
+// Put ...
+func (m *FileManifest) Put(ctx context.Context, manifest *SourceManifest) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.memory.Put(ctx, manifest)
+	return m.save()
+}
+
+// Delete ...
+func (m *FileManifest) Delete(ctx context.Context, source string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.memory.Delete(ctx, source)
+	return m.save()
+}
+
+// save writes to a temporary file then renames, the manifest is not corrupted by a failed write
+func (m *FileManifest) save() error {
+	m.memory.mutex.RLock()
+	content, err := json.MarshalIndent(m.memory.manifests, "", "  ")
+	m.memory.mutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("save manifest: %w", err)
+	}
+	temp := m.path + ".tmp"
+	if err := os.WriteFile(temp, content, 0644); err != nil {
+		return fmt.Errorf("save manifest: %w", err)
+	}
+	if err := os.Rename(temp, m.path); err != nil {
+		return fmt.Errorf("save manifest: %w", err)
+	}
+	return nil
+}
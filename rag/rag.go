@@ -11,13 +11,27 @@ type ScalarDB interface {
 	Fetch(context.Context, string, *SearchOptions) (*vdb.Document, error)
 }
 
+// MetadataLibraryID 文档元数据中的知识库 ID，Index 时写入，Retrieve 时按 LibraryID 过滤
+const MetadataLibraryID = "library_id"
+
 // Options ...
 type SearchOptions struct {
-	LibraryID      int64   `json:"id"`
-	Kind           string  `json:"kind"`
-	IndexID        int32   `json:"index_id"`
-	TopK           int     `json:"top_k"`
-	ScoreThreshold float64 `json:"score_threshold"`
+	LibraryID      int64       `json:"id"`
+	Kind           string      `json:"kind"`
+	IndexID        int32       `json:"index_id"`
+	TopK           int         `json:"top_k"`
+	ScoreThreshold float64     `json:"score_threshold"`
+	Filter         *vdb.Filter `json:"filter,omitempty"` // 元数据过滤，与 LibraryID 同时生效
+
+	// 混合检索：向量与关键词两路检索，结果按 Fusion 融合后取 TopK
+	Hybrid        bool    `json:"hybrid"`
+	Fusion        Fusion  `json:"fusion"`         // 默认 FusionRRF
+	VectorTopK    int     `json:"vector_top_k"`   // 向量检索的召回数，默认 TopK
+	KeywordTopK   int     `json:"keyword_top_k"`  // 关键词检索的召回数，默认 TopK
+	VectorWeight  float64 `json:"vector_weight"`  // 向量结果的权重，默认 1
+	KeywordWeight float64 `json:"keyword_weight"` // 关键词结果的权重，默认 1
+
+	RerankTopN int `json:"rerank_top_n"` // 重排后保留的文档数，默认 Indexer.WithReranker 的 topN
 }
 
 type SearchOption func(*SearchOptions)
@@ -33,3 +47,60 @@ func WithScoreThreshold(scoreThreshold float64) SearchOption {
 		o.ScoreThreshold = scoreThreshold
 	}
 }
+
+func WithLibraryID(libraryID int64) SearchOption {
+	return func(o *SearchOptions) {
+		o.LibraryID = libraryID
+	}
+}
+
+func WithFilter(filter *vdb.Filter) SearchOption {
+	return func(o *SearchOptions) {
+		o.Filter = filter
+	}
+}
+
+// WithHybrid 混合检索，fusion 为空时为 FusionRRF。
+// 向量库不支持全文检索（未实现 vdb.KeywordSearcher）时关键词检索使用进程内的 BM25 索引，
+// 只包含本进程中经 Indexer.Index 写入的文档，进程重启或其他进程写入的文档需重新 Index
+func WithHybrid(fusion Fusion) SearchOption {
+	return func(o *SearchOptions) {
+		o.Hybrid = true
+		o.Fusion = fusion
+	}
+}
+
+// WithFusionWeights 混合检索中向量与关键词结果的权重
+func WithFusionWeights(vector, keyword float64) SearchOption {
+	return func(o *SearchOptions) {
+		o.VectorWeight = vector
+		o.KeywordWeight = keyword
+	}
+}
+
+// WithLegTopK 混合检索中向量与关键词检索各自的召回数
+func WithLegTopK(vector, keyword int) SearchOption {
+	return func(o *SearchOptions) {
+		o.VectorTopK = vector
+		o.KeywordTopK = keyword
+	}
+}
+
+// WithRerankTopN 重排后保留的文档数
+func WithRerankTopN(topN int) SearchOption {
+	return func(o *SearchOptions) {
+		o.RerankTopN = topN
+	}
+}
+
+// filter the library filter and the given filter
+func (o *SearchOptions) filter() *vdb.Filter {
+	if o.LibraryID == 0 {
+		return o.Filter
+	}
+	library := vdb.Eq(MetadataLibraryID, o.LibraryID)
+	if o.Filter == nil {
+		return library
+	}
+	return vdb.And(library, o.Filter)
+}
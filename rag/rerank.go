@@ -0,0 +1,223 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/log"
+	pkgstrings "github.com/showntop/llmack/pkg/strings"
+	"github.com/showntop/llmack/vdb"
+)
+
+// Reranker 对检索结果按与 query 的相关度重排，返回降序的文档，Similarity 为重排得分
+type Reranker interface {
+	Rerank(ctx context.Context, query string, docs []*vdb.Document) ([]*vdb.Document, error)
+}
+
+// RerankerFunc ...
+type RerankerFunc func(ctx context.Context, query string, docs []*vdb.Document) ([]*vdb.Document, error)
+
+// Rerank ...
+func (f RerankerFunc) Rerank(ctx context.Context, query string, docs []*vdb.Document) ([]*vdb.Document, error) {
+	return f(ctx, query, docs)
+}
+
+// Fallback tries the rerankers in order until one succeeds, e.g. Fallback(httpReranker, &LexicalReranker{})
+func Fallback(rerankers ...Reranker) Reranker {
+	return RerankerFunc(func(ctx context.Context, query string, docs []*vdb.Document) ([]*vdb.Document, error) {
+		errs := []error{}
+		for _, reranker := range rerankers {
+			reranked, err := reranker.Rerank(ctx, query, docs)
+			if err == nil {
+				return reranked, nil
+			}
+			log.WarnContextf(ctx, "rerank error, fallback to next reranker: %v", err)
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	})
+}
+
+// scored copies the docs with scores as Similarity, sorted by score in descending order
+func scored(docs []*vdb.Document, scores []float64) []*vdb.Document {
+	reranked := make([]*vdb.Document, len(docs))
+	for i, doc := range docs {
+		doc := *doc
+		doc.Similarity = float32(scores[i])
+		reranked[i] = &doc
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].Similarity > reranked[j].Similarity
+	})
+	return reranked
+}
+
+// LexicalReranker 按 query 词在文档中的覆盖率打分，无需模型，可作为其他 Reranker 的兜底
+type LexicalReranker struct {
+}
+
+// Rerank ...
+func (r *LexicalReranker) Rerank(_ context.Context, query string, docs []*vdb.Document) ([]*vdb.Document, error) {
+	terms := map[string]struct{}{}
+	for _, token := range pkgstrings.Tokenize(query) {
+		terms[token] = struct{}{}
+	}
+	scores := make([]float64, len(docs))
+	for i, doc := range docs {
+		if len(terms) == 0 {
+			break
+		}
+		matched := map[string]struct{}{}
+		for _, token := range pkgstrings.Tokenize(doc.Title + " " + doc.Content) {
+			if _, ok := terms[token]; ok {
+				matched[token] = struct{}{}
+			}
+		}
+		scores[i] = float64(len(matched)) / float64(len(terms))
+	}
+	return scored(docs, scores), nil
+}
+
+// LLMReranker 以模型作为评委，对每个文档与 query 的相关度打分 (0-10)，得分归一化到 [0, 1]
+type LLMReranker struct {
+	Model     *llm.Instance
+	MaxLength int // 每个文档截断的最大字符数，默认 2000
+}
+
+type rerankJudgement struct {
+	Scores []*rerankScore `json:"scores" jsonschema:"description=the relevance score of every passage"`
+}
+
+type rerankScore struct {
+	Number int     `json:"number" jsonschema:"description=the number of the passage"`
+	Score  float64 `json:"score" jsonschema:"description=the relevance of the passage to the query from 0 (irrelevant) to 10 (fully answers the query)"`
+}
+
+var rerankPrompt = `You are a relevance judge for a search engine. Score how relevant every passage is to the query,
+from 0 (irrelevant) to 10 (fully answers the query). Score every passage by its number.`
+
+// Rerank ...
+func (r *LLMReranker) Rerank(ctx context.Context, query string, docs []*vdb.Document) ([]*vdb.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+	maxLength := r.MaxLength
+	if maxLength <= 0 {
+		maxLength = 2000
+	}
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("<query>\n%s\n</query>\n", query))
+	for i, doc := range docs {
+		content := []rune(strings.TrimSpace(doc.Title + "\n" + doc.Content))
+		builder.WriteString(fmt.Sprintf("<passage number=\"%d\">\n%s\n</passage>\n", i+1, string(content[:min(len(content), maxLength)])))
+	}
+	judgement := &rerankJudgement{}
+	response, err := r.Model.Invoke(ctx, []llm.Message{
+		llm.NewSystemMessage(rerankPrompt),
+		llm.NewUserTextMessage(builder.String()),
+	}, llm.WithJSONSchema(judgement))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(llm.ExtractJSON(response.Result().Message.Content())), judgement); err != nil {
+		return nil, fmt.Errorf("rerank judgement unmarshal error: %w", err)
+	}
+	scores := make([]float64, len(docs)) // passages not scored are irrelevant
+	for _, score := range judgement.Scores {
+		if score.Number < 1 || score.Number > len(docs) {
+			return nil, fmt.Errorf("rerank judgement scored passage %d out of %d", score.Number, len(docs))
+		}
+		scores[score.Number-1] = min(max(score.Score, 0), 10) / 10
+	}
+	return scored(docs, scores), nil
+}
+
+// HTTPReranker rerank 接口的客户端，兼容 Jina、Cohere 与 BGE (TEI) 风格的接口：
+// 请求 {"model", "query", "documents"}（TEI 为 "texts"），响应 {"results": [{"index", "relevance_score"}]} 或 [{"index", "score"}]
+type HTTPReranker struct {
+	Endpoint string // e.g. https://api.jina.ai/v1/rerank
+	APIKey   string
+	Model    string
+	Client   *http.Client // 默认 http.DefaultClient
+	Texts    bool         // 以 texts 传递文档，如 TEI
+}
+
+type rerankResult struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float64 `json:"relevance_score"`
+	Score          *float64 `json:"score"`
+}
+
+// Rerank ...
+func (r *HTTPReranker) Rerank(ctx context.Context, query string, docs []*vdb.Document) ([]*vdb.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+	documents := make([]string, len(docs))
+	for i, doc := range docs {
+		documents[i] = doc.Content
+	}
+	body := map[string]any{"model": r.Model, "query": query, "documents": documents}
+	if r.Texts {
+		body = map[string]any{"query": query, "texts": documents}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request error: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank status code error: %d %s", resp.StatusCode, raw)
+	}
+
+	var results []*rerankResult
+	if err := json.Unmarshal(raw, &results); err != nil { // Jina, Cohere
+		var response struct {
+			Results []*rerankResult `json:"results"`
+		}
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return nil, fmt.Errorf("rerank response unmarshal error: %w", err)
+		}
+		results = response.Results
+	}
+	scores := make([]float64, len(docs))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(docs) {
+			return nil, fmt.Errorf("rerank result index %d out of %d", result.Index, len(docs))
+		}
+		if result.RelevanceScore != nil {
+			scores[result.Index] = *result.RelevanceScore
+		} else if result.Score != nil {
+			scores[result.Index] = *result.Score
+		}
+	}
+	return scored(docs, scores), nil
+}
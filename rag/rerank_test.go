@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/showntop/llmack/vdb"
+	"github.com/showntop/llmack/vdb/memo"
+	"github.com/stretchr/testify/assert"
+)
+
+type replyProvider string
+
+func (r replyProvider) Invoke(ctx context.Context, messages []llm.Message, opts *llm.InvokeOptions) (*llm.Response, error) {
+	response := llm.NewStreamResponse()
+	go func() {
+		defer response.Stream().Close()
+		response.Stream().Push(llm.NewChunk(0, llm.NewAssistantMessage(string(r)), &llm.Usage{}))
+	}()
+	return response, nil
+}
+
+func rerankDocs() []*vdb.Document {
+	return []*vdb.Document{
+		{ID: "1", Content: "shipping and delivery times"},
+		{ID: "2", Content: "refund policy of the store"},
+		{ID: "3", Content: "warranty of the products"},
+	}
+}
+
+func TestHTTPReranker_Rerank(t *testing.T) {
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"results":[{"index":1,"relevance_score":0.9},{"index":0,"relevance_score":0.2},{"index":2,"relevance_score":0.1}]}`))
+	}))
+	defer server.Close()
+
+	reranker := &HTTPReranker{Endpoint: server.URL, APIKey: "secret", Model: "jina-reranker-v2-base-multilingual"}
+	docs, err := reranker.Rerank(context.Background(), "refund", rerankDocs())
+	assert.NoError(t, err)
+	assert.Equal(t, "refund", request["query"])
+	assert.Len(t, request["documents"], 3)
+	assert.Equal(t, []string{"2", "1", "3"}, []string{docs[0].ID, docs[1].ID, docs[2].ID})
+	assert.InDelta(t, 0.9, docs[0].Similarity, 1e-6)
+
+	tei := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"index":2,"score":0.8},{"index":1,"score":0.5},{"index":0,"score":0.1}]`))
+	}))
+	defer tei.Close()
+	docs, err = (&HTTPReranker{Endpoint: tei.URL, Texts: true}).Rerank(context.Background(), "warranty", rerankDocs())
+	assert.NoError(t, err)
+	assert.Equal(t, "3", docs[0].ID)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	docs, err = Fallback(&HTTPReranker{Endpoint: failing.URL}, &LexicalReranker{}).Rerank(context.Background(), "store refund", rerankDocs())
+	assert.NoError(t, err)
+	assert.Equal(t, "2", docs[0].ID)
+	assert.InDelta(t, 1, docs[0].Similarity, 1e-6)
+}
+
+func TestLLMReranker_Rerank(t *testing.T) {
+	model := llm.NewInstance("scripted", llm.WithProvider(replyProvider(`{"scores":[{"number":1,"score":2},{"number":2,"score":3},{"number":3,"score":9}]}`)))
+	docs, err := (&LLMReranker{Model: model}).Rerank(context.Background(), "warranty", rerankDocs())
+	assert.NoError(t, err)
+	assert.Equal(t, "3", docs[0].ID)
+	assert.InDelta(t, 0.9, docs[0].Similarity, 1e-6)
+}
+
+func TestIndexer_RetrieveRerank(t *testing.T) {
+	ctx := context.Background()
+	indexer := newIndexer(memo.New()).WithReranker(&LexicalReranker{}, 2)
+	_, err := indexer.Index(ctx, rerankDocs(), nil)
+	assert.NoError(t, err)
+
+	docs, err := indexer.Retrieve(ctx, "warranty products", WithTopK(3))
+	assert.NoError(t, err)
+	assert.Len(t, docs, 2)
+	assert.Equal(t, "3", docs[0].ID)
+
+	docs, err = indexer.Retrieve(ctx, "warranty products", WithTopK(3), WithRerankTopN(1))
+	assert.NoError(t, err)
+	assert.Len(t, docs, 1)
+}
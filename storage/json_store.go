@@ -79,7 +79,7 @@ func (s *JSONStorage) FetchSession(ctx context.Context, id string) (*Session, er
 
 func (s *JSONStorage) UpdateSession(ctx context.Context, session *Session) error {
 	filePath := filepath.Join(s.path, session.UID+".json")
-	file, err := os.Open(filePath)
+	file, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
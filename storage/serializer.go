@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/showntop/llmack/llm"
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("messages", MessagesSerializer{})
+}
+
+// MessagesSerializer gorm serializer of []llm.Message, persisted as the json of llm.MessageRecord
+type MessagesSerializer struct{}
+
+// Scan implements serializer interface
+func (MessagesSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var raw []byte
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("failed to unmarshal messages value: %#v", dbValue)
+	}
+	var messages []llm.Message
+	if len(raw) > 0 {
+		var records []*llm.MessageRecord
+		if err := json.Unmarshal(raw, &records); err != nil {
+			return err
+		}
+		messages = llm.RestoreMessages(records)
+	}
+	return field.Set(ctx, dst, messages)
+}
+
+// Value implements serializer interface
+func (MessagesSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (any, error) {
+	messages, _ := fieldValue.([]llm.Message)
+	raw, err := json.Marshal(llm.NewMessageRecords(messages))
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/showntop/llmack/llm"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/schema"
+)
+
+func TestMessagesSerializer(t *testing.T) {
+	s, err := schema.Parse(&Session{}, &sync.Map{}, schema.NamingStrategy{})
+	assert.NoError(t, err)
+	field := s.LookUpField("messages")
+
+	assistant := llm.NewAssistantMessage("")
+	assistant.ToolCalls = []*llm.ToolCall{{ID: "call_1", Type: "function", Function: llm.ToolCallFunction{Name: "search", Arguments: `{"q":"go"}`}}}
+	session := &Session{UID: "s1", Messages: []llm.Message{
+		llm.NewUserTextMessage("search go"),
+		assistant,
+		llm.NewToolMessage("found", "call_1"),
+	}}
+	value, err := field.Serializer.Value(context.Background(), field, reflect.ValueOf(session).Elem(), session.Messages)
+	assert.NoError(t, err)
+
+	restored := &Session{}
+	assert.NoError(t, field.Serializer.Scan(context.Background(), field, reflect.ValueOf(restored).Elem(), []byte(value.(string))))
+	assert.Len(t, restored.Messages, 3)
+	assert.Equal(t, "search go", restored.Messages[0].Content())
+	assert.Equal(t, "search", restored.Messages[1].GetToolCalls()[0].Function.Name)
+	assert.Equal(t, "call_1", restored.Messages[2].ToolID())
+	assert.Equal(t, llm.MessageRoleTool, restored.Messages[2].Role())
+}
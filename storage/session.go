@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/showntop/llmack/llm"
@@ -14,16 +15,39 @@ type Session struct {
 	EngineType string         `json:"engine_type" gorm:"column:engine_type;type:varchar(255);"` // engine type
 	EngineData map[string]any `json:"engine_data" gorm:"column:engine_data;type:jsonb"`         // engine data
 
-	Memory memory.Memory `json:"memory"` // 记忆
+	Memory memory.Memory `json:"memory" gorm:"-"` // 记忆
 
-	Messages []llm.Message `json:"messages"`
+	Messages []llm.Message `json:"messages" gorm:"column:messages;type:jsonb;serializer:messages"` // 见 MessagesSerializer
 
-	Data any `json:"data"`
+	Data any `json:"data" gorm:"column:data;type:jsonb;serializer:json"`
 
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
 }
 
+type sessionAlias Session
+
+// MarshalJSON messages are persisted as llm.MessageRecord
+func (s Session) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		*sessionAlias
+		Messages []*llm.MessageRecord `json:"messages"`
+	}{(*sessionAlias)(&s), llm.NewMessageRecords(s.Messages)})
+}
+
+// UnmarshalJSON ...
+func (s *Session) UnmarshalJSON(data []byte) error {
+	aux := &struct {
+		*sessionAlias
+		Messages []*llm.MessageRecord `json:"messages"`
+	}{sessionAlias: (*sessionAlias)(s)}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	s.Messages = llm.RestoreMessages(aux.Messages)
+	return nil
+}
+
 func NewSession(id string) *Session {
 	return &Session{
 		UID: id,
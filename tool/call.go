@@ -0,0 +1,126 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Lookup returns the registered tool
+func Lookup(name string) (*Tool, bool) {
+	t := defaultFactory.Spawn(name)
+	return t, t != nil
+}
+
+// Names of the registered tools
+func Names() []string {
+	registerLock.RLock()
+	defer registerLock.RUnlock()
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Call invokes the registered tool by name, arguments are validated against its parameters before invoke.
+// Unknown tool, invalid arguments, timeout and panic are returned as *Error, timeout of the tool
+// takes precedence over timeout, 0 means no timeout.
+func Call(ctx context.Context, name string, args string, timeout time.Duration) (string, error) {
+	t, ok := Lookup(name)
+	if !ok {
+		return "", NewError(name, ErrorUnknownTool,
+			fmt.Errorf("tool %s not found, available tools: %s", name, strings.Join(Names(), ", ")))
+	}
+	if err := t.Validate(args); err != nil {
+		return "", NewError(name, ErrorInvalidArguments, err)
+	}
+	if t.Timeout > 0 {
+		timeout = t.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		result string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: NewError(name, ErrorPanic, &PanicError{Tool: name, Value: r, Stack: debug.Stack()})}
+			}
+		}()
+		if t.Kind != "api" && t.invoke == nil {
+			panic("invoke function not set")
+		}
+		result, err := t.Invoke(ctx, args)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", NewError(name, ErrorTimeout, fmt.Errorf("tool %s timed out after %s", name, timeout))
+			}
+			return "", AsError(name, o.err)
+		}
+		return o.result, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", NewError(name, ErrorTimeout, fmt.Errorf("tool %s timed out after %s", name, timeout))
+		}
+		return "", NewError(name, ErrorExecution, ctx.Err())
+	}
+}
+
+// Validate validates the json arguments against the parameters of tool
+func (t *Tool) Validate(args string) error {
+	schema := t.ParamsOneOf.schema()
+	if schema == nil {
+		return nil
+	}
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+	var value any
+	if err := json.Unmarshal([]byte(args), &value); err != nil {
+		return fmt.Errorf("arguments are not valid json: %w", err)
+	}
+	if err := schema.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		return errors.New(strings.Join(validationReasons(err), "; "))
+	}
+	return nil
+}
+
+// validationReasons flattens the schema errors without the schema and value dumped by SchemaError.Error
+func validationReasons(err error) []string {
+	if errs, ok := err.(openapi3.MultiError); ok {
+		reasons := []string{}
+		for _, err := range errs {
+			reasons = append(reasons, validationReasons(err)...)
+		}
+		return reasons
+	}
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		return []string{err.Error()}
+	}
+	if path := strings.Join(schemaErr.JSONPointer(), "."); path != "" {
+		return []string{path + ": " + schemaErr.Reason}
+	}
+	return []string{schemaErr.Reason}
+}
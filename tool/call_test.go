@@ -0,0 +1,61 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCall(t *testing.T) {
+	Register(New(
+		WithName("call_test_weather"),
+		WithParameters(Parameter{Name: "city", Type: String, Required: true}, Parameter{Name: "days", Type: Number}),
+		WithFunction(func(ctx context.Context, args string) (string, error) {
+			return "sunny", nil
+		}),
+	))
+	Register(New(
+		WithName("call_test_slow"),
+		WithTimeout(10*time.Millisecond),
+		WithFunction(func(ctx context.Context, args string) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}),
+	))
+	Register(New(
+		WithName("call_test_panic"),
+		WithFunction(func(ctx context.Context, args string) (string, error) {
+			panic("boom")
+		}),
+	))
+	ctx := context.Background()
+
+	result, err := Call(ctx, "call_test_weather", `{"city":"Beijing","days":3}`, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "sunny", result)
+
+	_, err = Call(ctx, "call_test_wether", `{}`, 0)
+	assert.Equal(t, ErrorUnknownTool, AsError("call_test_wether", err).Kind)
+	assert.Contains(t, err.Error(), "call_test_weather")
+
+	_, err = Call(ctx, "call_test_weather", `{"days":"3"}`, 0)
+	te := AsError("call_test_weather", err)
+	assert.Equal(t, ErrorInvalidArguments, te.Kind)
+	assert.Contains(t, te.Message, "city")
+	assert.Contains(t, te.Message, "days")
+	var fed map[string]map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(te.Result()), &fed))
+	assert.Equal(t, "invalid_arguments", fed["error"]["type"])
+
+	_, err = Call(ctx, "call_test_slow", `{}`, time.Hour)
+	assert.Equal(t, ErrorTimeout, AsError("call_test_slow", err).Kind)
+
+	_, err = Call(ctx, "call_test_panic", `{}`, 0)
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "boom", panicErr.Value)
+}
@@ -61,3 +61,39 @@ func (p *ParamsOneOf) Parameters() any {
 	}
 	return p.params2
 }
+
+// schema of the parameters to validate arguments
+func (p *ParamsOneOf) schema() *openapi3.Schema {
+	if p == nil {
+		return nil
+	}
+	if len(p.params1) <= 0 {
+		return p.params2
+	}
+	schema := openapi3.NewObjectSchema()
+	for _, param := range p.params1 {
+		var property *openapi3.Schema
+		switch param.Type {
+		case Number:
+			property = openapi3.NewFloat64Schema()
+		case Boolean:
+			property = openapi3.NewBoolSchema()
+		case Array:
+			property = openapi3.NewArraySchema()
+		case Select:
+			property = openapi3.NewStringSchema()
+			for _, option := range param.Options {
+				property.Enum = append(property.Enum, option)
+			}
+		case String, SecretInput, File:
+			property = openapi3.NewStringSchema()
+		default:
+			property = &openapi3.Schema{Type: string(param.Type)}
+		}
+		schema.WithProperty(param.Name, property)
+		if param.Required {
+			schema.Required = append(schema.Required, param.Name)
+		}
+	}
+	return schema
+}
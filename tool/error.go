@@ -0,0 +1,65 @@
+package tool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrorKind 工具调用错误类型
+type ErrorKind string
+
+const (
+	ErrorUnknownTool      ErrorKind = "unknown_tool"
+	ErrorInvalidArguments ErrorKind = "invalid_arguments"
+	ErrorTimeout          ErrorKind = "timeout"
+	ErrorPanic            ErrorKind = "panic"
+	ErrorExecution        ErrorKind = "execution_error"
+)
+
+// Error 结构化的工具调用错误，Result 作为工具结果返回给模型以便自我纠正
+type Error struct {
+	Tool    string    `json:"tool"`
+	Kind    ErrorKind `json:"type"`
+	Message string    `json:"message"`
+	err     error
+}
+
+// NewError ...
+func NewError(name string, kind ErrorKind, err error) *Error {
+	return &Error{Tool: name, Kind: kind, Message: err.Error(), err: err}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("tool %s %s: %s", e.Tool, e.Kind, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Result the error as tool result in json
+func (e *Error) Result() string {
+	raw, _ := json.Marshal(map[string]any{"error": e})
+	return string(raw)
+}
+
+// AsError returns err as *Error, wrapped as ErrorExecution if not
+func AsError(name string, err error) *Error {
+	var te *Error
+	if errors.As(err, &te) {
+		return te
+	}
+	return NewError(name, ErrorExecution, err)
+}
+
+// PanicError the tool panicked while invoking
+type PanicError struct {
+	Tool  string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("tool %s panic: %v", e.Tool, e.Value)
+}
@@ -14,6 +14,7 @@ func init() {
 	t := tool.New(
 		tool.WithName(CreateFile),
 		tool.WithKind("code"),
+		tool.WithRequireApproval(true),
 		tool.WithDescription("创建文件"),
 		tool.WithParameters(tool.Parameter{
 			Name:          "path",
@@ -14,6 +14,7 @@ func init() {
 	t := tool.New(
 		tool.WithName(WriteFile),
 		tool.WithKind("code"),
+		tool.WithRequireApproval(true),
 		tool.WithDescription("Writes text to a file"),
 		tool.WithParameters(
 			tool.Parameter{
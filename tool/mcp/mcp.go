@@ -90,6 +90,7 @@ func init() {
 	// Register the MCP tool invocation tool
 	invokeTool := tool.New(
 		tool.WithName("mcp_invoke"),
+		tool.WithRequireApproval(true),
 		tool.WithDescription("Invoke a tool on a connected MCP server"),
 		tool.WithParameters(
 			tool.Parameter{
@@ -185,6 +186,7 @@ func handleConnect(params map[string]interface{}) (string, error) {
 			toolName := fmt.Sprintf("mcp_%s_%s", serverName, mcpTool.Name)
 			dynamicTool := tool.New(
 				tool.WithName(toolName),
+				tool.WithRequireApproval(true),
 				tool.WithDescription(fmt.Sprintf("[MCP:%s] %s", serverName, mcpTool.Description)),
 				tool.WithParameters(
 					tool.Parameter{
@@ -248,6 +250,7 @@ func handleConnect(params map[string]interface{}) (string, error) {
 			toolName := fmt.Sprintf("mcp_%s_%s", serverName, mcpTool.Name)
 			dynamicTool := tool.New(
 				tool.WithName(toolName),
+				tool.WithRequireApproval(true),
 				tool.WithDescription(fmt.Sprintf("[MCP:%s] %s", serverName, mcpTool.Description)),
 				tool.WithParameters(
 					tool.Parameter{
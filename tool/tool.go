@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/flosch/pongo2/v6"
 	"github.com/getkin/kin-openapi/openapi3"
@@ -33,6 +34,9 @@ type Tool struct {
 	Method              string `json:"method"`     // 方法
 	Body                string `json:"body"`       // body
 
+	RequireApproval bool          `json:"require_approval"` // 有副作用的工具，配置审批策略时需人工审批后执行
+	Timeout         time.Duration `json:"timeout"`          // 调用超时，见 Call
+
 	invoke InvokeFunc
 }
 
@@ -97,6 +101,20 @@ func WithParameters(parameters ...any) Option {
 	}
 }
 
+// WithRequireApproval marks the tool to be approved before invoke, see program.ApprovalPolicy
+func WithRequireApproval(require bool) Option {
+	return func(t *Tool) {
+		t.RequireApproval = require
+	}
+}
+
+// WithTimeout ...
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *Tool) {
+		t.Timeout = timeout
+	}
+}
+
 func WithFunction(function func(ctx context.Context, args string) (string, error)) Option {
 	return func(t *Tool) {
 		t.invoke = function
@@ -0,0 +1,186 @@
+package vdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// FilterOp 过滤操作
+type FilterOp string
+
+const (
+	FilterEq    FilterOp = "eq"
+	FilterIn    FilterOp = "in"
+	FilterRange FilterOp = "range"
+	FilterAnd   FilterOp = "and"
+	FilterOr    FilterOp = "or"
+)
+
+// Filter 元数据过滤表达式，与后端无关，Key 为 Document.Metadata 的键。
+// 各后端原生翻译：pgvector 为 JSONB 条件，milvus 为 boolean expr，redis 为 FT tag/numeric 过滤，memo 在进程内求值。
+// 范围过滤的值为数值，time.Time 按 unix 秒比较，日期需以 unix 秒存储在元数据中。
+type Filter struct {
+	Op      FilterOp  `json:"op"`
+	Key     string    `json:"key,omitempty"`
+	Value   any       `json:"value,omitempty"`   // eq
+	Values  []any     `json:"values,omitempty"`  // in
+	Min     any       `json:"min,omitempty"`     // range, inclusive, nil is unbounded
+	Max     any       `json:"max,omitempty"`     // range, inclusive, nil is unbounded
+	Filters []*Filter `json:"filters,omitempty"` // and, or
+}
+
+// Eq metadata[key] == value
+func Eq(key string, value any) *Filter {
+	return &Filter{Op: FilterEq, Key: key, Value: value}
+}
+
+// In metadata[key] is one of values
+func In(key string, values ...any) *Filter {
+	return &Filter{Op: FilterIn, Key: key, Values: values}
+}
+
+// Range min <= metadata[key] <= max, nil bound is unbounded
+func Range(key string, min, max any) *Filter {
+	return &Filter{Op: FilterRange, Key: key, Min: min, Max: max}
+}
+
+// And all filters match, nil filters are ignored, an empty And matches everything
+func And(filters ...*Filter) *Filter {
+	return &Filter{Op: FilterAnd, Filters: compact(filters)}
+}
+
+// Or any filter matches, nil filters are ignored, an empty Or matches nothing
+func Or(filters ...*Filter) *Filter {
+	return &Filter{Op: FilterOr, Filters: compact(filters)}
+}
+
+func compact(filters []*Filter) []*Filter {
+	compacted := []*Filter{}
+	for _, filter := range filters {
+		if filter != nil {
+			compacted = append(compacted, filter)
+		}
+	}
+	return compacted
+}
+
+// Validate ...
+func (f *Filter) Validate() error {
+	switch f.Op {
+	case FilterEq, FilterIn:
+		if f.Key == "" {
+			return fmt.Errorf("filter %s requires key", f.Op)
+		}
+	case FilterRange:
+		if f.Key == "" {
+			return fmt.Errorf("filter %s requires key", f.Op)
+		}
+		for _, bound := range []any{f.Min, f.Max} {
+			if _, ok := Number(bound); bound != nil && !ok {
+				return fmt.Errorf("filter range bound of %s must be a number or time, got %T", f.Key, bound)
+			}
+		}
+	case FilterAnd, FilterOr:
+		for _, filter := range f.Filters {
+			if err := filter.Validate(); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown filter op %q", f.Op)
+	}
+	return nil
+}
+
+// Match evaluates the filter on metadata, used by backends without native filtering
+func (f *Filter) Match(metadata map[string]any) bool {
+	switch f.Op {
+	case FilterEq:
+		value, ok := metadata[f.Key]
+		return ok && equal(value, f.Value)
+	case FilterIn:
+		value, ok := metadata[f.Key]
+		if !ok {
+			return false
+		}
+		for _, v := range f.Values {
+			if equal(value, v) {
+				return true
+			}
+		}
+		return false
+	case FilterRange:
+		value, ok := Number(metadata[f.Key])
+		if !ok {
+			return false
+		}
+		if min, ok := Number(f.Min); ok && value < min {
+			return false
+		}
+		if max, ok := Number(f.Max); ok && value > max {
+			return false
+		}
+		return true
+	case FilterAnd:
+		for _, filter := range f.Filters {
+			if !filter.Match(metadata) {
+				return false
+			}
+		}
+		return true
+	case FilterOr:
+		for _, filter := range f.Filters {
+			if filter.Match(metadata) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// equal compares numbers by value, e.g. int64 stored and float64 decoded from json
+func equal(a, b any) bool {
+	if x, ok := Number(a); ok {
+		y, ok := Number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Number converts numeric value to float64, time.Time to unix seconds
+func Number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case time.Time:
+		return float64(v.Unix()), true
+	}
+	return 0, false
+}
+
+// FormatNumber formats the number of value for filter expressions
+func FormatNumber(value any) string {
+	n, _ := Number(value)
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,34 @@
+package vdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Match(t *testing.T) {
+	published := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	metadata := map[string]any{
+		"tenant":       "acme",
+		"library_id":   float64(1), // decoded from json
+		"published_at": published.Unix(),
+	}
+
+	assert.True(t, Eq("tenant", "acme").Match(metadata))
+	assert.True(t, Eq("library_id", int64(1)).Match(metadata))
+	assert.False(t, Eq("missing", "acme").Match(metadata))
+	assert.True(t, In("tenant", "other", "acme").Match(metadata))
+	assert.False(t, In("tenant", "other").Match(metadata))
+	assert.True(t, Range("published_at", published.AddDate(0, 0, -1), nil).Match(metadata))
+	assert.False(t, Range("published_at", nil, published.AddDate(0, 0, -1)).Match(metadata))
+	assert.True(t, And(Eq("tenant", "acme"), nil, In("library_id", 1, 2)).Match(metadata))
+	assert.False(t, And(Eq("tenant", "acme"), Eq("library_id", 2)).Match(metadata))
+	assert.True(t, Or(Eq("tenant", "other"), Eq("library_id", 1)).Match(metadata))
+	assert.True(t, And().Match(metadata))
+	assert.False(t, Or(nil).Match(metadata))
+
+	assert.Error(t, Eq("", "acme").Validate())
+	assert.Error(t, Range("published_at", "yesterday", nil).Validate())
+	assert.Error(t, And(&Filter{Op: "like", Key: "tenant"}).Validate())
+}
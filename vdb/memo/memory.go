@@ -20,13 +20,14 @@ type VDB struct {
 }
 
 type document struct {
-	ID        string
-	Vector    []float32
-	Title     string
-	Content   string
-	Metadata  map[string]any
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          string
+	Vector      []float32
+	Title       string
+	Content     string
+	ContentHash string
+	Metadata    map[string]any
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
 
 // New 创建新的内存向量存储实例
@@ -48,18 +49,22 @@ func (m *VDB) Store(ctx context.Context, docs ...*vdb.Document) error {
 
 	// 创建副本以避免外部修改
 	for _, doc := range docs {
-		embedding, err := m.embedder.Embed(ctx, doc.Content)
-		if err != nil {
-			return err
+		embedding := doc.Embedding.Slice() // use the given embedding if any
+		if len(embedding) == 0 {
+			var err error
+			if embedding, err = m.embedder.Embed(ctx, doc.Content); err != nil {
+				return err
+			}
 		}
 		m.vectors[doc.ID] = document{
-			ID:        doc.ID,
-			Vector:    embedding,
-			Title:     doc.Title,
-			Content:   doc.Content,
-			Metadata:  doc.Metadata,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			ID:          doc.ID,
+			Vector:      embedding,
+			Title:       doc.Title,
+			Content:     doc.Content,
+			ContentHash: doc.ContentHash,
+			Metadata:    doc.Metadata,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
 		}
 	}
 	return nil
@@ -87,25 +92,34 @@ func (m *VDB) SearchQueryWithOptions(ctx context.Context, query string, options
 }
 
 func (m *VDB) SearchWithOptions(ctx context.Context, vector []float32, options *vdb.SearchOptions) ([]*vdb.Document, error) {
+	if options.Filter != nil {
+		if err := options.Filter.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	// 计算所有向量的相似度
 	documents := make([]*vdb.Document, 0, len(m.vectors))
 	for _, v := range m.vectors {
+		if options.Filter != nil && !options.Filter.Match(v.Metadata) {
+			continue
+		}
 		if len(v.Vector) != len(vector) {
 			return nil, fmt.Errorf("vector dimension mismatch")
 		}
 
 		similarity := cosineSimilarity(vector, v.Vector)
 		documents = append(documents, &vdb.Document{
-			ID:         v.ID,
-			Title:      v.Title,
-			Content:    v.Content,
-			Metadata:   v.Metadata,
-			CreatedAt:  v.CreatedAt,
-			UpdatedAt:  v.UpdatedAt,
-			Similarity: similarity,
+			ID:          v.ID,
+			Title:       v.Title,
+			Content:     v.Content,
+			ContentHash: v.ContentHash,
+			Metadata:    v.Metadata,
+			CreatedAt:   v.CreatedAt,
+			UpdatedAt:   v.UpdatedAt,
+			Similarity:  similarity,
 		})
 	}
 
@@ -140,6 +154,17 @@ func (m *VDB) Delete(_ context.Context, id string) error {
 	return nil
 }
 
+// DeleteBatch 批量删除向量
+func (m *VDB) DeleteBatch(_ context.Context, ids []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, id := range ids {
+		delete(m.vectors, id)
+	}
+	return nil
+}
+
 // Close 关闭并清理资源
 func (m *VDB) Close() error {
 	return nil
@@ -0,0 +1,26 @@
+package memo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/showntop/llmack/vdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVDB_SearchFilter(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	assert.NoError(t, db.Store(ctx,
+		&vdb.Document{ID: "1", Content: "refund policy", Metadata: map[string]any{"tenant": "acme"}},
+		&vdb.Document{ID: "2", Content: "refund policy", Metadata: map[string]any{"tenant": "other"}},
+	))
+
+	docs, err := db.SearchQuery(ctx, "refund policy", vdb.WithFilter(vdb.Eq("tenant", "acme")))
+	assert.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.Equal(t, "1", docs[0].ID)
+
+	_, err = db.SearchQuery(ctx, "refund policy", vdb.WithFilter(vdb.Eq("", "acme")))
+	assert.Error(t, err)
+}
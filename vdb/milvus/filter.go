@@ -0,0 +1,99 @@
+package milvus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/showntop/llmack/vdb"
+)
+
+// expr translates filter to the boolean expression on the json metadata field
+func expr(filter *vdb.Filter) (string, error) {
+	if filter == nil {
+		return "", nil
+	}
+	if err := filter.Validate(); err != nil {
+		return "", err
+	}
+	return translate(filter)
+}
+
+func translate(filter *vdb.Filter) (string, error) {
+	field := func() (string, error) {
+		key, err := json.Marshal(filter.Key)
+		return fmt.Sprintf("metadata[%s]", key), err
+	}
+	switch filter.Op {
+	case vdb.FilterEq:
+		key, err := field()
+		if err != nil {
+			return "", err
+		}
+		value, err := literal(filter.Value)
+		return fmt.Sprintf("%s == %s", key, value), err
+	case vdb.FilterIn:
+		key, err := field()
+		if err != nil {
+			return "", err
+		}
+		values := []string{}
+		for _, v := range filter.Values {
+			value, err := literal(v)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return fmt.Sprintf("%s in [%s]", key, strings.Join(values, ", ")), nil
+	case vdb.FilterRange:
+		key, err := field()
+		if err != nil {
+			return "", err
+		}
+		conditions := []string{}
+		if filter.Min != nil {
+			conditions = append(conditions, fmt.Sprintf("%s >= %s", key, vdb.FormatNumber(filter.Min)))
+		}
+		if filter.Max != nil {
+			conditions = append(conditions, fmt.Sprintf("%s <= %s", key, vdb.FormatNumber(filter.Max)))
+		}
+		if len(conditions) == 0 {
+			return fmt.Sprintf("exists %s", key), nil
+		}
+		return "(" + strings.Join(conditions, " && ") + ")", nil
+	default: // and, or
+		if len(filter.Filters) == 0 {
+			if filter.Op == vdb.FilterAnd {
+				return "true", nil
+			}
+			return "false", nil
+		}
+		operator := " && "
+		if filter.Op == vdb.FilterOr {
+			operator = " || "
+		}
+		conditions := []string{}
+		for _, f := range filter.Filters {
+			condition, err := translate(f)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, condition)
+		}
+		return "(" + strings.Join(conditions, operator) + ")", nil
+	}
+}
+
+// literal formats value as a literal of expression, strings are quoted as json
+func literal(value any) (string, error) {
+	if _, ok := vdb.Number(value); ok {
+		return vdb.FormatNumber(value), nil
+	}
+	switch value.(type) {
+	case string, bool:
+		raw, err := json.Marshal(value)
+		return string(raw), err
+	}
+	return "", fmt.Errorf("unsupported filter value %T", value)
+}
@@ -0,0 +1,43 @@
+package milvus
+
+import (
+	"testing"
+
+	"github.com/showntop/llmack/vdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpr(t *testing.T) {
+	condition, err := expr(vdb.And(
+		vdb.Eq("tenant", `acme "corp"`),
+		vdb.Or(vdb.In("page", 1, 2), vdb.Range("published_at", 100, 200)),
+		vdb.Range("score", nil, nil),
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, `(metadata["tenant"] == "acme \"corp\"" && (metadata["page"] in [1, 2] || (metadata["published_at"] >= 100 && metadata["published_at"] <= 200)) && exists metadata["score"])`, condition)
+
+	condition, err = expr(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, condition)
+
+	condition, err = expr(vdb.Or())
+	assert.NoError(t, err)
+	assert.Equal(t, "false", condition)
+
+	_, err = expr(vdb.Eq("tenant", []string{"acme"}))
+	assert.Error(t, err)
+}
+
+// TestEmpty 空 And 匹配全部、空 Or 不匹配，与 memo 的 Match 保持一致
+func TestEmpty(t *testing.T) {
+	metadata := map[string]any{"tenant": "acme"}
+	for _, filter := range []*vdb.Filter{vdb.And(), vdb.And(nil), vdb.Or(), vdb.Or(nil)} {
+		condition, err := expr(filter)
+		assert.NoError(t, err)
+		want := "true"
+		if !filter.Match(metadata) {
+			want = "false"
+		}
+		assert.Equal(t, want, condition, filter.Op)
+	}
+}
@@ -166,7 +166,9 @@ func (m *MilvusVDB) Store(ctx context.Context, docs ...*vdb.Document) error {
 		titles[i] = doc.Title
 		contents[i] = doc.Content
 		hashes[i] = doc.ContentHash
-		vectors[i], _ = m.config.Embedder.Embed(ctx, doc.Content)
+		if vectors[i] = doc.Embedding.Slice(); len(vectors[i]) == 0 { // use the given embedding if any
+			vectors[i], _ = m.config.Embedder.Embed(ctx, doc.Content)
+		}
 		metadataBytes, _ := json.Marshal(doc.Metadata)
 		metadatas[i] = (metadataBytes)
 		createdAts[i] = doc.CreatedAt.Unix()
@@ -194,13 +196,17 @@ func (m *MilvusVDB) Store(ctx context.Context, docs ...*vdb.Document) error {
 func (m *MilvusVDB) SearchWithOptions(ctx context.Context, vector []float32, opts *vdb.SearchOptions) ([]*vdb.Document, error) {
 	// 创建搜索参数
 	sp, _ := entity.NewIndexFlatSearchParam()
+	filter, err := expr(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
 
 	// 执行搜索
 	results, err := m.client.Search(
 		ctx,
 		m.config.CollectionName,
 		[]string{},
-		"",
+		filter,
 		[]string{"id", "title", "content", "content_hash", "metadata", "created_at", "updated_at"},
 		// []string{"*"},
 		[]entity.Vector{entity.FloatVector(vector)},
@@ -290,8 +296,16 @@ func (m *MilvusVDB) SearchQueryWithOptions(ctx context.Context, query string, op
 
 // Delete 删除文档
 func (m *MilvusVDB) Delete(ctx context.Context, id string) error {
-	expr := fmt.Sprintf("id == '%s'", id)
-	return m.client.Delete(ctx, m.config.CollectionName, expr, "")
+	return m.DeleteBatch(ctx, []string{id})
+}
+
+// DeleteBatch 批量删除文档
+func (m *MilvusVDB) DeleteBatch(ctx context.Context, ids []string) error {
+	literals, err := json.Marshal(ids) // quoted and escaped as the list of expr
+	if err != nil {
+		return err
+	}
+	return m.client.Delete(ctx, m.config.CollectionName, "", fmt.Sprintf("id in %s", literals))
 }
 
 // Close 关闭客户端连接
@@ -299,6 +313,11 @@ func (m *MilvusVDB) Close() error {
 	return m.client.Close()
 }
 
+// DistanceScore the score of L2 is a distance, of COSINE is a similarity
+func (m *MilvusVDB) DistanceScore() bool {
+	return metricsType(m.config.Distance) == entity.L2
+}
+
 func metricsType(distance vdb.Distance) entity.MetricType {
 	metricsType := entity.L2
 	if distance == vdb.DistanceCosine {
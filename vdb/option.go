@@ -7,6 +7,7 @@ type SearchOption func(*SearchOptions)
 type SearchOptions struct {
 	TopK      int     // 返回结果数量限制
 	Threshold float64 // 相似度阈值
+	Filter    *Filter // 元数据过滤
 }
 
 // WithTopk 设置返回结果数量
@@ -22,3 +23,10 @@ func WithThreshold(threshold float64) SearchOption {
 		o.Threshold = threshold
 	}
 }
+
+// WithFilter 设置元数据过滤
+func WithFilter(filter *Filter) SearchOption {
+	return func(o *SearchOptions) {
+		o.Filter = filter
+	}
+}
@@ -0,0 +1,83 @@
+package pgvector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/showntop/llmack/vdb"
+)
+
+// where translates filter to the condition on the jsonb metadata column, the values are appended to args as parameters
+func where(filter *vdb.Filter, args []any) (string, []any, error) {
+	if filter == nil {
+		return "TRUE", args, nil
+	}
+	if err := filter.Validate(); err != nil {
+		return "", nil, err
+	}
+	param := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	jsonParam := func(value any) (string, error) {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("marshal filter value: %w", err)
+		}
+		return param(string(raw)) + "::jsonb", nil
+	}
+	switch filter.Op {
+	case vdb.FilterEq:
+		key := param(filter.Key)
+		value, err := jsonParam(filter.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("metadata->%s = %s", key, value), args, nil
+	case vdb.FilterIn:
+		if len(filter.Values) == 0 {
+			return "FALSE", args, nil
+		}
+		key := param(filter.Key)
+		values := []string{}
+		for _, v := range filter.Values {
+			value, err := jsonParam(v)
+			if err != nil {
+				return "", nil, err
+			}
+			values = append(values, value)
+		}
+		return fmt.Sprintf("metadata->%s IN (%s)", key, strings.Join(values, ", ")), args, nil
+	case vdb.FilterRange:
+		if filter.Min == nil && filter.Max == nil {
+			return fmt.Sprintf("metadata ? %s", param(filter.Key)), args, nil
+		}
+		field := fmt.Sprintf("(metadata->>%s)::double precision", param(filter.Key))
+		conditions := []string{}
+		if min, ok := vdb.Number(filter.Min); ok {
+			conditions = append(conditions, fmt.Sprintf("%s >= %s", field, param(min)))
+		}
+		if max, ok := vdb.Number(filter.Max); ok {
+			conditions = append(conditions, fmt.Sprintf("%s <= %s", field, param(max)))
+		}
+		return "(" + strings.Join(conditions, " AND ") + ")", args, nil
+	default: // and, or
+		if len(filter.Filters) == 0 {
+			if filter.Op == vdb.FilterAnd {
+				return "TRUE", args, nil
+			}
+			return "FALSE", args, nil
+		}
+		conditions := []string{}
+		for _, f := range filter.Filters {
+			var condition string
+			var err error
+			if condition, args, err = where(f, args); err != nil {
+				return "", nil, err
+			}
+			conditions = append(conditions, condition)
+		}
+		return "(" + strings.Join(conditions, " "+strings.ToUpper(string(filter.Op))+" ") + ")", args, nil
+	}
+}
@@ -0,0 +1,37 @@
+package pgvector
+
+import (
+	"testing"
+
+	"github.com/showntop/llmack/vdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhere(t *testing.T) {
+	condition, args, err := where(vdb.And(
+		vdb.Eq("tenant", "acme"),
+		vdb.Or(vdb.In("doc_id", "a", "b"), vdb.Range("published_at", 100, nil)),
+	), []any{"vector"})
+	assert.NoError(t, err)
+	assert.Equal(t, "(metadata->$2 = $3::jsonb AND (metadata->$4 IN ($5::jsonb, $6::jsonb) OR ((metadata->>$7)::double precision >= $8)))", condition)
+	assert.Equal(t, []any{"vector", "tenant", `"acme"`, "doc_id", `"a"`, `"b"`, "published_at", float64(100)}, args)
+
+	condition, args, err = where(nil, []any{"vector"})
+	assert.NoError(t, err)
+	assert.Equal(t, "TRUE", condition)
+	assert.Len(t, args, 1)
+}
+
+// TestEmpty 空 And 匹配全部、空 Or 不匹配，与 memo 的 Match 保持一致
+func TestEmpty(t *testing.T) {
+	metadata := map[string]any{"tenant": "acme"}
+	for _, filter := range []*vdb.Filter{vdb.And(), vdb.And(nil), vdb.Or(), vdb.Or(nil)} {
+		condition, _, err := where(filter, nil)
+		assert.NoError(t, err)
+		want := "TRUE"
+		if !filter.Match(metadata) {
+			want = "FALSE"
+		}
+		assert.Equal(t, want, condition, filter.Op)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/showntop/llmack/embedding"
+	pkgstrings "github.com/showntop/llmack/pkg/strings"
 	"github.com/showntop/llmack/vdb"
 
 	"github.com/jackc/pgx/v5"
@@ -87,12 +88,24 @@ func (v *VectorDB) Create(ctx context.Context) error {
 		"source_id varchar(1024)", // document source id
 		"created_at timestamp with time zone default now()", // document created at
 		"updated_at timestamp with time zone default now()", // document updated at
+		"keywords tsvector", // tokenized content for full-text search
 	}
 	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", v.config.Table, strings.Join(columns, ", "))
 	_, err := v.db.Exec(ctx, query)
 	if err != nil {
 		return fmt.Errorf("create table: %w", err)
 	}
+	// tables created before full-text search
+	query = fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS keywords tsvector", v.config.Table)
+	_, err = v.db.Exec(ctx, query)
+	if err != nil {
+		return fmt.Errorf("add keywords column: %w", err)
+	}
+	query = fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_keywords ON %s USING gin (keywords)", v.config.Table, v.config.Table)
+	_, err = v.db.Exec(ctx, query)
+	if err != nil {
+		return fmt.Errorf("create keywords index: %w", err)
+	}
 	// create unique index
 	query = fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_source_id ON %s (source_id)", v.config.Table)
 	_, err = v.db.Exec(ctx, query)
@@ -124,21 +137,31 @@ func (v *VectorDB) Create(ctx context.Context) error {
 }
 
 func (v *VectorDB) Store(ctx context.Context, docs ...*vdb.Document) error {
-	columns := []string{"source_id", "title", "content", "content_hash", "embedding", "metadata"}
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (source_id) DO UPDATE SET title = $2, content = $3, content_hash = $4, embedding = $5, metadata = $6",
+	// keywords are tokenized before to_tsvector, as the simple configuration does not segment CJK text
+	columns := []string{"source_id", "title", "content", "content_hash", "embedding", "metadata", "keywords"}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6, to_tsvector('simple', $7)) ON CONFLICT (source_id) DO UPDATE SET title = $2, content = $3, content_hash = $4, embedding = $5, metadata = $6, keywords = to_tsvector('simple', $7)",
 		v.config.Table, strings.Join(columns, ", "))
 
 	// 100 batch insert into table
 	batch := &pgx.Batch{}
 	for _, doc := range docs {
-		contentHash := fmt.Sprintf("%x", md5.Sum([]byte(doc.Content)))
-		embedding, err := v.config.Embedder.Embed(ctx, doc.Content)
-		if err != nil {
-			return fmt.Errorf("embed: %w", err)
+		contentHash := doc.ContentHash // e.g. the sha256 of rag.Ingester
+		if contentHash == "" {
+			contentHash = fmt.Sprintf("%x", md5.Sum([]byte(doc.Content)))
+		}
+		embedding := doc.Embedding.Slice() // use the given embedding if any
+		if len(embedding) == 0 {
+			var err error
+			if embedding, err = v.config.Embedder.Embed(ctx, doc.Content); err != nil {
+				return fmt.Errorf("embed: %w", err)
+			}
+		}
+		metadata := doc.Metadata // queried by filter
+		if metadata == nil {
+			metadata = map[string]any{}
 		}
-		metadata := map[string]any{}
-		metadata["source"] = doc.Metadata["source"]
-		batch.Queue(query, doc.ID, doc.Title, doc.Content, contentHash, pgvector.NewVector(embedding), metadata)
+		keywords := strings.Join(pkgstrings.Tokenize(doc.Title+" "+doc.Content), " ")
+		batch.Queue(query, doc.ID, doc.Title, doc.Content, contentHash, pgvector.NewVector(embedding), metadata, keywords)
 	}
 	br := v.db.SendBatch(ctx, batch)
 	defer br.Close()
@@ -179,9 +202,15 @@ func (v *VectorDB) SearchWithOptions(ctx context.Context, embedding []float32, o
 			tx.Exec(ctx, "SET LOCAL hnsw.ef_search = $1;", v.config.Index.Params["ef_search"])
 		}
 	}
-	query := fmt.Sprintf("SELECT %s FROM %s WHERE TRUE ORDER BY embedding %s $2 LIMIT $3;",
-		strings.Join(columns, ", "), v.config.Table, getDistanceOp(v.config.Distance))
-	rows, err := tx.Query(ctx, query, pgvector.NewVector(embedding), pgvector.NewVector(embedding), options.TopK)
+	condition, args, err := where(options.Filter,
+		[]any{pgvector.NewVector(embedding), pgvector.NewVector(embedding), options.TopK})
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY embedding %s $2 LIMIT $3;",
+		strings.Join(columns, ", "), v.config.Table, condition, getDistanceOp(v.config.Distance))
+	rows, err := tx.Query(ctx, query, args...)
 	if err != nil {
 		tx.Rollback(ctx)
 		return nil, fmt.Errorf("query: %w", err)
@@ -191,8 +220,7 @@ func (v *VectorDB) SearchWithOptions(ctx context.Context, embedding []float32, o
 	docs := make([]*vdb.Document, 0)
 	for rows.Next() {
 		var doc vdb.Document
-		var id int64
-		err = rows.Scan(&id, &doc.Title, &doc.Content, &doc.ContentHash, &doc.Embedding, &doc.Metadata, &doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+		err = rows.Scan(&doc.Similarity, &doc.Title, &doc.Content, &doc.ContentHash, &doc.Embedding, &doc.Metadata, &doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
@@ -208,6 +236,60 @@ func (v *VectorDB) SearchWithOptions(ctx context.Context, embedding []float32, o
 	return docs, nil
 }
 
+// DistanceScore the similarity column is the distance of the operator, e.g. <=>
+func (v *VectorDB) DistanceScore() bool {
+	return true
+}
+
+// KeywordSearch full-text search on the keywords column ranked by ts_rank, the query terms are matched by any
+func (v *VectorDB) KeywordSearch(ctx context.Context, query string, options *vdb.SearchOptions) ([]*vdb.Document, error) {
+	tokens := pkgstrings.Tokenize(query)
+	if len(tokens) == 0 {
+		return []*vdb.Document{}, nil
+	}
+	terms := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		terms = append(terms, "'"+strings.ReplaceAll(token, "'", "''")+"'")
+	}
+	topK := options.TopK
+	if topK <= 0 {
+		topK = 10
+	}
+	condition, args, err := where(options.Filter, []any{strings.Join(terms, " | "), topK})
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	columns := []string{
+		"ts_rank(keywords, to_tsquery('simple', $1)) as similarity",
+		"title",
+		"content",
+		"content_hash",
+		"embedding",
+		"metadata",
+		"source_id",
+		"created_at",
+		"updated_at",
+	}
+	sql := fmt.Sprintf("SELECT %s FROM %s WHERE keywords @@ to_tsquery('simple', $1) AND %s ORDER BY similarity DESC LIMIT $2;",
+		strings.Join(columns, ", "), v.config.Table, condition)
+	rows, err := v.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	docs := make([]*vdb.Document, 0)
+	for rows.Next() {
+		var doc vdb.Document
+		err = rows.Scan(&doc.Similarity, &doc.Title, &doc.Content, &doc.ContentHash, &doc.Embedding, &doc.Metadata, &doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		docs = append(docs, &doc)
+	}
+	return docs, rows.Err()
+}
+
 // vector similarity search
 func (v *VectorDB) Search(ctx context.Context, embedding []float32, opts ...vdb.SearchOption) ([]*vdb.Document, error) {
 	options := &vdb.SearchOptions{}
@@ -241,7 +323,15 @@ func (v *VectorDB) SearchQuery(ctx context.Context, query string, opts ...vdb.Se
 }
 
 func (v *VectorDB) Delete(ctx context.Context, id string) error {
-	// TODO: implement
+	return v.DeleteBatch(ctx, []string{id})
+}
+
+// DeleteBatch deletes the documents of source ids
+func (v *VectorDB) DeleteBatch(ctx context.Context, ids []string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE source_id = ANY($1)", v.config.Table)
+	if _, err := v.db.Exec(ctx, query, ids); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
 	return nil
 }
 
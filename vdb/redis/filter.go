@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/showntop/llmack/vdb"
+)
+
+// query translates filter to the pre-filter of FT.SEARCH, the metadata keys must be
+// indexed as TAG (eq, in of strings) or NUMERIC (range, eq of numbers) by Config.FieldSchema
+func query(filter *vdb.Filter) (string, error) {
+	if filter == nil {
+		return "*", nil
+	}
+	if err := filter.Validate(); err != nil {
+		return "", err
+	}
+	return translate(filter)
+}
+
+func translate(filter *vdb.Filter) (string, error) {
+	switch filter.Op {
+	case vdb.FilterEq:
+		if _, ok := vdb.Number(filter.Value); ok {
+			number := vdb.FormatNumber(filter.Value)
+			return fmt.Sprintf("@%s:[%s %s]", filter.Key, number, number), nil
+		}
+		return fmt.Sprintf("@%s:{%s}", filter.Key, escapeTag(fmt.Sprint(filter.Value))), nil
+	case vdb.FilterIn:
+		if len(filter.Values) == 0 {
+			return "-*", nil
+		}
+		tags := []string{}
+		for _, value := range filter.Values {
+			tags = append(tags, escapeTag(fmt.Sprint(value)))
+		}
+		return fmt.Sprintf("@%s:{%s}", filter.Key, strings.Join(tags, " | ")), nil
+	case vdb.FilterRange:
+		min, max := "-inf", "+inf"
+		if filter.Min != nil {
+			min = vdb.FormatNumber(filter.Min)
+		}
+		if filter.Max != nil {
+			max = vdb.FormatNumber(filter.Max)
+		}
+		return fmt.Sprintf("@%s:[%s %s]", filter.Key, min, max), nil
+	default: // and, or
+		if len(filter.Filters) == 0 {
+			if filter.Op == vdb.FilterAnd {
+				return "*", nil
+			}
+			return "-*", nil
+		}
+		separator := " "
+		if filter.Op == vdb.FilterOr {
+			separator = " | "
+		}
+		conditions := []string{}
+		for _, f := range filter.Filters {
+			condition, err := translate(f)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, condition)
+		}
+		return "(" + strings.Join(conditions, separator) + ")", nil
+	}
+}
+
+// escapeTag escapes the punctuation and spaces of tag value
+func escapeTag(value string) string {
+	builder := strings.Builder{}
+	for _, r := range value {
+		if strings.ContainsRune(",.<>{}[]\"':;!@#$%^&*()-+=~|/\\ ", r) {
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
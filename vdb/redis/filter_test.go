@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/showntop/llmack/vdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery(t *testing.T) {
+	condition, err := query(vdb.And(
+		vdb.Eq("tenant", "acme corp"),
+		vdb.Eq("page", 3),
+		vdb.Or(vdb.In("doc_id", "a-1", "b"), vdb.Range("published_at", 100, nil)),
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, `(@tenant:{acme\ corp} @page:[3 3] (@doc_id:{a\-1 | b} | @published_at:[100 +inf]))`, condition)
+
+	condition, err = query(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "*", condition)
+
+	condition, err = query(vdb.In("doc_id"))
+	assert.NoError(t, err)
+	assert.Equal(t, "-*", condition)
+
+	_, err = query(&vdb.Filter{Op: vdb.FilterEq})
+	assert.Error(t, err)
+}
+
+// TestEmpty 空 And 匹配全部、空 Or 不匹配，与 memo 的 Match 保持一致
+func TestEmpty(t *testing.T) {
+	metadata := map[string]any{"tenant": "acme"}
+	for _, filter := range []*vdb.Filter{vdb.And(), vdb.And(nil), vdb.Or(), vdb.Or(nil)} {
+		condition, err := query(filter)
+		assert.NoError(t, err)
+		want := "*"
+		if !filter.Match(metadata) {
+			want = "-*"
+		}
+		assert.Equal(t, want, condition, filter.Op)
+	}
+}
@@ -2,7 +2,10 @@ package redis
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 
 	"slices"
@@ -18,17 +21,19 @@ func init() {
 }
 
 type VDB struct {
-	client    *redis.Client
-	index     string
-	dimension int
+	client      *redis.Client
+	index       string
+	keyPrefix   string
+	dimension   int
+	fieldSchema []*redis.FieldSchema // metadata fields for filtering
 }
 
 type Config struct {
 	redis.Options
 	redis.FTCreateOptions
 	Index       string
-	KeyPrefix   string
-	FieldSchema []*redis.FieldSchema
+	KeyPrefix   string               // 文档的 hash 键为 KeyPrefix + "doc:" + id
+	FieldSchema []*redis.FieldSchema // 元数据字段的索引，字段名与元数据的键相同
 }
 
 func New(config any) (vdb.VDB, error) {
@@ -46,8 +51,10 @@ func New(config any) (vdb.VDB, error) {
 	}
 
 	db := &VDB{
-		client: client,
-		index:  cfg.Index,
+		client:      client,
+		index:       cfg.Index,
+		keyPrefix:   cfg.KeyPrefix,
+		fieldSchema: cfg.FieldSchema,
 		// dimension: cfg.FTCreateOptions.,
 	}
 
@@ -64,11 +71,18 @@ func (r *VDB) Create(ctx context.Context) error {
 	return r.ensureIndex(ctx)
 }
 
+// Store writes every document as a hash, the metadata keys are fields indexed by Config.FieldSchema
 func (r *VDB) Store(ctx context.Context, docs ...*vdb.Document) error {
+	pipe := r.client.Pipeline()
 	for _, doc := range docs {
-		if err := r.client.Do(ctx, "HSET", r.index, doc.ID, doc.Metadata).Err(); err != nil {
+		fields, err := hash(doc)
+		if err != nil {
 			return err
 		}
+		pipe.HSet(ctx, r.key(doc.ID), fields)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("store: %w", err)
 	}
 	return nil
 }
@@ -89,13 +103,18 @@ func (r *VDB) Search(ctx context.Context, vector []float32, opts ...vdb.SearchOp
 		vector64[i] = float64(v)
 	}
 
-	// 构建向量搜索查询
-	query := fmt.Sprintf("*=>[KNN %d @vector $BLOB AS score]", options.TopK)
+	// 构建向量搜索查询，过滤条件作为 KNN 的预过滤
+	filter, err := query(options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	knn := fmt.Sprintf("%s=>[KNN %d @vector $BLOB AS score]", filter, options.TopK)
 
 	// 执行搜索
-	res := r.client.Do(ctx, "FT.SEARCH", r.index, query,
+	res := r.client.Do(ctx, "FT.SEARCH", r.index, knn,
+		"DIALECT", "2",
 		"PARAMS", "2", "BLOB", vectorToBytes(vector64),
-		"RETURN", "4", "id", "query", "answer", "score",
+		"RETURN", "5", "id", "title", "content", "metadata", "score",
 		"LIMIT", "0", strconv.Itoa(options.TopK),
 	)
 
@@ -110,18 +129,26 @@ func (r *VDB) Search(ctx context.Context, vector []float32, opts ...vdb.SearchOp
 	}
 
 	var docs []*vdb.Document
-	// Redis 返回格式: [total_results doc1_id doc1_fields... doc2_id doc2_fields...]
-	for i := 1; i < len(results); i += 2 {
-		fields := results[i+1].([]interface{})
-		score, _ := strconv.ParseFloat(fields[7].(string), 64)
+	// Redis 返回格式: [total_results doc1_key doc1_fields... doc2_key doc2_fields...]，fields 为 [name value ...]
+	for i := 1; i+1 < len(results); i += 2 {
+		values, _ := results[i+1].([]any)
+		fields := map[string]string{}
+		for j := 0; j+1 < len(values); j += 2 {
+			fields[fmt.Sprint(values[j])] = fmt.Sprint(values[j+1])
+		}
+		score, _ := strconv.ParseFloat(fields["score"], 64)
 
 		if score > options.Threshold {
-			id, _ := strconv.ParseInt(fields[1].(string), 10, 64)
-			docs = append(docs, &vdb.Document{
-				ID:       strconv.FormatInt(id, 10),
-				Title:    fields[3].(string),
-				Metadata: fields[5].(map[string]any),
-			})
+			doc := &vdb.Document{
+				ID:         fields["id"],
+				Title:      fields["title"],
+				Content:    fields["content"],
+				Similarity: float32(score),
+			}
+			if err := json.Unmarshal([]byte(fields["metadata"]), &doc.Metadata); err != nil {
+				return nil, fmt.Errorf("parse metadata: %w", err)
+			}
+			docs = append(docs, doc)
 		}
 	}
 
@@ -156,8 +183,18 @@ func (r *VDB) SearchQueryWithOptions(ctx context.Context, query string, options
 }
 
 func (r *VDB) Delete(ctx context.Context, id string) error {
-	err := r.client.Del(ctx, fmt.Sprintf("doc:%s", id)).Err()
-	if err != nil {
+	return r.DeleteBatch(ctx, []string{id})
+}
+
+func (r *VDB) DeleteBatch(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = r.key(id)
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
 		return fmt.Errorf("delete: %w", err)
 	}
 	return nil
@@ -195,7 +232,7 @@ func (r *VDB) ensureIndex(ctx context.Context) error {
 			Weight:    1,
 		},
 		{
-			FieldName: "vector_content",
+			FieldName: "vector",
 			FieldType: redis.SearchFieldTypeVector,
 			VectorArgs: &redis.FTVectorArgs{
 				// FLAT index: https://redis.io/docs/latest/develop/interact/search-and-query/advanced-concepts/vectors/#flat-index
@@ -215,12 +252,13 @@ func (r *VDB) ensureIndex(ctx context.Context) error {
 			FieldType: redis.SearchFieldTypeNumeric,
 		},
 	}
+	schemas = append(schemas, r.fieldSchema...)
 
 	// 创建索引
 	createIndex := r.client.FTCreate(ctx, r.index,
 		&redis.FTCreateOptions{
 			OnHash: true,
-			Prefix: []any{},
+			Prefix: []any{r.key("")},
 		},
 		schemas...,
 	)
@@ -232,13 +270,60 @@ func (r *VDB) ensureIndex(ctx context.Context) error {
 	return nil
 }
 
+// DistanceScore the score of KNN is the vector distance
+func (r *VDB) DistanceScore() bool {
+	return true
+}
+
+// key the hash key of document
+func (r *VDB) key(id string) string {
+	return r.keyPrefix + "doc:" + id
+}
+
+// hash the fields of document, metadata values are stored as strings (numbers formatted for NUMERIC fields)
+func hash(doc *vdb.Document) (map[string]any, error) {
+	fields := map[string]any{}
+	for key, value := range doc.Metadata {
+		switch v := value.(type) {
+		case string:
+			fields[key] = v
+		case bool:
+			fields[key] = strconv.FormatBool(v)
+		default:
+			if _, ok := vdb.Number(value); ok {
+				fields[key] = vdb.FormatNumber(value)
+			}
+		}
+	}
+	metadata, err := json.Marshal(doc.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("marshal metadata: %w", err)
+	}
+	fields["id"] = doc.ID
+	fields["title"] = doc.Title
+	fields["content"] = doc.Content
+	fields["content_hash"] = doc.ContentHash
+	fields["metadata"] = string(metadata)
+	if embedding := doc.Embedding.Slice(); len(embedding) > 0 {
+		vector := make([]float64, len(embedding))
+		for i, v := range embedding {
+			vector[i] = float64(v)
+		}
+		fields["vector"] = vectorToBytes(vector)
+	}
+	return fields, nil
+}
+
 func (r *VDB) textToVector(text string) ([]float64, error) {
 	// TODO: 实现文本到向量的转换
 	return nil, fmt.Errorf("not implemented")
 }
 
-// 辅助函数：将向量转换为字节
+// 辅助函数：将向量转换为字节，与索引的 FLOAT32 类型一致
 func vectorToBytes(vector []float64) []byte {
-	// TODO: 实现向量到字节的转换
-	return nil
+	raw := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(float32(v)))
+	}
+	return raw
 }
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/redis/go-redis/v9"
+	"github.com/showntop/llmack/vdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash(t *testing.T) {
+	fields, err := hash(&vdb.Document{
+		ID:        "guide.md#1",
+		Title:     "Install",
+		Content:   "run make",
+		Embedding: pgvector.NewVector([]float32{1, 0.5}),
+		Metadata:  map[string]any{"tenant": "acme", "page": 3, "draft": false},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "guide.md#1", fields["id"])
+	assert.Equal(t, "acme", fields["tenant"]) // TAG
+	assert.Equal(t, "3", fields["page"])      // NUMERIC
+	assert.Equal(t, "false", fields["draft"])
+	assert.JSONEq(t, `{"tenant":"acme","page":3,"draft":false}`, fields["metadata"].(string))
+	assert.Len(t, fields["vector"], 8)
+}
+
+// recorder records the commands instead of sending them
+type recorder struct {
+	commands [][]any
+}
+
+func (r *recorder) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, fmt.Errorf("dial %s disabled", addr)
+	}
+}
+
+func (r *recorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		r.commands = append(r.commands, cmd.Args())
+		return nil
+	}
+}
+
+func (r *recorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			r.commands = append(r.commands, cmd.Args())
+		}
+		return nil
+	}
+}
+
+func TestVDB_StoreDelete(t *testing.T) {
+	recorder := &recorder{}
+	client := redis.NewClient(&redis.Options{})
+	client.AddHook(recorder)
+	db := &VDB{client: client, keyPrefix: "kb:"}
+
+	assert.NoError(t, db.Store(context.Background(), &vdb.Document{ID: "guide.md#1", Content: "run make"}))
+	assert.NoError(t, db.DeleteBatch(context.Background(), []string{"guide.md#1", "guide.md#2"}))
+	assert.NoError(t, db.DeleteBatch(context.Background(), nil))
+	assert.Len(t, recorder.commands, 2)
+	assert.Equal(t, []any{"hset", "kb:doc:guide.md#1"}, recorder.commands[0][:2])
+	// deletes the hashes written by Store
+	assert.Equal(t, []any{"del", "kb:doc:guide.md#1", "kb:doc:guide.md#2"}, recorder.commands[1])
+	assert.Equal(t, "kb:doc:", db.key("")) // the prefix of index
+}
@@ -43,6 +43,45 @@ type VDB interface {
 	Close() error
 }
 
+// KeywordSearcher 关键词（全文）检索，由支持全文索引的后端实现，如 pgvector，
+// 与向量检索结果融合为混合检索，文档的 Similarity 为关键词相关度
+type KeywordSearcher interface {
+	KeywordSearch(context.Context, string, *SearchOptions) ([]*Document, error)
+}
+
+// DistanceScorer 由向量检索结果的 Similarity 为距离（越小越相关）的后端实现，如 pgvector；
+// 未实现时 Similarity 为相似度（越大越相关），KeywordSearcher 的得分总是越大越相关
+type DistanceScorer interface {
+	DistanceScore() bool
+}
+
+// IsDistance whether the Similarity of search results of db is a distance
+func IsDistance(db any) bool {
+	scorer, ok := db.(DistanceScorer)
+	return ok && scorer.DistanceScore()
+}
+
+// BatchDeleter 批量删除文档，由各后端以单条语句实现
+type BatchDeleter interface {
+	DeleteBatch(context.Context, []string) error
+}
+
+// Delete deletes the documents of ids in bulk if db is a BatchDeleter, otherwise one by one
+func Delete(ctx context.Context, db VDB, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if deleter, ok := db.(BatchDeleter); ok {
+		return deleter.DeleteBatch(ctx, ids)
+	}
+	for _, id := range ids {
+		if err := db.Delete(ctx, id); err != nil {
+			return fmt.Errorf("delete %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
 // Document 文档
 type Document struct {
 	ID          string          `json:"id"`
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/expr-lang/expr"
 	"github.com/showntop/flatmap"
+	"github.com/showntop/llmack/hooks"
 	"github.com/showntop/llmack/llm"
 	"github.com/showntop/llmack/log"
 	"github.com/showntop/llmack/workflow"
@@ -46,6 +48,16 @@ func (e *Executor) Execute(ctx context.Context, inputs map[string]any) (*workflo
 
 	e.scope = inputs // 初始化scope TODO 增加系统变量
 
+	ctx, span := hooks.StartWorkflowSpan(ctx, strconv.FormatInt(e.workflow.ID, 10))
+	defer span.End()
+
+	// 记录所有节点的 llm 用量
+	ledger := llm.NewLedger()
+	if parent := llm.LedgerFrom(ctx); parent != nil {
+		ledger = parent.Child()
+	}
+	ctx = llm.WithLedger(ctx, ledger)
+
 	// 构建DAG图
 	graph := NewGraph(e.workflow.Nodes, e.workflow.Edges)
 	e.graph = graph
@@ -89,18 +101,25 @@ func (e *Executor) Execute(ctx context.Context, inputs map[string]any) (*workflo
 	// 关闭流 @TODO fix it on 恰当位置
 	// close(e.events)
 	log.InfoContextf(ctx, "workflow execute workflow %v, finished with outputs: %+v", e.workflow.ID, e.outputs)
+	total := ledger.Total()
 	return &workflow.Result{
 		Outputs: e.outputs,
+		Usage:   total.Usage(),
+		Cost:    total.Cost,
+		Ledger:  ledger,
 	}, nil
 }
 
 // executeNode 执行单个节点
-func (e *Executor) executeNode(ctx context.Context, node *workflow.Node, outgoings ...*workflow.Edge) ([]*workflow.Node, error) {
+func (e *Executor) executeNode(ctx context.Context, node *workflow.Node, outgoings ...*workflow.Edge) (_ []*workflow.Node, err error) {
 	// 检查节点的所有前置依赖是否已完成
 	// if !graph.AreAllDependenciesCompleted(node.ID) {
 	// 	return nil, nil
 	// }
 
+	ctx, span := hooks.StartNodeSpan(ctx, node.ID, string(node.Kind))
+	defer func() { hooks.EndSpan(span, err) }()
+
 	nodeIns, err := nodePkg.Build(node, outgoings...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build node %s: %w", node.ID, err)
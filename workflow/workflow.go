@@ -1,8 +1,13 @@
 package workflow
 
+import "github.com/showntop/llmack/llm"
+
 // Result ...
 type Result struct {
 	Outputs map[string]any
+	Usage   llm.Usage   // llm usage of all nodes
+	Cost    float64     // llm cost of all nodes
+	Ledger  *llm.Ledger // usage per provider, model, agent and session
 }
 
 // Workflow ...